@@ -0,0 +1,365 @@
+package apidCRUD
+
+// this module implements online backup and restore of sqlite databases.
+// both use sqlite's online backup API.  a backup is a consistent
+// snapshot of the database, copied while the database is in use.
+// it is saved in the backup directory, or made in a temporary file
+// and streamed from it as the response.  a restore copies a saved
+// snapshot into the database, which locks the database while it runs,
+// then reopens the database, so that the snapshot's catalog is
+// migrated and reconciled as at startup.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// snapshotSuffix is the file name suffix of a snapshot.
+const snapshotSuffix = ".db"
+
+// snapshotType is the media type of a streamed snapshot.
+const snapshotType = "application/vnd.sqlite3"
+
+// restoreLock serializes restores.
+var restoreLock sync.Mutex
+
+// getDbBackupsHandler handles GET requests on /db/_admin/backup .
+// it lists the snapshots in the backup directory.
+func getDbBackupsHandler(harg *apiHandlerArg) apiHandlerRet {
+	if err := harg.db().sqlOnly("backup"); err != nil {
+		return errorRet(badStat, err, "after sqlOnly")
+	}
+	list, err := listSnapshots()
+	if err != nil {
+		return errorRet(badStat, err, "after listSnapshots")
+	}
+	u := harg.req.URL
+	self := fmt.Sprintf("%s://%s%s%s",
+		u.Scheme, u.Host, basePath, harg.db().path("_admin/backup"))
+	return apiHandlerRet{http.StatusOK,
+		BackupsResponse{list, "BackupsResponse", self}}
+}
+
+// runDbBackupHandler handles POST requests on /db/_admin/backup .
+// it saves a snapshot of the database in the backup directory,
+// or, if the stream parameter is true, returns it as the response.
+func runDbBackupHandler(harg *apiHandlerArg) apiHandlerRet {
+	params, err := fetchParams(harg, "stream")
+	if err != nil {
+		return errorRet(badStat, err, "after fetchParams")
+	}
+	d := harg.db()
+	if params["stream"] == "true" {
+		f, err := tempSnapshot(d)
+		if err != nil {
+			return errorRet(badStat, err, "after tempSnapshot")
+		}
+		defer removeTempSnapshot(f)
+		if fi, err := f.Stat(); err == nil {
+			harg.header.Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		}
+		harg.header.Set("Content-Disposition", fmt.Sprintf(
+			`attachment; filename="%s"`, filepath.Base(f.Name())))
+		return harg.stream(http.StatusOK, snapshotType,
+			func(w io.Writer) error {
+				_, err := io.Copy(w, f)
+				return err
+			})
+	}
+	info, err := saveSnapshot(d)
+	if err != nil {
+		return errorRet(badStat, err, "after saveSnapshot")
+	}
+	return apiHandlerRet{http.StatusCreated, info}
+}
+
+// runDbRestoreHandler handles POST requests on /db/_admin/restore .
+// it replaces the contents of the database with the named snapshot.
+func runDbRestoreHandler(harg *apiHandlerArg) apiHandlerRet {
+	body := RestoreRequest{}
+	if err := harg.decodeBody(&body); err != nil {
+		return errorRet(badStat, err, "after decodeBody")
+	}
+	info, err := restoreSnapshot(harg.db(), body.Name)
+	if err != nil {
+		return errorRet(badStat, err, "after restoreSnapshot")
+	}
+	return apiHandlerRet{http.StatusOK, info}
+}
+
+// snapshotName() returns the file name of a snapshot of the given
+// database, taken at the given time.  the default database's
+// snapshots are prefixed "_default", which is not a database name.
+func snapshotName(d dbType, when time.Time) string {
+	prefix := d.name
+	if prefix == "" {
+		prefix = "_default"
+	}
+	return fmt.Sprintf("%s-%s%s", prefix,
+		when.UTC().Format("20060102T150405.000000000Z"), snapshotSuffix)
+}
+
+// snapshotPath() returns the path of the named snapshot
+// in the backup directory.  the name must be a plain file name.
+func snapshotPath(name string) (string, error) {
+	if backupDir == "" {
+		return "", fmt.Errorf("no backup directory is configured")
+	}
+	if name == "" || filepath.Base(name) != name ||
+			strings.HasPrefix(name, ".") ||
+			!strings.HasSuffix(name, snapshotSuffix) {
+		return "", validationError(
+			fmt.Errorf("invalid snapshot name %s", name))
+	}
+	return filepath.Join(backupDir, name), nil
+}
+
+// snapshotInfo() returns the description of the named snapshot.
+func snapshotInfo(name string, kind string) (BackupResponse, error) {
+	path, err := snapshotPath(name)
+	if err != nil {
+		return BackupResponse{}, err
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return BackupResponse{}, notFoundError(
+			fmt.Errorf("no snapshot %s", name))
+	}
+	if err != nil {
+		return BackupResponse{}, err
+	}
+	return BackupResponse{
+		Name: name,
+		Size: fi.Size(),
+		Time: fi.ModTime().UTC().Format(time.RFC3339),
+		Kind: kind,
+	}, nil
+}
+
+// listSnapshots() returns the descriptions of the snapshots
+// in the backup directory, by name.
+func listSnapshots() ([]BackupResponse, error) {
+	if backupDir == "" {
+		return nil, fmt.Errorf("no backup directory is configured")
+	}
+	files, err := ioutil.ReadDir(backupDir)
+	if os.IsNotExist(err) {
+		return []BackupResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, fi := range files {
+		if _, err := snapshotPath(fi.Name()); err == nil && !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	ret := make([]BackupResponse, 0, len(names))
+	for _, name := range names {
+		info, err := snapshotInfo(name, "BackupResponse")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, info)
+	}
+	return ret, nil
+}
+
+// writeSnapshot() writes a consistent snapshot of the database to the
+// given path, which must not exist.
+func writeSnapshot(d dbType, path string) error {
+	if err := d.sqlOnly("backup"); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return conflictError(
+			fmt.Errorf("snapshot %s exists", filepath.Base(path)))
+	}
+	h, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer h.Close() // nolint
+	if err = backupDatabase(d.context(), h, d.handle); err != nil {
+		os.Remove(path) // nolint
+	}
+	return err
+}
+
+// saveSnapshot() saves a snapshot of the database in the
+// backup directory, and returns its description.
+func saveSnapshot(d dbType) (BackupResponse, error) {
+	name := snapshotName(d, time.Now())
+	path, err := snapshotPath(name)
+	if err != nil {
+		return BackupResponse{}, err
+	}
+	if err = os.MkdirAll(backupDir, 0750); err != nil {
+		return BackupResponse{}, err
+	}
+	if err = writeSnapshot(d, path); err != nil {
+		return BackupResponse{}, err
+	}
+	d.log().Infof("saved snapshot %s", path)
+	return snapshotInfo(name, "BackupResponse")
+}
+
+// tempSnapshot() makes a snapshot of the database in a temporary
+// directory, and returns it open for reading.
+// removeTempSnapshot() removes it, and the directory.
+func tempSnapshot(d dbType) (*os.File, error) {
+	dir, err := ioutil.TempDir("", "apidCRUD-backup")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, snapshotName(d, time.Now()))
+	if err = writeSnapshot(d, path); err != nil {
+		os.RemoveAll(dir) // nolint
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		os.RemoveAll(dir) // nolint
+		return nil, err
+	}
+	return f, nil
+}
+
+// removeTempSnapshot() closes and removes a snapshot
+// returned by tempSnapshot().
+func removeTempSnapshot(f *os.File) {
+	f.Close() // nolint
+	os.RemoveAll(filepath.Dir(f.Name())) // nolint
+}
+
+// checkSnapshot() checks that the snapshot at the given path
+// is an intact sqlite database, whose catalog this code can use.
+func checkSnapshot(ctx context.Context, path string) error {
+	h, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer h.Close() // nolint
+	snap := dbType{handle: h, ctx: ctx}
+	var result string
+	err = h.QueryRowContext(ctx, "pragma integrity_check").Scan(&result)
+	if err != nil {
+		return validationError(fmt.Errorf("snapshot is not usable: %s", err))
+	}
+	if result != "ok" {
+		return validationError(
+			fmt.Errorf("snapshot failed integrity check: %s", result))
+	}
+	version, err := getCatalogVersion(snap)
+	if err != nil {
+		return err
+	}
+	if version > catalogVersion {
+		return validationError(fmt.Errorf(
+			"snapshot catalog version %d is newer than supported (%d)",
+			version, catalogVersion))
+	}
+	return nil
+}
+
+// copyDatabase() copies the sqlite database at path srcPath into
+// the given database.
+func copyDatabase(d dbType, srcPath string) error {
+	src, err := sql.Open("sqlite3", "file:"+srcPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close() // nolint
+	return backupDatabase(d.context(), d.handle, src)
+}
+
+// backupDatabase() copies the sqlite database src into dest, with
+// the online backup API.  the copy is made in one step, so it is
+// consistent.  dest is locked while the copy runs; other connections
+// wait for it, as they would for any writer.
+func backupDatabase(ctx context.Context, dest *sql.DB, src *sql.DB) error {
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close() // nolint
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close() // nolint
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			dest, ok1 := destRaw.(*sqlite3.SQLiteConn)
+			src, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok1 || !ok2 {
+				return fmt.Errorf("backup needs sqlite connections")
+			}
+			b, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+			if _, err = b.Step(-1); err != nil {
+				_ = b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// restoreSnapshot() replaces the contents of the database with the
+// named snapshot, then reopens the database.  requests already
+// using the old handle finish on it; later ones get the new one.
+// the old handle is closed when the last of them finishes.
+func restoreSnapshot(d dbType, name string) (BackupResponse, error) {
+	if err := d.sqlOnly("restore"); err != nil {
+		return BackupResponse{}, err
+	}
+	info, err := snapshotInfo(name, "RestoreResponse")
+	if err != nil {
+		return info, err
+	}
+	path, _ := snapshotPath(name)
+	if err = checkSnapshot(d.context(), path); err != nil {
+		return info, err
+	}
+
+	restoreLock.Lock()
+	defer restoreLock.Unlock()
+	// the request's handle may have been replaced meanwhile.
+	cur, err := currentDb(d.name)
+	if err != nil {
+		return info, err
+	}
+	d = cur.withContext(d.context())
+	if err = copyDatabase(d, path); err != nil {
+		return info, err
+	}
+	newDb, err := initDB(dbSource(d.name))
+	if err != nil {
+		return info, unavailableError(err)
+	}
+	newDb.name = d.name
+	replaceDb(newDb)
+	noteDbChange(d.name)
+	cur.retire()
+	d.log().Infof("restored snapshot %s", path)
+	return info, nil
+}
@@ -0,0 +1,265 @@
+package apidCRUD
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ----- unit tests for snapshotPath()
+
+// inputs and outputs for one snapshotPath testcase.
+type snapshotPath_TC struct {
+	name string
+	xsucc bool
+}
+
+// table of snapshotPath testcases.
+var snapshotPath_Tab = []snapshotPath_TC {
+	{ "a-20260101T000000.000000000Z.db", true },
+	{ "x.db", true },
+	{ "", false },
+	{ ".db", false },
+	{ "x.txt", false },
+	{ "../x.db", false },
+	{ "d/x.db", false },
+}
+
+// run one testcase for function snapshotPath.
+func snapshotPath_Checker(cx *testContext, tc *snapshotPath_TC) {
+	res, err := snapshotPath(tc.name)
+	if !cx.assertEqual(tc.xsucc, err == nil, "succ") || err != nil {
+		return
+	}
+	cx.assertEqual(filepath.Join(backupDir, tc.name), res, "result")
+}
+
+// the snapshotPath test suite.  run all snapshotPath testcases.
+func Test_snapshotPath(t *testing.T) {
+	cx := newTestContext(t, "snapshotPath_Tab")
+	for _, tc := range snapshotPath_Tab {
+		snapshotPath_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for checkSnapshot()
+
+// inputs and outputs for one checkSnapshot testcase.
+type checkSnapshot_TC struct {
+	setup []string
+	xsucc bool
+}
+
+// table of checkSnapshot testcases.
+var checkSnapshot_Tab = []checkSnapshot_TC {
+	{ []string{"create table t (x)"}, true },
+	{ catalogVersionSetup(catalogVersion), true },
+	{ catalogVersionSetup(catalogVersion+1), false },
+	// user_version is not the catalog's.
+	{ []string{"pragma user_version = 42"}, true },
+}
+
+// run one testcase for function checkSnapshot.
+func checkSnapshot_Checker(cx *testContext, tc *checkSnapshot_TC) {
+	tdb, cleanup := mkTempDb(tempDbOpts{setup: tc.setup})
+	defer cleanup()
+	var path string
+	_ = tdb.handle.QueryRow("select file from pragma_database_list").Scan(&path)
+	err := checkSnapshot(tdb.context(), path)
+	cx.assertEqual(tc.xsucc, err == nil, "succ")
+}
+
+// the checkSnapshot test suite.  run all checkSnapshot testcases.
+func Test_checkSnapshot(t *testing.T) {
+	cx := newTestContext(t, "checkSnapshot_Tab")
+	for _, tc := range checkSnapshot_Tab {
+		checkSnapshot_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+func Test_checkSnapshot_notDb(t *testing.T) {
+	cx := newTestContext(t)
+	f, _ := ioutil.TempFile("", "backup-test-*.db")
+	defer os.Remove(f.Name()) // nolint
+	_, _ = f.WriteString("this is not a database, but it is long enough")
+	_ = f.Close()
+	err := checkSnapshot(db.context(), f.Name())
+	cx.assertTrue(err != nil, "not a database")
+}
+
+// ----- unit tests for writeSnapshot()
+
+func Test_writeSnapshot(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkDumpDb(3)
+	defer cleanup()
+	dir, _ := ioutil.TempDir("", "backup-test")
+	defer os.RemoveAll(dir) // nolint
+	path := filepath.Join(dir, "x.db")
+
+	err := writeSnapshot(tdb, path)
+	if !cx.assertErrorNil(err, "writeSnapshot") {
+		return
+	}
+	cx.assertErrorNil(checkSnapshot(tdb.context(), path), "checkSnapshot")
+	h, _ := sql.Open("sqlite3", path)
+	defer h.Close() // nolint
+	var n int
+	_ = h.QueryRow("select count(*) from t1").Scan(&n)
+	cx.assertEqual(3, n, "records in snapshot")
+
+	err = writeSnapshot(tdb, path)
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(http.StatusConflict, code, "existing snapshot")
+}
+
+// ----- end-to-end tests of backup and restore
+
+// backupCall() makes one API call on ws, and returns the response.
+func backupCall(cx *testContext, ws *apiWiring, verb string, path string,
+		body string, xcode int) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(verb, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(xcode, w.Code, verb + " " + path + ": " + w.Body.String())
+	return w
+}
+
+func Test_backupRestore(t *testing.T) {
+	cx := newTestContext(t)
+	reg, cleanup := mkTempDbs()
+	defer cleanup()
+	defer func(saved *dbRegistry) { dbs = saved }(dbs)
+	dbs = reg
+	dir, _ := ioutil.TempDir("", "backup-test")
+	defer os.RemoveAll(dir) // nolint
+	defer func(saved string) { backupDir = saved }(backupDir)
+	backupDir = filepath.Join(dir, "backups")
+
+	ws := newApiWiring("", apiTable, defaultMiddleware...)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_schema/t1",
+		`{"fields":[{"name":"id","properties":["is_primary_key"]},{"name":"name"}]}`,
+		http.StatusCreated)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_table/t1",
+		`{"records":[{"keys":["name"],"values":["x"]}]}`,
+		http.StatusCreated)
+
+	w := backupCall(cx, ws, http.MethodPost, "/db/a/_admin/backup", "",
+		http.StatusCreated)
+	info := BackupResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), &info)
+	cx.assertErrorNil(err, "decode backup response")
+	cx.assertTrue(strings.HasPrefix(info.Name, "a-"), "snapshot name")
+	cx.assertTrue(info.Size > 0, "snapshot size")
+
+	w = backupCall(cx, ws, http.MethodGet, "/db/a/_admin/backup", "",
+		http.StatusOK)
+	cx.assertTrue(strings.Contains(w.Body.String(), info.Name),
+		"snapshot listed")
+
+	// changes after the snapshot are undone by the restore.
+	backupCall(cx, ws, http.MethodPost, "/db/a/_table/t1",
+		`{"records":[{"keys":["name"],"values":["y"]}]}`,
+		http.StatusCreated)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_admin/restore",
+		`{"name":"` + info.Name + `"}`, http.StatusOK)
+	backupCall(cx, ws, http.MethodGet, "/db/a/_table/t1/1", "",
+		http.StatusOK)
+	backupCall(cx, ws, http.MethodGet, "/db/a/_table/t1/2", "",
+		http.StatusNotFound)
+
+	// a snapshot of one database can be restored into another.
+	backupCall(cx, ws, http.MethodPost, "/db/b/_admin/restore",
+		`{"name":"` + info.Name + `"}`, http.StatusOK)
+	backupCall(cx, ws, http.MethodGet, "/db/b/_table/t1/1", "",
+		http.StatusOK)
+
+	backupCall(cx, ws, http.MethodPost, "/db/a/_admin/restore",
+		`{"name":"../x.db"}`, http.StatusUnprocessableEntity)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_admin/restore",
+		`{"name":"nosuch.db"}`, http.StatusNotFound)
+
+	// a streamed snapshot's temporary file is removed after.
+	defer func(saved string) { os.Setenv("TMPDIR", saved) }(os.Getenv("TMPDIR")) // nolint
+	tmpDir := filepath.Join(dir, "tmp")
+	_ = os.Mkdir(tmpDir, 0750)
+	_ = os.Setenv("TMPDIR", tmpDir)
+	w = backupCall(cx, ws, http.MethodPost, "/db/a/_admin/backup?stream=true",
+		"", http.StatusOK)
+	cx.assertEqual(snapshotType, w.Header().Get("Content-Type"),
+		"streamed content type")
+	cx.assertEqual(strconv.Itoa(w.Body.Len()),
+		w.Header().Get("Content-Length"), "streamed content length")
+	cx.assertTrue(strings.HasPrefix(w.Body.String(), "SQLite format 3"),
+		"streamed snapshot")
+	files, _ := ioutil.ReadDir(tmpDir)
+	cx.assertEqual(0, len(files), "temporary snapshot removed")
+	backupCall(cx, ws, http.MethodPost, "/db/a/_admin/backup?stream=maybe",
+		"", http.StatusBadRequest)
+}
+
+// a request using the database when it is restored finishes on the
+// old handle, which is closed only when the request releases it.
+func Test_restoreDrain(t *testing.T) {
+	cx := newTestContext(t)
+	reg, cleanup := mkTempDbs()
+	defer cleanup()
+	defer func(saved *dbRegistry) { dbs = saved }(dbs)
+	dbs = reg
+	dir, _ := ioutil.TempDir("", "backup-test")
+	defer os.RemoveAll(dir) // nolint
+	defer func(saved string) { backupDir = saved }(backupDir)
+	backupDir = filepath.Join(dir, "backups")
+
+	ws := newApiWiring("", apiTable, defaultMiddleware...)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_schema/t1",
+		`{"fields":[{"name":"id","properties":["is_primary_key"]},{"name":"name"}]}`,
+		http.StatusCreated)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_table/t1",
+		`{"records":[{"keys":["name"],"values":["x"]},{"keys":["name"],"values":["y"]}]}`,
+		http.StatusCreated)
+	w := backupCall(cx, ws, http.MethodPost, "/db/a/_admin/backup", "",
+		http.StatusCreated)
+	info := BackupResponse{}
+	_ = json.Unmarshal(w.Body.Bytes(), &info)
+
+	// an in-flight request, in the middle of reading its results.
+	old, err := acquireDb("a")
+	if !cx.assertErrorNil(err, "acquireDb") {
+		return
+	}
+	rows, err := old.handle.Query("select name from t1 order by id")
+	if !cx.assertErrorNil(err, "query") {
+		return
+	}
+	cx.assertTrue(rows.Next(), "first row")
+
+	backupCall(cx, ws, http.MethodPost, "/db/a/_admin/restore",
+		`{"name":"` + info.Name + `"}`, http.StatusOK)
+	cur, _ := dbs.get("a")
+	cx.assertTrue(cur.handle != old.handle, "handle replaced")
+
+	cx.assertTrue(rows.Next(), "second row after restore")
+	var name string
+	cx.assertErrorNil(rows.Scan(&name), "scan after restore")
+	cx.assertEqual("y", name, "second row")
+	cx.assertErrorNil(rows.Close(), "close rows")
+	cx.assertErrorNil(old.handle.Ping(), "old handle open while in use")
+
+	old.release()
+	cx.assertTrue(old.handle.Ping() != nil, "old handle closed after release")
+	backupCall(cx, ws, http.MethodGet, "/db/a/_table/t1/2", "",
+		http.StatusOK)
+}
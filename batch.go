@@ -0,0 +1,241 @@
+package apidCRUD
+
+// this module implements the guts of the runDbBatch API,
+// which runs an ordered list of record operations, possibly
+// on several tables, as a single all-or-nothing transaction.
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// batchRefKey is the key of a json object that stands for the id
+// created by an earlier create operation in the same batch.
+const batchRefKey = "$ref"
+
+// batchOpFunc is the type of a function that runs one kind of batch operation.
+type batchOpFunc func(tx recordStore,
+	self string,
+	params map[string]string,
+	rec KVRecord) (BatchResult, error)
+
+// batchOps maps each batch operation name to the function that runs it.
+var batchOps = map[string]batchOpFunc{
+	"create": batchCreate,
+	"update": batchUpdate,
+	"delete": batchDelete,
+	"get":    batchGet,
+}
+
+// runBatch() runs the given operations in order, as a single transaction.
+// self is the prefix used to construct the self property of retrieved records.
+// if any operation fails, the whole batch is rolled back, and the error
+// identifies the failing operation.
+func runBatch(db dbType,
+	self string,
+	ops []BatchOperation) ([]BatchResult, error) {
+	if len(ops) > maxRecs {
+		return nil, fmt.Errorf("batch: too many operations (max %d)",
+			maxRecs)
+	}
+
+	results := make([]BatchResult, 0, len(ops))
+	err := db.storage().Transact(func(tx recordStore) error {
+		for i, op := range ops {
+			res, err := runBatchOp(tx, self, op, results)
+			if err != nil {
+				return annotateError(err, fmt.Sprintf(
+					"batch operation %d (%s)", i, op.Op))
+			}
+			results = append(results, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// runBatchOp() validates and runs one batch operation.
+// results holds the results of the operations that preceded this one.
+func runBatchOp(tx recordStore,
+	self string,
+	op BatchOperation,
+	results []BatchResult) (BatchResult, error) {
+	opFunc, ok := batchOps[op.Op]
+	if !ok {
+		return BatchResult{}, fmt.Errorf("unknown operation")
+	}
+
+	params, err := batchParams(op, results)
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	values, err := resolveBatchValues(op.Record.Values, results)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	rec := KVRecord{Keys: op.Record.Keys, Values: values}
+
+	res, err := opFunc(tx, self+"/"+params["table_name"], params, rec)
+	res.Op = op.Op
+	res.Kind = "BatchResult"
+	return res, err
+}
+
+// batchParams() returns the validated parameters of the given operation,
+// in the same form as returned by fetchParams().
+func batchParams(op BatchOperation,
+	results []BatchResult) (map[string]string, error) {
+	params := map[string]string{}
+	var err error
+
+	params["table_name"], err = validate_table_name(op.Table)
+	if err != nil {
+		return params, err
+	}
+	params["id_field"], err = validate_id_field(op.IdField)
+	if err != nil {
+		return params, err
+	}
+	params["fields"], err = validate_fields(op.Fields)
+	if err != nil {
+		return params, err
+	}
+	if op.Id != nil {
+		params["id"], err = resolveBatchId(op.Id, results)
+		if err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+// resolveBatchRef() returns the given value, unless it is a reference
+// object, in which case the referenced id is returned instead.
+func resolveBatchRef(val interface{},
+	results []BatchResult) (interface{}, error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return val, nil
+	}
+	ref, ok := obj[batchRefKey].(float64)
+	if !ok || len(obj) != 1 {
+		return val, fmt.Errorf("invalid value object")
+	}
+	n := int(ref)
+	if float64(n) != ref || n < 0 || n >= len(results) {
+		return val, fmt.Errorf("invalid reference %v", ref)
+	}
+	if len(results[n].Ids) != 1 {
+		return val, fmt.Errorf("operation %d did not create a record", n)
+	}
+	return results[n].Ids[0], nil
+}
+
+// resolveBatchValues() returns a copy of the given values,
+// with any reference objects replaced by their referenced ids.
+func resolveBatchValues(values []interface{},
+	results []BatchResult) ([]interface{}, error) {
+	ret := make([]interface{}, len(values))
+	for i, v := range values {
+		rv, err := resolveBatchRef(v, results)
+		if err != nil {
+			return ret, err
+		}
+		ret[i] = rv
+	}
+	return ret, nil
+}
+
+// resolveBatchId() converts the Id of a batch operation,
+// which may be a number, a string, or a reference object,
+// to a validated id string.
+func resolveBatchId(val interface{}, results []BatchResult) (string, error) {
+	rv, err := resolveBatchRef(val, results)
+	if err != nil {
+		return "", err
+	}
+	switch rv := rv.(type) {
+	case int64:
+		return idTypeToA(rv), nil
+	case float64:
+		return validate_id(strconv.FormatFloat(rv, 'f', -1, 64))
+	case string:
+		return validate_id(rv)
+	default:
+		return "", fmt.Errorf("invalid id %v", rv)
+	}
+}
+
+// batchCreate() runs a batch create operation.
+func batchCreate(tx recordStore,
+	self string,
+	params map[string]string,
+	rec KVRecord) (BatchResult, error) {
+	if len(rec.Keys) == 0 {
+		return BatchResult{}, validationError(
+			fmt.Errorf("create: record has no keys"))
+	}
+	err := validateRecords([]KVRecord{rec})
+	if err != nil {
+		return BatchResult{}, err
+	}
+	id, err := tx.Insert(params["table_name"], rec)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	return BatchResult{Ids: []int64{int64(id)}}, nil
+}
+
+// batchUpdate() runs a batch update operation.
+func batchUpdate(tx recordStore,
+	self string,
+	params map[string]string,
+	rec KVRecord) (BatchResult, error) {
+	if _, ok := params["id"]; !ok {
+		return BatchResult{}, fmt.Errorf("update must specify id")
+	}
+	err := validateRecords([]KVRecord{rec})
+	if err != nil {
+		return BatchResult{}, err
+	}
+	nc, err := updateRec(tx, params, rec)
+	if err == nil && nc == 0 {
+		err = notFoundError(fmt.Errorf("no matching record"))
+	}
+	return BatchResult{NumChanged: int64(nc)}, err
+}
+
+// batchDelete() runs a batch delete operation.
+func batchDelete(tx recordStore,
+	self string,
+	params map[string]string,
+	rec KVRecord) (BatchResult, error) {
+	if _, ok := params["id"]; !ok {
+		return BatchResult{}, fmt.Errorf("delete must specify id")
+	}
+	nc, err := delRecs(tx, params)
+	return BatchResult{NumChanged: int64(nc)}, err
+}
+
+// batchGet() runs a batch get operation.
+func batchGet(tx recordStore,
+	self string,
+	params map[string]string,
+	rec KVRecord) (BatchResult, error) {
+	q := newRecordQuery(params)
+	q.self = self
+	q.limit = maxRecs
+	result, err := tx.Select(q)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	if len(result) == 0 {
+		return BatchResult{}, notFoundError(
+			fmt.Errorf("no matching record"))
+	}
+	return BatchResult{Records: result}, nil
+}
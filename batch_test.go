@@ -0,0 +1,79 @@
+package apidCRUD
+
+import (
+	"testing"
+	"encoding/json"
+)
+
+// ----- unit tests for resolveBatchId().
+
+// results of earlier operations, as seen by resolveBatchId testcases.
+var resolveBatchId_Results = []BatchResult {
+	{Op: "create", Ids: []int64{17}},
+	{Op: "update", NumChanged: 1},
+}
+
+// inputs and outputs for one resolveBatchId testcase.
+type resolveBatchId_TC struct {
+	arg string
+	xres string
+	xsucc bool
+}
+
+// table of resolveBatchId testcases.
+var resolveBatchId_Tab = []resolveBatchId_TC {
+	{ `5`, "5", true },
+	{ `"6"`, "6", true },
+	{ `1.5`, "", false },
+	{ `"abc"`, "", false },
+	{ `true`, "", false },
+	{ `{"$ref":0}`, "17", true },
+	{ `{"$ref":1}`, "", false },	// not a create
+	{ `{"$ref":2}`, "", false },	// out of range
+	{ `{"$ref":-1}`, "", false },
+	{ `{"$ref":0.5}`, "", false },
+	{ `{"$ref":"0"}`, "", false },
+	{ `{"$ref":0,"x":1}`, "", false },
+	{ `{}`, "", false },
+}
+
+// run one testcase for function resolveBatchId.
+func resolveBatchId_Checker(cx *testContext, tc *resolveBatchId_TC) {
+	var val interface{}
+	err := json.Unmarshal([]byte(tc.arg), &val)
+	if !cx.assertErrorNil(err, "json.Unmarshal") {
+		return
+	}
+	res, err := resolveBatchId(val, resolveBatchId_Results)
+	if !cx.assertEqual(tc.xsucc, err == nil, "success") {
+		return
+	}
+	if err == nil {
+		cx.assertEqual(tc.xres, res, "result")
+	}
+}
+
+// the resolveBatchId test suite.  run all resolveBatchId testcases.
+func Test_resolveBatchId(t *testing.T) {
+	cx := newTestContext(t, "resolveBatchId_Tab")
+	for _, tc := range resolveBatchId_Tab {
+		resolveBatchId_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for runBatch()
+
+// runBatch() is pretty well tested thru API test cases.
+// this test is only to exercise error conditions
+// which can't be easily reproduced thru the API.
+func Test_runBatch(t *testing.T) {
+	cx := newTestContext(t)
+	ops := []BatchOperation{{Op: "get", Table: "bundles"}}
+	_, err := runBatch(mkBadDb(), "", ops)
+	cx.assertTrue(err != nil, "expected error from bad db")
+
+	ops = make([]BatchOperation, maxRecs+1)
+	_, err = runBatch(db, "", ops)
+	cx.assertTrue(err != nil, "expected error from too many operations")
+}
@@ -0,0 +1,116 @@
+package apidCRUD
+
+// this module maintains the schema of the internal catalog,
+// i.e. the table of tables.  the version of the catalog schema
+// is kept in a row of the catalog's own table, catalogMetaTable,
+// rather than in the database's user_version, which belongs to
+// whatever else uses the database.  a database without that row
+// is at version 0.  at startup, any migrations newer than that
+// version are applied in order, each in its own transaction along
+// with its version update.
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// catalogMigration upgrades the catalog schema by one version.
+type catalogMigration func(tx sqlRunner) error
+
+// catalogVersionKey is the name of the row of catalogMetaTable
+// that holds the version of the catalog schema.
+const catalogVersionKey = "catalog_version"
+
+// catalogMigrations lists the migrations in order.
+// catalogMigrations[i] upgrades the catalog from version i to i+1.
+// append new migrations here; never change or remove old ones.
+var catalogMigrations = []catalogMigration{
+	// version 1: create the table of tables.  it may already exist,
+	// in databases set up before the catalog was versioned, or
+	// versioned in user_version.
+	func(tx sqlRunner) error {
+		_, err := tx.Exec(fmt.Sprintf(`create table if not exists %s
+			(id integer not null primary key autoincrement,
+			name text unique not null,
+			schema text not null)`, sqliteDialect{}.quote(tableOfTables)))
+		return err
+	},
+}
+
+// catalogVersion is the version of the catalog schema
+// required by this code.
+var catalogVersion = len(catalogMigrations)
+
+// getCatalogVersion() returns the version of the catalog schema
+// recorded in the database, or 0 if none is.
+func getCatalogVersion(db dbType) (int, error) {
+	var n int
+	err := db.handle.QueryRowContext(db.context(),
+		"select count(*) from sqlite_master where type = 'table' and name = ?",
+		catalogMetaTable).Scan(&n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	var version int
+	err = db.handle.QueryRowContext(db.context(),
+		fmt.Sprintf("select value from %s where name = ?",
+			sqliteDialect{}.quote(catalogMetaTable)),
+		catalogVersionKey).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// setCatalogVersion() records the version of the catalog schema,
+// creating catalogMetaTable if need be.
+func setCatalogVersion(tx sqlRunner, version int) error {
+	qname := sqliteDialect{}.quote(catalogMetaTable)
+	_, err := tx.Exec(fmt.Sprintf(`create table if not exists %s
+		(name text not null primary key,
+		value integer not null)`, qname))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"insert or replace into %s (name, value) values (?, ?)", qname),
+		catalogVersionKey, version)
+	return err
+}
+
+// checkCatalogVersion() returns the version of the catalog schema
+// recorded in the database.  it is an error if the database's catalog
+// is newer than this code.
+func checkCatalogVersion(db dbType) (int, error) {
+	version, err := getCatalogVersion(db)
+	if err == nil && version > catalogVersion {
+		err = fmt.Errorf("catalog version %d is newer than supported (%d)",
+			version, catalogVersion)
+	}
+	return version, err
+}
+
+// migrateCatalog() brings the catalog schema of the given database
+// up to catalogVersion.  it is an error if the database's catalog
+// is newer than this code.
+func migrateCatalog(db dbType) error {
+	version, err := checkCatalogVersion(db)
+	if err != nil {
+		return err
+	}
+	for v := version; v < catalogVersion; v++ {
+		migration := catalogMigrations[v]
+		err = execTx(db, func(tx sqlRunner) error {
+			if err := migration(tx); err != nil {
+				return err
+			}
+			return setCatalogVersion(tx, v+1)
+		})
+		if err != nil {
+			return fmt.Errorf("catalog migration to version %d: %s",
+				v+1, err)
+		}
+		db.log().Infof("catalog migrated to version %d", v+1)
+	}
+	return nil
+}
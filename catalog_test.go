@@ -0,0 +1,157 @@
+package apidCRUD
+
+import (
+	"testing"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ----- databases for unit tests
+
+// tempDbOpts describes the contents of a database made by mkTempDb().
+// the zero value describes an empty database.
+type tempDbOpts struct {
+	catalog bool		// the catalog is created.
+	tables []string		// tables created thru createTable(),
+				// with goldenSchema.  needs catalog.
+	records int		// records inserted in the first table.
+	setup []string		// statements run last.
+}
+
+// mkTempDb() returns a handle on a new database file, with the
+// contents described by opts, and the function that removes it.
+// it panics if the database can't be set up.
+func mkTempDb(opts tempDbOpts) (dbType, func()) {
+	f, _ := ioutil.TempFile("", "catalog-test-*.db")
+	name := f.Name()
+	_ = f.Close()
+	h, _ := sql.Open(dbDriver, name)
+	tdb := dbType{handle: h}
+	cleanup := func() {
+		_ = h.Close()
+		_ = os.Remove(name)
+	}
+	if err := fillTempDb(tdb, opts); err != nil {
+		cleanup()
+		panic(fmt.Sprintf("mkTempDb: %s", err))
+	}
+	return tdb, cleanup
+}
+
+// fillTempDb() sets up the contents of a database made by mkTempDb().
+func fillTempDb(tdb dbType, opts tempDbOpts) error {
+	if opts.catalog {
+		if err := migrateCatalog(tdb); err != nil {
+			return err
+		}
+	}
+	for _, name := range opts.tables {
+		err := createTable(tdb, map[string]string{"table_name": name},
+			goldenSchema)
+		if err != nil {
+			return err
+		}
+	}
+	for i := 0; i < opts.records; i++ {
+		_, err := tdb.storage().Insert(opts.tables[0],
+			KVRecord{Keys: []string{"name"},
+				Values: []interface{}{fmt.Sprintf("r%d", i)}})
+		if err != nil {
+			return err
+		}
+	}
+	for _, stmt := range opts.setup {
+		if _, err := tdb.handle.Exec(stmt); err != nil {
+			return fmt.Errorf("%s: %s", stmt, err)
+		}
+	}
+	return nil
+}
+
+// mkTempDbs() sets up a registry of empty databases named a and b
+// in a temporary directory, plus one named bad that can't be opened,
+// and returns the function that removes them.  the registry opens
+// them when they are used, as it would configured databases.
+func mkTempDbs() (*dbRegistry, func()) {
+	dir, _ := ioutil.TempDir("", "databases-test")
+	reg := newDbRegistry(map[string]string{
+		"a": filepath.Join(dir, "a.db"),
+		"b": filepath.Join(dir, "b.db"),
+		"bad": filepath.Join(dir, "nosuchdir", "bad.db"),
+	})
+	return reg, func() {
+		for _, d := range reg.open {
+			_ = d.handle.Close()
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// catalogVersionSetup() returns the setup statements that record
+// the given catalog version, as migrateCatalog() would.
+func catalogVersionSetup(version int) []string {
+	return []string{
+		`create table if not exists _tables_meta (name text not null primary key, value integer not null)`,
+		fmt.Sprintf(`insert or replace into _tables_meta values ("catalog_version", %d)`,
+			version),
+	}
+}
+
+// ----- unit tests for migrateCatalog()
+
+// inputs and outputs for one migrateCatalog testcase.
+type migrateCatalog_TC struct {
+	setup []string
+	xsucc bool
+}
+
+// table of migrateCatalog testcases.
+var migrateCatalog_Tab = []migrateCatalog_TC {
+	// a new database.
+	{ []string{}, true },
+	// a database whose catalog was created before versioning.
+	{ []string{`create table _tables_ (id integer not null primary key autoincrement, name text unique not null, schema text not null)`,
+		`insert into _tables_ (name, schema) values ("t", "s")`},
+		true },
+	// a database that is already up to date.
+	{ append([]string{`create table _tables_ (id integer not null primary key autoincrement, name text unique not null, schema text not null)`},
+		catalogVersionSetup(catalogVersion)...),
+		true },
+	// a database whose catalog was versioned in user_version.
+	{ []string{`create table _tables_ (id integer not null primary key autoincrement, name text unique not null, schema text not null)`,
+		fmt.Sprintf("pragma user_version = %d", catalogVersion)},
+		true },
+	// a database adopted from an application that uses user_version.
+	{ []string{"create table t (x)", "pragma user_version = 42"},
+		true },
+	// a database from the future.
+	{ catalogVersionSetup(catalogVersion+1), false },
+}
+
+// run one testcase for function migrateCatalog.
+func migrateCatalog_Checker(cx *testContext, tc *migrateCatalog_TC) {
+	tdb, cleanup := mkTempDb(tempDbOpts{setup: tc.setup})
+	defer cleanup()
+	err := migrateCatalog(tdb)
+	if !cx.assertEqual(tc.xsucc, err == nil, "success") || err != nil {
+		return
+	}
+	version, _ := getCatalogVersion(tdb)
+	cx.assertEqual(catalogVersion, version, "version")
+	cx.assertErrorNil(checkCatalog(tdb), "checkCatalog")
+
+	// a second migration is a no-op.
+	cx.assertErrorNil(migrateCatalog(tdb), "second migrateCatalog")
+}
+
+// the migrateCatalog test suite.  run all migrateCatalog testcases.
+func Test_migrateCatalog(t *testing.T) {
+	cx := newTestContext(t, "migrateCatalog_Tab")
+	for _, tc := range migrateCatalog_Tab {
+		migrateCatalog_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
@@ -0,0 +1,78 @@
+// package main in dbdump dumps an apidCRUD database to a file,
+// or loads a dump into one, without a running apid.
+// the dump is the same as that of the getDbDump API.
+//
+//	usage: dbdump [-ndjson] [-load] DBFILE [DUMPFILE]
+//
+// the dump is written to (or, with -load, read from) DUMPFILE,
+// or the standard output (or input) if none is given.
+// the database is opened with the apidCRUD settings in apid's config.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apid/apid-core"
+	"github.com/apid/apid-core/factory"
+	"github.com/apid/apidCRUD"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		"usage: %s [-ndjson] [-load] DBFILE [DUMPFILE]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// run() does the dump or load, and returns a message for the user.
+func run(load bool, ndjson bool, dbName string, dumpName string) (string, error) {
+	if load {
+		var in io.Reader = os.Stdin
+		if dumpName != "" {
+			f, err := os.Open(dumpName)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close() // nolint
+			in = f
+		}
+		n, err := apidCRUD.LoadDatabase(dbName, in, ndjson)
+		return fmt.Sprintf("loaded %d records into %s", n, dbName), err
+	}
+
+	if dumpName == "" {
+		return "", apidCRUD.DumpDatabase(dbName, os.Stdout, ndjson)
+	}
+	f, err := os.Create(dumpName)
+	if err != nil {
+		return "", err
+	}
+	err = apidCRUD.DumpDatabase(dbName, f, ndjson)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return fmt.Sprintf("dumped %s to %s", dbName, dumpName), err
+}
+
+func main() {
+	ndjson := flag.Bool("ndjson", false, "the dump is in NDJSON")
+	load := flag.Bool("load", false, "load the dump into the database")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		usage()
+	}
+
+	apid.Initialize(factory.DefaultServicesFactory())
+	msg, err := run(*load, *ndjson, flag.Arg(0), flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
@@ -128,8 +128,13 @@ func emitApiTable(cont []byte) {
 			if method == "" {
 				continue
 			}
-			handler := strcon(m3["operationId"]) + "Handler"
-			fmt.Printf("\t{\"%s\", %s, %s},\n",
+			// x-handler names the handler of an operation
+			// that shares it with another operation.
+			handler := strcon(m3["x-handler"])
+			if handler == "" {
+				handler = strcon(m3["operationId"]) + "Handler"
+			}
+			fmt.Printf("\t{\"%s\", %s, %s, nil},\n",
 				path, method, handler)
 		}
 	}
@@ -0,0 +1,115 @@
+package apidCRUD
+
+// this module implements CORS (cross-origin resource sharing)
+// for the wiring layer, controlled by the apidCRUD_cors_* config
+// variables.  see https://fetch.spec.whatwg.org/#http-cors-protocol .
+
+import (
+	"net/http"
+	"strings"
+)
+
+// splitList() splits a comma-separated config value into its
+// trimmed, non-empty items.
+func splitList(val string) []string {
+	ret := []string{}
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// corsOriginListed() returns true iff the given origin, or
+// if origin is "*", the wildcard, is in the allowed origins.
+func corsOriginListed(origin string) bool {
+	for _, allowed := range splitList(corsOrigins) {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsOriginAllowed() returns true iff the given origin
+// may make cross-origin requests.
+func corsOriginAllowed(origin string) bool {
+	return corsOriginListed("*") || corsOriginListed(origin)
+}
+
+// corsAllowOrigin() returns the value of the
+// Access-Control-Allow-Origin header for an allowed origin.
+// an origin listed by name is echoed if credentials are allowed,
+// since a wildcard can't be combined with credentials.  an origin
+// allowed only by the wildcard gets the wildcard, and so can't
+// make requests with credentials.
+func corsAllowOrigin(origin string) string {
+	if corsCredentials && corsOriginListed(origin) {
+		return origin
+	}
+	if corsOriginListed("*") {
+		return "*"
+	}
+	return origin
+}
+
+// corsAllowMethods() returns the value of the
+// Access-Control-Allow-Methods header for the given verbMap.
+// if no methods are configured, all methods allowed on
+// the path are allowed.
+func corsAllowMethods(vmap verbMap) string {
+	if corsMethods != "" {
+		return strings.Join(splitList(corsMethods), ",")
+	}
+	return strings.Join(allowedMethods(vmap), ",")
+}
+
+// corsAllowHeaders() returns the value of the
+// Access-Control-Allow-Headers header.  if no headers are
+// configured, the headers requested in the preflight are allowed.
+func corsAllowHeaders(req *http.Request) string {
+	if corsHeaders != "" {
+		return strings.Join(splitList(corsHeaders), ",")
+	}
+	return req.Header.Get("Access-Control-Request-Headers")
+}
+
+// applyCors() adds the CORS response headers for the given request
+// on the given verbMap.  if the request is a CORS preflight, it is
+// answered completely, and the return value is true.
+// requests with no Origin, or from an origin that is not allowed,
+// get no CORS headers; the browser will then refuse them.
+func applyCors(w http.ResponseWriter, req *http.Request, vmap verbMap) bool {
+	hdr := w.Header()
+	origin := req.Header.Get("Origin")
+	if origin == "" || !corsOriginAllowed(origin) {
+		return false
+	}
+
+	allowOrigin := corsAllowOrigin(origin)
+	hdr.Set("Access-Control-Allow-Origin", allowOrigin)
+	if allowOrigin != "*" {
+		hdr.Add("Vary", "Origin")
+	}
+	if corsCredentials && allowOrigin != "*" {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if req.Method != http.MethodOptions ||
+			req.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	// preflight request.
+	hdr.Set("Access-Control-Allow-Methods", corsAllowMethods(vmap))
+	if headers := corsAllowHeaders(req); headers != "" {
+		hdr.Set("Access-Control-Allow-Headers", headers)
+	}
+	if corsMaxAge != "" {
+		hdr.Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
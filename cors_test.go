@@ -0,0 +1,157 @@
+package apidCRUD
+
+import (
+	"testing"
+	"strings"
+	"net/http"
+	"net/http/httptest"
+)
+
+// ----- unit tests for applyCors(), with the origins configured
+// in utConfData.
+
+// inputs and outputs for one applyCors testcase.
+type applyCors_TC struct {
+	verb string
+	path string
+	reqHeaders map[string]string
+	xcode int
+	xheaders map[string]string
+}
+
+const corsTestOrigin = "https://admin.example.com"
+
+// table of applyCors testcases.
+var applyCors_Tab = []applyCors_TC {
+	// not a cross-origin request.
+	{ http.MethodGet, "/abc", map[string]string{},
+		abcGetRet,
+		map[string]string{"Access-Control-Allow-Origin": ""} },
+	// origin not allowed.
+	{ http.MethodGet, "/abc",
+		map[string]string{"Origin": "https://evil.example.com"},
+		abcGetRet,
+		map[string]string{"Access-Control-Allow-Origin": ""} },
+	// simple request from an allowed origin.
+	{ http.MethodGet, "/abc",
+		map[string]string{"Origin": corsTestOrigin},
+		abcGetRet,
+		map[string]string{
+			"Access-Control-Allow-Origin": corsTestOrigin,
+			"Access-Control-Allow-Credentials": "",
+			"Access-Control-Allow-Methods": "",
+			"Vary": "Origin"} },
+	// preflight from an allowed origin.
+	{ http.MethodOptions, "/abc",
+		map[string]string{"Origin": "https://ops.example.com",
+			"Access-Control-Request-Method": http.MethodPost,
+			"Access-Control-Request-Headers": "X-Junk"},
+		http.StatusNoContent,
+		map[string]string{
+			"Access-Control-Allow-Origin": "https://ops.example.com",
+			"Access-Control-Allow-Methods": "GET,HEAD,OPTIONS,POST",
+			"Access-Control-Allow-Headers": "Accept,Content-Type",
+			"Access-Control-Max-Age": "600",
+			"Allow": ""} },
+	// plain OPTIONS from an allowed origin is not a preflight.
+	{ http.MethodOptions, "/pqr",
+		map[string]string{"Origin": corsTestOrigin},
+		http.StatusNoContent,
+		map[string]string{
+			"Access-Control-Allow-Origin": corsTestOrigin,
+			"Access-Control-Allow-Methods": "",
+			"Allow": "OPTIONS,PATCH"} },
+}
+
+// run one testcase for function applyCors.
+func applyCors_Checker(cx *testContext, ws *apiWiring, tc *applyCors_TC) {
+	r, _ := http.NewRequest(tc.verb, tc.path, strings.NewReader(""))
+	for name, val := range tc.reqHeaders {
+		r.Header.Set(name, val)
+	}
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	if !cx.assertEqual(tc.xcode, w.Code, "returned code") {
+		return
+	}
+	for name, xval := range tc.xheaders {
+		cx.assertEqual(xval, w.Header().Get(name), name)
+	}
+}
+
+// the applyCors test suite.  run all applyCors testcases.
+func Test_applyCors(t *testing.T) {
+	cx := newTestContext(t, "applyCors_Tab")
+	ws := newApiWiring("", fakeApiTable)
+	for _, tc := range applyCors_Tab {
+		applyCors_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for corsAllowOrigin()
+
+func Test_corsAllowOrigin(t *testing.T) {
+	cx := newTestContext(t)
+	saveOrigins, saveCreds := corsOrigins, corsCredentials
+	defer func() {
+		corsOrigins, corsCredentials = saveOrigins, saveCreds
+	}()
+
+	corsOrigins = "*"
+	corsCredentials = false
+	cx.assertEqual("*", corsAllowOrigin(corsTestOrigin), "wildcard")
+	cx.bump()
+	corsCredentials = true
+	cx.assertEqual("*", corsAllowOrigin(corsTestOrigin),
+		"wildcard with credentials")
+	cx.bump()
+	corsOrigins = "*, " + corsTestOrigin
+	cx.assertEqual(corsTestOrigin, corsAllowOrigin(corsTestOrigin),
+		"listed origin with credentials")
+	cx.bump()
+	cx.assertEqual("*", corsAllowOrigin("https://evil.example.com"),
+		"unlisted origin with credentials")
+}
+
+// ----- unit tests for applyCors() with credentials
+
+func Test_applyCors_credentials(t *testing.T) {
+	cx := newTestContext(t)
+	saveOrigins, saveCreds := corsOrigins, corsCredentials
+	defer func() {
+		corsOrigins, corsCredentials = saveOrigins, saveCreds
+	}()
+	corsOrigins = "*, " + corsTestOrigin
+	corsCredentials = true
+	ws := newApiWiring("", fakeApiTable)
+
+	for _, tc := range []applyCors_TC {
+		{ http.MethodGet, "/abc",
+			map[string]string{"Origin": corsTestOrigin},
+			abcGetRet,
+			map[string]string{
+				"Access-Control-Allow-Origin": corsTestOrigin,
+				"Access-Control-Allow-Credentials": "true",
+				"Vary": "Origin"} },
+		{ http.MethodGet, "/abc",
+			map[string]string{"Origin": "https://evil.example.com"},
+			abcGetRet,
+			map[string]string{
+				"Access-Control-Allow-Origin": "*",
+				"Access-Control-Allow-Credentials": "",
+				"Vary": ""} },
+	} {
+		applyCors_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for splitList()
+
+func Test_splitList(t *testing.T) {
+	cx := newTestContext(t)
+	cx.assertEqualObj([]string{"a", "b"}, splitList(" a, ,b,"), "result")
+	cx.bump()
+	cx.assertEqualObj([]string{}, splitList(""), "empty")
+}
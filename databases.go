@@ -0,0 +1,281 @@
+package apidCRUD
+
+// this module implements the registry of named databases.
+// besides the default database, served under /db, each database
+// named in apidCRUD_databases is served under /db/{db_name}.
+// a named database is opened on its first use, with the same driver
+// as the default database, and has its own file and catalog.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dbRegistry holds the named databases.
+type dbRegistry struct {
+	lock sync.Mutex
+	dbNames map[string]string	// the dbName of each database, by name.
+	open map[string]dbType		// the databases opened so far.
+}
+
+// dbKey is the context key of the database a request is bound to.
+const dbKey ctxKey = 1
+
+// newDbRegistry() returns a registry of the databases
+// whose dbNames are given by name.
+func newDbRegistry(dbNames map[string]string) *dbRegistry {
+	return &dbRegistry{
+		dbNames: dbNames,
+		open: map[string]dbType{},
+	}
+}
+
+// parseDatabases() parses the value of apidCRUD_databases,
+// a comma-separated list of name=dbname pairs.
+// no two databases, including the default one, may share a dbname.
+func parseDatabases(conf string) (map[string]string, error) {
+	ret := map[string]string{}
+	owner := map[string]string{dbName: "the default database"}
+	for _, pair := range strings.Split(conf, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		words := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(words[0])
+		if _, err := validate_db_name(name); err != nil {
+			return nil, err
+		}
+		if len(words) < 2 || strings.TrimSpace(words[1]) == "" {
+			return nil, fmt.Errorf("database %s: no dbname", name)
+		}
+		source := strings.TrimSpace(words[1])
+		if _, ok := ret[name]; ok {
+			return nil, fmt.Errorf("database %s: named more than once",
+				name)
+		}
+		if other, ok := owner[source]; ok {
+			return nil, fmt.Errorf("database %s: %s is used by %s",
+				name, source, other)
+		}
+		ret[name] = source
+		owner[source] = "database " + name
+	}
+	return ret, nil
+}
+
+// names() returns the sorted names of the databases in the registry.
+func (r *dbRegistry) names() []string {
+	ret := make([]string, 0, len(r.dbNames))
+	for name := range r.dbNames {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// get() returns the named database, opening it if need be.
+// it returns a notFoundError if there is no such database,
+// or an unavailableError if it can't be opened.
+// a database that fails to open is tried again on the next call.
+func (r *dbRegistry) get(name string) (dbType, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lookup(name)
+}
+
+// acquire() returns the named database, as get() does,
+// counted as in use until it is released.
+func (r *dbRegistry) acquire(name string) (dbType, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	d, err := r.lookup(name)
+	if err == nil {
+		d.acquire()
+	}
+	return d, err
+}
+
+// lookup() is get(), called with r.lock held.
+func (r *dbRegistry) lookup(name string) (dbType, error) {
+	if d, ok := r.open[name]; ok {
+		return d, nil
+	}
+	source, ok := r.dbNames[name]
+	if !ok {
+		return dbType{}, notFoundError(
+			fmt.Errorf("no database %s", name))
+	}
+	d, err := initDB(source)
+	if err != nil {
+		if d.handle != nil {
+			_ = d.handle.Close()
+		}
+		return dbType{}, unavailableError(err)
+	}
+	d.name = name
+	r.open[name] = d
+	return d, nil
+}
+
+// path() returns the path, below basePath, of the given API
+// of the database.
+func (d dbType) path(api string) string {
+	if d.name == "" {
+		return "/db/" + api
+	}
+	return "/db/" + d.name + "/" + api
+}
+
+// dbLock guards the global db, which a restore replaces.
+var dbLock sync.RWMutex
+
+// defaultDb() returns the default database.
+func defaultDb() dbType {
+	dbLock.RLock()
+	defer dbLock.RUnlock()
+	return db
+}
+
+// currentDb() returns the named database, or the default database
+// if name is empty.
+func currentDb(name string) (dbType, error) {
+	if name == "" {
+		return defaultDb(), nil
+	}
+	return dbs.get(name)
+}
+
+// dbSource() returns the dbName from which the named database,
+// or the default database if name is empty, is opened.
+func dbSource(name string) string {
+	if name == "" {
+		return dbName
+	}
+	return dbs.dbNames[name]
+}
+
+// acquireDb() returns the named database, or the default database
+// if name is empty, counted as in use until it is released.
+// a request uses the database it acquired until it finishes,
+// even if a restore replaces it meanwhile.
+func acquireDb(name string) (dbType, error) {
+	if name == "" {
+		dbLock.RLock()
+		defer dbLock.RUnlock()
+		db.acquire()
+		return db, nil
+	}
+	return dbs.acquire(name)
+}
+
+// dbRefs counts the users of a database, so that a database
+// replaced by a restore is closed only after they finish.
+// it must be accessed with lock held.
+type dbRefs struct {
+	lock sync.Mutex
+	n int
+	retired bool
+}
+
+// acquire() counts a new user of the database.
+func (d dbType) acquire() {
+	if d.refs == nil {
+		return
+	}
+	d.refs.lock.Lock()
+	defer d.refs.lock.Unlock()
+	d.refs.n++
+}
+
+// release() ends a use of the database counted by acquire().
+// the last user of a retired database closes it.
+func (d dbType) release() {
+	if d.refs == nil {
+		return
+	}
+	d.refs.lock.Lock()
+	defer d.refs.lock.Unlock()
+	d.refs.n--
+	if d.refs.retired && d.refs.n == 0 {
+		d.close()
+	}
+}
+
+// retire() closes the database once it has no users.
+// it must have been replaced, so that it gets no new ones.
+func (d dbType) retire() {
+	if d.refs == nil {
+		d.close()
+		return
+	}
+	d.refs.lock.Lock()
+	defer d.refs.lock.Unlock()
+	d.refs.retired = true
+	if d.refs.n == 0 {
+		d.close()
+	}
+}
+
+// close() closes the database's handle, if it has one.
+func (d dbType) close() {
+	if d.handle != nil {
+		_ = d.handle.Close()
+	}
+}
+
+// replaceDb() makes the given database the one used by later
+// requests in place of the database of the same name.
+func replaceDb(d dbType) {
+	if d.name == "" {
+		dbLock.Lock()
+		defer dbLock.Unlock()
+		db = d
+		return
+	}
+	dbs.lock.Lock()
+	defer dbs.lock.Unlock()
+	dbs.open[d.name] = d
+}
+
+// withDb() returns a copy of the context, bound to the given database.
+func withDb(ctx context.Context, d dbType) context.Context {
+	return context.WithValue(ctx, dbKey, d)
+}
+
+// ctxDb() returns the database the given context is bound to,
+// or the default database if none.
+func ctxDb(ctx context.Context) dbType {
+	if d, ok := ctx.Value(dbKey).(dbType); ok {
+		return d
+	}
+	return defaultDb()
+}
+
+// dbMiddleware() binds the request to the database named by its
+// db_name path parameter, or to the default database if it has none,
+// so that harg.db() returns that database.  a named database is
+// opened on its first use.  the database is in use until the
+// request finishes; see acquireDb().
+func dbMiddleware(next apiHandler) apiHandler {
+	return func(harg *apiHandlerArg) apiHandlerRet {
+		name := ""
+		if _, ok := harg.pathParams["db_name"]; ok {
+			var err error
+			name, err = harg.getParam("db_name")
+			if err != nil {
+				return errorRet(badStat, err, "after getParam")
+			}
+		}
+		d, err := acquireDb(name)
+		if err != nil {
+			return errorRet(badStat, err, "after acquireDb")
+		}
+		defer d.release()
+		harg.req = harg.req.WithContext(withDb(harg.req.Context(), d))
+		return next(harg)
+	}
+}
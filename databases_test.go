@@ -0,0 +1,147 @@
+package apidCRUD
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+)
+
+// ----- unit tests for parseDatabases()
+
+// inputs and outputs for one parseDatabases testcase.
+type parseDatabases_TC struct {
+	conf string
+	xres string
+	xsucc bool
+}
+
+// table of parseDatabases testcases.
+var parseDatabases_Tab = []parseDatabases_TC {
+	{ "", "", true },
+	{ "a=a.db, b = b.db ,", "a=a.db,b=b.db", true },
+	{ "a", "", false },
+	{ "a=", "", false },
+	{ "_a=a.db", "", false },
+	{ "a-b=a.db", "", false },
+	{ "a=a.db,a=b.db", "", false },
+	{ "a=x.db,b=x.db", "", false },
+	{ "a=" + ut_DBNAME, "", false },
+}
+
+// run one testcase for function parseDatabases.
+func parseDatabases_Checker(cx *testContext, tc *parseDatabases_TC) {
+	res, err := parseDatabases(tc.conf)
+	if !cx.assertEqual(tc.xsucc, err == nil, "succ") || err != nil {
+		return
+	}
+	pairs := []string{}
+	for name, source := range res {
+		pairs = append(pairs, name + "=" + source)
+	}
+	sort.Strings(pairs)
+	cx.assertEqual(tc.xres, strings.Join(pairs, ","), "result")
+}
+
+// the parseDatabases test suite.  run all parseDatabases testcases.
+func Test_parseDatabases(t *testing.T) {
+	cx := newTestContext(t, "parseDatabases_Tab")
+	for _, tc := range parseDatabases_Tab {
+		parseDatabases_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for dbRegistry
+
+func Test_dbRegistry_get(t *testing.T) {
+	cx := newTestContext(t)
+	reg, cleanup := mkTempDbs()
+	defer cleanup()
+
+	cx.assertEqual("a,b,bad", strings.Join(reg.names(), ","), "names")
+
+	_, err := reg.get("nosuch")
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(http.StatusNotFound, code, "unknown database")
+
+	_, err = reg.get("bad")
+	code, _ = classifyError(badStat, err)
+	cx.assertEqual(http.StatusServiceUnavailable, code, "bad database")
+	cx.assertEqual(0, len(reg.open), "bad database not kept")
+
+	a1, err := reg.get("a")
+	cx.assertErrorNil(err, "open a")
+	cx.assertEqual("a", a1.name, "name of a")
+	a2, _ := reg.get("a")
+	cx.assertTrue(a1.handle == a2.handle, "a opened once")
+	cx.assertEqual("/db/a/_table", a1.path("_table"), "path of a")
+	cx.assertEqual("/db/_table", db.path("_table"), "path of default")
+}
+
+// ----- end-to-end tests of named databases
+
+// namedDb_TC is one API call in the named database test.
+// xbody, if not empty, must be contained in the response body.
+type namedDb_TC struct {
+	verb string
+	path string
+	body string
+	xcode int
+	xbody string
+}
+
+// namedDb_Tab is the named database test.  the steps run in order.
+var namedDb_Tab = []namedDb_TC {
+	{ http.MethodPost, "/db/a/_schema/t1",
+		`{"fields":[{"name":"id","properties":["is_primary_key"]},{"name":"name"}]}`,
+		http.StatusCreated, "" },
+	{ http.MethodGet, "/db/a/_table", "",
+		http.StatusOK, `"names":["t1"]` },
+	{ http.MethodGet, "/db/b/_table", "",
+		http.StatusOK, `"names":[]` },
+	{ http.MethodGet, "/db/_schema/t1", "",
+		http.StatusNotFound, "" },
+	{ http.MethodPost, "/db/a/_table/t1",
+		`{"records":[{"keys":["name"],"values":["x"]}]}`,
+		http.StatusCreated, `"ids":[1]` },
+	{ http.MethodGet, "/db/a/_table/t1/1", "",
+		http.StatusOK, `/db/a/_table/t1/1"` },
+	{ http.MethodGet, "/db/b/_table/t1/1", "",
+		http.StatusNotFound, "" },
+	{ http.MethodGet, "/db/nosuch/_table", "",
+		http.StatusNotFound, "no database nosuch" },
+	{ http.MethodGet, "/db/bad/_table", "",
+		http.StatusServiceUnavailable, "" },
+	{ http.MethodGet, "/db/a-b/_table", "",
+		http.StatusBadRequest, "" },
+}
+
+// run one step of the named database test.
+func namedDb_Checker(cx *testContext, ws *apiWiring, tc *namedDb_TC) {
+	r, _ := http.NewRequest(tc.verb, tc.path, strings.NewReader(tc.body))
+	if tc.body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(tc.xcode, w.Code, tc.verb + " " + tc.path)
+	if tc.xbody != "" && !strings.Contains(w.Body.String(), tc.xbody) {
+		cx.Errorf("body %s does not contain %s", w.Body.String(), tc.xbody)
+	}
+}
+
+func Test_namedDatabases(t *testing.T) {
+	cx := newTestContext(t, "namedDb_Tab")
+	reg, cleanup := mkTempDbs()
+	defer cleanup()
+	defer func(saved *dbRegistry) { dbs = saved }(dbs)
+	dbs = reg
+
+	ws := newApiWiring("", apiTable, defaultMiddleware...)
+	for _, tc := range namedDb_Tab {
+		namedDb_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
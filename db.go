@@ -1,11 +1,91 @@
 package apidCRUD
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+
+	"github.com/apid/apid-core"
 )
 
-// initDB opens the named database and returns a handle wrapper.
+// initDB opens the named database, with the backend
+// selected by dbDriver, and returns a handle wrapper.
 func initDB(dbName string) (dbType, error) {
-	h, err := sql.Open(dbDriver, dbName)
-	return dbType{handle: h}, err
+	open, ok := storageDrivers[dbDriver]
+	if !ok {
+		return dbType{}, fmt.Errorf("database %s: unknown driver %s",
+			dbName, dbDriver)
+	}
+	d, err := open(dbName)
+	if err == nil {
+		d.refs = &dbRefs{}
+	}
+	return d, err
+}
+
+// withContext() returns a copy of the handle wrapper whose statements
+// run in the given context, so that they are abandoned if the context
+// is canceled or times out.
+func (d dbType) withContext(ctx context.Context) dbType {
+	return dbType{d.handle, ctx, d.store, d.name, d.refs}
+}
+
+// context() returns the context in which statements are run.
+func (d dbType) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// log() returns the logger for work done in the wrapper's context.
+func (d dbType) log() apid.LogService {
+	return ctxLog(d.context())
+}
+
+// runnerLog() returns the logger for work done on the given sqlRunner.
+func runnerLog(dbh sqlRunner) apid.LogService {
+	if r, ok := dbh.(ctxRunner); ok {
+		return ctxLog(r.ctx)
+	}
+	return log
+}
+
+// runner() returns a sqlRunner for the database,
+// that runs statements in the wrapper's context.
+func (d dbType) runner() sqlRunner {
+	return ctxRunner{d.context(), d.handle}
+}
+
+// ctxSQLRunner is the subset of context-aware methods shared by
+// *sql.DB and *sql.Tx.
+type ctxSQLRunner interface {
+	ExecContext(ctx context.Context, query string,
+		args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string,
+		args ...interface{}) (*sql.Rows, error)
+}
+
+// ctxRunner is a sqlRunner that runs statements on a database
+// or transaction in a given context.
+type ctxRunner struct {
+	ctx context.Context
+	dbh ctxSQLRunner
+}
+
+// Exec() is ExecContext() in the runner's context.
+func (r ctxRunner) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.dbh.ExecContext(r.ctx, query, args...)
+}
+
+// Prepare() is PrepareContext() in the runner's context.
+// note that the context applies to preparing the statement only.
+func (r ctxRunner) Prepare(query string) (*sql.Stmt, error) {
+	return r.dbh.PrepareContext(r.ctx, query)
+}
+
+// Query() is QueryContext() in the runner's context.
+func (r ctxRunner) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.dbh.QueryContext(r.ctx, query, args...)
 }
@@ -3,7 +3,6 @@ package apidCRUD
 import (
 	"fmt"
 	"os"
-	"database/sql"
 )
 
 const ut_DBNAME = "unit-test.db"
@@ -18,8 +17,7 @@ func utInitDB() {
 }
 
 var cmds = []string {
-	// create the special table _tables_
-	`create table _tables_(id integer not null primary key autoincrement, name text unique not null, schema text)`,
+	// the special table _tables_ is created by initDB().
 	`insert into _tables_ (name,schema) values ("bundles", "bundles_schema")`,
 	`insert into _tables_ (name,schema) values ("users", "users_schema")`,
 	`insert into _tables_ (name,schema) values ("nothing", "nothing_schema")`,
@@ -78,7 +76,7 @@ func createDbData(db dbType) {
 // mkBadDb() returns a closed db handle that should cause errors,
 // to facilitate exercising error-handling code.
 func mkBadDb() dbType {
-	h, _ := sql.Open(dbDriver, dbName)
-	_ = h.Close()
-	return dbType{h}
+	tdb, cleanup := mkTempDb(tempDbOpts{})
+	cleanup()	// closes the handle.
+	return tdb
 }
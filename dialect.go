@@ -0,0 +1,236 @@
+package apidCRUD
+
+// this module defines the SQL dialects that the SQL storage code
+// is written in terms of.  a dialect covers the parts of SQL that
+// differ between databases: identifier quoting, placeholders,
+// column types, limits, upserts, and getting the id of an inserted
+// record.
+//
+// only the sqlite dialect is used by a storage backend at present;
+// the catalog and introspection code is still sqlite-specific, and
+// no Postgres or MySQL driver is linked in.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlDialect is the interface to the SQL variant of a database.
+type sqlDialect interface {
+	// quote() quotes a name for use as an SQL identifier.
+	quote(name string) string
+
+	// placeholder() returns the placeholder for the n'th
+	// argument of a statement, counting from 1.
+	placeholder(n int) string
+
+	// columnType() returns the SQL type, with its constraints,
+	// of the column for the given field.
+	columnType(field FieldSchema) string
+
+	// limitClause() returns the clause that limits a select to
+	// limit records, after skipping offset records.
+	// a limit <= 0 is no limit.
+	limitClause(limit, offset int) string
+
+	// upsertClause() returns the clause that makes an insert whose
+	// key already exists update the given fields of that record
+	// instead.  with no fields, the record is left unchanged.
+	upsertClause(key string, fields []string) string
+
+	// returning() returns the clause that makes an insert return
+	// the given id field of the inserted record as a result row.
+	// it is "" if the id is got from sql.Result.LastInsertId().
+	returning(idField string) string
+}
+
+// sqlDialects maps each database/sql driver name to its dialect.
+var sqlDialects = map[string]sqlDialect{
+	"sqlite3": sqliteDialect{},
+	"postgres": postgresDialect{},
+	"mysql": mysqlDialect{},
+}
+
+// dialect() returns the SQL dialect of the database.
+// sqlite is assumed if the driver has no dialect of its own.
+func (d dbType) dialect() sqlDialect {
+	if dl, ok := sqlDialects[dbDriver]; ok {
+		return dl
+	}
+	return sqliteDialect{}
+}
+
+// isPrimaryKey() returns true iff the field is the table's primary key.
+func isPrimaryKey(field FieldSchema) bool {
+	return listToMap(field.Properties)["is_primary_key"] != 0
+}
+
+// quoteWith() quotes a name with the given quote character,
+// which is doubled within the name.
+func quoteWith(q string, name string) string {
+	return q + strings.Replace(name, q, q+q, -1) + q
+}
+
+// ----- sqliteDialect
+
+// sqliteDialect is the dialect of sqlite.
+type sqliteDialect struct{}
+
+// quote() quotes a name for use as an SQL identifier.
+// sqlite takes an unknown name in double quotes to be a string,
+// so that selecting a bogus field would not be an error;
+// a name in backquotes is always an identifier.
+func (sqliteDialect) quote(name string) string {
+	return quoteWith("`", name)
+}
+
+// placeholder() returns the placeholder for an argument.
+func (sqliteDialect) placeholder(n int) string {
+	return "?"
+}
+
+// columnType() returns the SQL type of the column for the given field.
+func (sqliteDialect) columnType(field FieldSchema) string {
+	if isPrimaryKey(field) {
+		return "integer primary key autoincrement"
+	}
+	return "text not null"
+}
+
+// limitClause() returns the clause that limits a select.
+// sqlite needs a limit in order to have an offset.
+func (sqliteDialect) limitClause(limit, offset int) string {
+	if limit <= 0 {
+		if offset <= 0 {
+			return ""
+		}
+		limit = -1
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+// upsertClause() returns the clause that makes an insert an upsert.
+func (d sqliteDialect) upsertClause(key string, fields []string) string {
+	return onConflictClause(d, key, fields)
+}
+
+// returning() returns "", since sqlite reports the last insert id.
+func (sqliteDialect) returning(idField string) string {
+	return ""
+}
+
+// ----- postgresDialect
+
+// postgresDialect is the dialect of Postgres.
+type postgresDialect struct{}
+
+// quote() quotes a name for use as an SQL identifier.
+func (postgresDialect) quote(name string) string {
+	return quoteWith(`"`, name)
+}
+
+// placeholder() returns the placeholder for the n'th argument.
+func (postgresDialect) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// columnType() returns the SQL type of the column for the given field.
+func (postgresDialect) columnType(field FieldSchema) string {
+	if isPrimaryKey(field) {
+		return "bigserial primary key"
+	}
+	return "text not null"
+}
+
+// limitClause() returns the clause that limits a select.
+func (postgresDialect) limitClause(limit, offset int) string {
+	clauses := []string{}
+	if limit > 0 {
+		clauses = append(clauses, fmt.Sprintf("LIMIT %d", limit))
+	}
+	if offset > 0 {
+		clauses = append(clauses, fmt.Sprintf("OFFSET %d", offset))
+	}
+	return strings.Join(clauses, " ")
+}
+
+// upsertClause() returns the clause that makes an insert an upsert.
+func (d postgresDialect) upsertClause(key string, fields []string) string {
+	return onConflictClause(d, key, fields)
+}
+
+// returning() returns the clause that returns the inserted id,
+// since Postgres has no last insert id.
+func (d postgresDialect) returning(idField string) string {
+	return "RETURNING " + d.quote(idField)
+}
+
+// onConflictClause() returns the upsert clause of sqlite and Postgres.
+func onConflictClause(d sqlDialect, key string, fields []string) string {
+	if len(fields) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", d.quote(key))
+	}
+	sets := make([]string, len(fields))
+	for i, f := range fields {
+		sets[i] = fmt.Sprintf("%s = excluded.%s", d.quote(f), d.quote(f))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s",
+		d.quote(key), strings.Join(sets, ", "))
+}
+
+// ----- mysqlDialect
+
+// mysqlDialect is the dialect of MySQL.
+type mysqlDialect struct{}
+
+// quote() quotes a name for use as an SQL identifier.
+func (mysqlDialect) quote(name string) string {
+	return quoteWith("`", name)
+}
+
+// placeholder() returns the placeholder for an argument.
+func (mysqlDialect) placeholder(n int) string {
+	return "?"
+}
+
+// columnType() returns the SQL type of the column for the given field.
+func (mysqlDialect) columnType(field FieldSchema) string {
+	if isPrimaryKey(field) {
+		return "bigint primary key auto_increment"
+	}
+	return "text not null"
+}
+
+// limitClause() returns the clause that limits a select.
+// MySQL needs a limit in order to have an offset;
+// the largest one it allows is used as no limit.
+func (mysqlDialect) limitClause(limit, offset int) string {
+	if limit <= 0 {
+		if offset <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("LIMIT 18446744073709551615 OFFSET %d", offset)
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+// upsertClause() returns the clause that makes an insert an upsert.
+// MySQL applies it to a duplicate of any unique key, not just the
+// given one.
+func (d mysqlDialect) upsertClause(key string, fields []string) string {
+	if len(fields) == 0 {
+		// assigning the key to itself changes nothing.
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s",
+			d.quote(key), d.quote(key))
+	}
+	sets := make([]string, len(fields))
+	for i, f := range fields {
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", d.quote(f), d.quote(f))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// returning() returns "", since MySQL reports the last insert id.
+func (mysqlDialect) returning(idField string) string {
+	return ""
+}
@@ -0,0 +1,198 @@
+package apidCRUD
+
+import (
+	"testing"
+)
+
+// ----- golden SQL tests for the SQL dialects
+
+// dialectSQL_TC is one statement, built in each dialect.
+type dialectSQL_TC struct {
+	title string
+	build func(d sqlDialect) string
+	xsqlite string
+	xpostgres string
+	xmysql string
+}
+
+// goldenSchema is the schema of the table in the golden SQL tests.
+var goldenSchema = TableSchema{Fields: []FieldSchema{
+	{Name: "id", Properties: []string{"is_primary_key"}},
+	{Name: "name"},
+}}
+
+// goldenQuery() returns the statement built for a recordQuery,
+// described by a string of params as for fakeParams().
+func goldenQuery(paramstr string,
+	mk func(d sqlDialect, q recordQuery) (string, []interface{})) func(d sqlDialect) string {
+	return func(d sqlDialect) string {
+		qstring, _ := mk(d, newRecordQuery(fakeParams(paramstr)))
+		return qstring
+	}
+}
+
+// dialectSQL_Tab is the table of golden SQL testcases.
+var dialectSQL_Tab = []dialectSQL_TC {
+	{"select all",
+		goldenQuery("table_name=T", mkSelectString),
+		"SELECT `id`,* FROM `T` ORDER BY `id`",
+		`SELECT "id",* FROM "T" ORDER BY "id"`,
+		"SELECT `id`,* FROM `T` ORDER BY `id`"},
+	{"select one",
+		goldenQuery("table_name=T&id=5&fields=a,b&limit=10&offset=0",
+			mkSelectString),
+		"SELECT `id`,`a`,`b` FROM `T` WHERE `id` = ? ORDER BY `id` LIMIT 10 OFFSET 0",
+		`SELECT "id","a","b" FROM "T" WHERE "id" = $1 ORDER BY "id" LIMIT 10`,
+		"SELECT `id`,`a`,`b` FROM `T` WHERE `id` = ? ORDER BY `id` LIMIT 10 OFFSET 0"},
+	{"select some with offset only",
+		goldenQuery("table_name=T&ids=1,2&offset=3", mkSelectString),
+		"SELECT `id`,* FROM `T` WHERE `id` IN (?,?) ORDER BY `id` LIMIT -1 OFFSET 3",
+		`SELECT "id",* FROM "T" WHERE "id" IN ($1,$2) ORDER BY "id" OFFSET 3`,
+		"SELECT `id`,* FROM `T` WHERE `id` IN (?,?) ORDER BY `id` LIMIT 18446744073709551615 OFFSET 3"},
+	{"select none",
+		func(d sqlDialect) string {
+			qstring, _ := mkSelectString(d,
+				recordQuery{table: "T", idField: "id", ids: []int64{}})
+			return qstring
+		},
+		"SELECT `id`,* FROM `T` WHERE 1 = 0 ORDER BY `id`",
+		`SELECT "id",* FROM "T" WHERE 1 = 0 ORDER BY "id"`,
+		"SELECT `id`,* FROM `T` WHERE 1 = 0 ORDER BY `id`"},
+	{"quoted name",
+		func(d sqlDialect) string {
+			return d.quote("a\"b`c")
+		},
+		"`a\"b``c`",
+		`"a""b` + "`" + `c"`,
+		"`a\"b``c`"},
+	{"insert",
+		func(d sqlDialect) string {
+			return mkInsertString(d, "_tables_", []string{"name", "schema"},
+				d.returning("id"))
+		},
+		"INSERT INTO `_tables_` (`name`,`schema`) VALUES (?,?)",
+		`INSERT INTO "_tables_" ("name","schema") VALUES ($1,$2) RETURNING "id"`,
+		"INSERT INTO `_tables_` (`name`,`schema`) VALUES (?,?)"},
+	{"insert ignoring duplicate",
+		func(d sqlDialect) string {
+			return mkInsertString(d, "_tables_", []string{"name", "schema"},
+				d.upsertClause("name", nil))
+		},
+		"INSERT INTO `_tables_` (`name`,`schema`) VALUES (?,?) ON CONFLICT (`name`) DO NOTHING",
+		`INSERT INTO "_tables_" ("name","schema") VALUES ($1,$2) ON CONFLICT ("name") DO NOTHING`,
+		"INSERT INTO `_tables_` (`name`,`schema`) VALUES (?,?) ON DUPLICATE KEY UPDATE `name` = `name`"},
+	{"upsert",
+		func(d sqlDialect) string {
+			return mkInsertString(d, "_tables_", []string{"name", "schema"},
+				d.upsertClause("name", []string{"schema"}))
+		},
+		"INSERT INTO `_tables_` (`name`,`schema`) VALUES (?,?) ON CONFLICT (`name`) DO UPDATE SET `schema` = excluded.`schema`",
+		`INSERT INTO "_tables_" ("name","schema") VALUES ($1,$2) ON CONFLICT ("name") DO UPDATE SET "schema" = excluded."schema"`,
+		"INSERT INTO `_tables_` (`name`,`schema`) VALUES (?,?) ON DUPLICATE KEY UPDATE `schema` = VALUES(`schema`)"},
+	{"update",
+		func(d sqlDialect) string {
+			qstring, _ := mkUpdateString(d,
+				newRecordQuery(fakeParams("table_name=T&ids=7,8")),
+				[]string{"a", "b"})
+			return qstring
+		},
+		"UPDATE `T` SET `a` = ?, `b` = ? WHERE `id` IN (?,?)",
+		`UPDATE "T" SET "a" = $1, "b" = $2 WHERE "id" IN ($3,$4)`,
+		"UPDATE `T` SET `a` = ?, `b` = ? WHERE `id` IN (?,?)"},
+	{"delete",
+		goldenQuery("table_name=T&id_field=name&id=9", mkDeleteString),
+		"DELETE FROM `T` WHERE `name` = ?",
+		`DELETE FROM "T" WHERE "name" = $1`,
+		"DELETE FROM `T` WHERE `name` = ?"},
+	{"create table",
+		func(d sqlDialect) string {
+			return mkCreateString(d, "T", goldenSchema)
+		},
+		"CREATE TABLE `T` (`id` integer primary key autoincrement, `name` text not null)",
+		`CREATE TABLE "T" ("id" bigserial primary key, "name" text not null)`,
+		"CREATE TABLE `T` (`id` bigint primary key auto_increment, `name` text not null)"},
+}
+
+// run one golden SQL testcase in each dialect.
+func dialectSQL_Checker(cx *testContext, tc *dialectSQL_TC) {
+	cx.assertEqual(tc.xsqlite, tc.build(sqliteDialect{}), tc.title + " sqlite")
+	cx.assertEqual(tc.xpostgres, tc.build(postgresDialect{}),
+		tc.title + " postgres")
+	cx.assertEqual(tc.xmysql, tc.build(mysqlDialect{}), tc.title + " mysql")
+}
+
+// the golden SQL test suite.  run all dialectSQL testcases.
+func Test_dialectSQL(t *testing.T) {
+	cx := newTestContext(t, "dialectSQL_Tab")
+	for _, tc := range dialectSQL_Tab {
+		dialectSQL_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for the dialect's SQL, run on sqlite
+
+// returningDialect is sqlite's dialect, but getting the id of an
+// inserted record as Postgres does.  sqlite supports both ways.
+type returningDialect struct {
+	sqliteDialect
+}
+
+// returning() returns the clause that returns the inserted id.
+func (d returningDialect) returning(idField string) string {
+	return "RETURNING " + d.quote(idField)
+}
+
+func Test_sqliteRecords_returning(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{})
+	defer cleanup()
+	err := execN(tdb, newXCmd(mkCreateString(sqliteDialect{}, "T",
+		goldenSchema)))
+	if !cx.assertErrorNil(err, "create table") {
+		return
+	}
+
+	r := sqliteRecords{tdb.runner(), returningDialect{}}
+	for _, xid := range []idType{1, 2} {
+		id, err := r.Insert("T", KVRecord{Keys: []string{"name"},
+			Values: []interface{}{"x"}})
+		cx.assertErrorNil(err, "insert")
+		cx.assertEqual(xid, id, "returned id")
+	}
+	_, err = r.Insert("T", KVRecord{Keys: []string{"bogus"},
+		Values: []interface{}{"x"}})
+	cx.assertTrue(err != nil, "insert of bogus field")
+}
+
+func Test_sqliteDialect_upsert(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{})
+	defer cleanup()
+	if !cx.assertErrorNil(migrateCatalog(tdb), "migrateCatalog") {
+		return
+	}
+
+	d := sqliteDialect{}
+	keys := []string{"name", "schema"}
+	ignore := mkInsertString(d, tableOfTables, keys,
+		d.upsertClause("name", nil))
+	upsert := mkInsertString(d, tableOfTables, keys,
+		d.upsertClause("name", []string{"schema"}))
+	err := execN(tdb,
+		newXCmd(ignore, "T", "1"),
+		newXCmd(ignore, "T", "2"))
+	cx.assertErrorNil(err, "insert ignoring duplicate")
+	cx.assertEqual("1", catalogSchemaOf(cx, tdb, "T"), "schema kept")
+
+	err = execN(tdb, newXCmd(upsert, "T", "3"))
+	cx.assertErrorNil(err, "upsert")
+	cx.assertEqual("3", catalogSchemaOf(cx, tdb, "T"), "schema updated")
+}
+
+// catalogSchemaOf() returns the schema of the named table in the catalog.
+func catalogSchemaOf(cx *testContext, db dbType, tabName string) string {
+	catalog, err := listCatalog(db)
+	cx.assertErrorNil(err, "listCatalog")
+	return catalog[tabName]
+}
@@ -0,0 +1,513 @@
+package apidCRUD
+
+// this module implements the logical dump and load of a database.
+// a dump holds every table in the table of tables, with its schema
+// and its records, as one json document or as NDJSON, one json value
+// per line.  unlike a snapshot (see backup.go), a dump does not depend
+// on the storage backend, so it can be loaded into any database.
+//
+// in NDJSON, the first line is the header {"kind":..,"version":..};
+// each table is a line {"table":..,"schema":..}, followed by a line
+// {"table":..,"keys":..,"values":..} for each of its records; the last
+// line is the trailer {"kind":"DumpEnd","tables":..,"records":..},
+// so that a dump cut short is not taken for a whole one.
+// a dump in NDJSON is written as it is read from the database, and
+// loaded as it is read, so that it need not fit in memory.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/apid/apid-core"
+)
+
+// dumpVersion is the version of the dump format.
+const dumpVersion = 1
+
+// ndjsonType is the media type of a dump in NDJSON.
+const ndjsonType = "application/x-ndjson"
+
+// getDbDumpHandler handles GET requests on /db/_admin/dump .
+// the dump is in NDJSON if the request accepts it, otherwise json.
+func getDbDumpHandler(harg *apiHandlerArg) apiHandlerRet {
+	d := harg.db()
+	if acceptsNDJSON(harg) {
+		return harg.stream(http.StatusOK, ndjsonType,
+			func(w io.Writer) error {
+				return dumpNDJSON(d, w)
+			})
+	}
+	dump, err := dumpDatabase(d)
+	if err != nil {
+		return errorRet(badStat, err, "after dumpDatabase")
+	}
+	return apiHandlerRet{http.StatusOK, dump}
+}
+
+// runDbLoadHandler handles POST requests on /db/_admin/load .
+// the body is a dump, in json or NDJSON as given by its content type.
+// a json body may be at most maxBodySize bytes; an NDJSON body is
+// loaded as it is read, and may be of any size.  either is loaded
+// in one transaction.
+func runDbLoadHandler(harg *apiHandlerArg) apiHandlerRet {
+	var res LoadResponse
+	var err error
+	if harg.contentType() == ndjsonType {
+		res, err = loadNDJSON(harg.db(), harg.getBody())
+	} else {
+		dump := DumpResponse{}
+		if err = harg.decodeBody(&dump); err != nil {
+			return errorRet(badStat, err, "after decodeBody")
+		}
+		res, err = loadDatabase(harg.db(), dump)
+	}
+	if err != nil {
+		return errorRet(badStat, err, "after load")
+	}
+	return apiHandlerRet{http.StatusCreated, res}
+}
+
+// acceptsNDJSON() returns true iff the request's Accept header
+// names the NDJSON media type.
+func acceptsNDJSON(harg *apiHandlerArg) bool {
+	for _, mt := range strings.Split(harg.req.Header.Get("Accept"), ",") {
+		mtype, _, err := mime.ParseMediaType(mt)
+		if err == nil && mtype == ndjsonType {
+			return true
+		}
+	}
+	return false
+}
+
+// ----- dump
+
+// dumpTables() reads the tables of the database, their schemas and
+// their records, in one transaction, so that they are consistent.
+// it passes each table, then each of its records, to the given
+// functions as they are read.
+func dumpTables(d dbType, onTable func(name string, sch TableSchema) error,
+		onRecord func(tabName string, rec DumpRecord) error) error {
+	return d.storage().Transact(func(tx recordStore) error {
+		names, err := tx.ListTables()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			sch, err := tx.TableSchema(name)
+			if err != nil {
+				return err
+			}
+			if err = onTable(name, sch); err != nil {
+				return err
+			}
+			if err = dumpRecords(tx, name, sch, onRecord); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dumpRecords() passes each record of the named table, whose schema
+// is given, to onRecord, selecting them maxRecs at a time in order
+// of the primary key, or of rowid if the table has none, as a table
+// adopted from outside the API may not.
+func dumpRecords(st recordStore, tabName string, sch TableSchema,
+		onRecord func(tabName string, rec DumpRecord) error) error {
+	key := "rowid"
+	for _, field := range sch.Fields {
+		if isPrimaryKey(field) {
+			key = field.Name
+		}
+	}
+	for offset := 0; ; offset += maxRecs {
+		recs, err := st.Select(recordQuery{
+			table: tabName,
+			idField: key,
+			keyField: key,
+			limit: maxRecs,
+			offset: offset,
+		})
+		if err != nil {
+			return err
+		}
+		for _, rec := range recs {
+			if err = onRecord(tabName,
+				DumpRecord{rec.Keys, rec.Values}); err != nil {
+				return err
+			}
+		}
+		if len(recs) < maxRecs {
+			return nil
+		}
+	}
+}
+
+// dumpDatabase() returns a dump of the database.
+func dumpDatabase(d dbType) (DumpResponse, error) {
+	ret := DumpResponse{
+		Version: dumpVersion,
+		Tables: []DumpTable{},
+		Kind: "DumpResponse",
+	}
+	err := dumpTables(d,
+		func(name string, sch TableSchema) error {
+			ret.Tables = append(ret.Tables,
+				DumpTable{Name: name, Schema: sch, Records: []DumpRecord{}})
+			return nil
+		},
+		func(tabName string, rec DumpRecord) error {
+			tab := &ret.Tables[len(ret.Tables)-1]
+			tab.Records = append(tab.Records, rec)
+			return nil
+		})
+	return ret, err
+}
+
+// dumpEndKind is the kind of the trailer line of a dump in NDJSON.
+const dumpEndKind = "DumpEnd"
+
+// dumpNDJSON() writes a dump of the database to w in NDJSON,
+// a line at a time as it is read.  the trailer is written only
+// if the whole dump was.
+func dumpNDJSON(d dbType, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	err := enc.Encode(DumpLine{Kind: "DumpResponse", Version: dumpVersion})
+	if err != nil {
+		return err
+	}
+	end := DumpLine{Kind: dumpEndKind}
+	err = dumpTables(d,
+		func(name string, sch TableSchema) error {
+			end.Tables++
+			return enc.Encode(DumpLine{Table: name, Schema: &sch})
+		},
+		func(tabName string, rec DumpRecord) error {
+			end.Records++
+			return enc.Encode(DumpLine{Table: tabName,
+				Keys: rec.Keys, Values: rec.Values})
+		})
+	if err != nil {
+		return err
+	}
+	return enc.Encode(end)
+}
+
+// scanNDJSONDump() reads a dump in NDJSON from r, passing each table,
+// then each of its records, to the given functions as they are read.
+// records have no schema yet, so onTable gets the table without them.
+// the dump must end with its trailer, whose numbers of tables and
+// records must be those read; otherwise the dump is incomplete.
+// unless strictJSON is turned off, unknown fields are an error.
+func scanNDJSONDump(r io.Reader, onTable func(tab DumpTable) error,
+		onRecord func(rec DumpRecord) error) error {
+	dec := json.NewDecoder(r)
+	if strictJSON {
+		dec.DisallowUnknownFields()
+	}
+	tabName := ""
+	seen := DumpLine{Kind: dumpEndKind}	// the trailer expected.
+	var end *DumpLine
+	for n := 1; ; n++ {
+		var line DumpLine
+		err := dec.Decode(&line)
+		if err == io.EOF {
+			if n == 1 {
+				return validationError(fmt.Errorf("empty dump"))
+			}
+			return checkDumpEnd(end, seen)
+		}
+		if err != nil {
+			return fmt.Errorf("dump line %d: %s", n, err)
+		}
+		switch {
+		case end != nil:
+			err = validationError(fmt.Errorf(
+				"dump line %d: after the trailer", n))
+		case n == 1:
+			if line.Version == 0 {
+				return validationError(
+					fmt.Errorf("dump line 1: no version"))
+			}
+			err = checkDumpVersion(line.Version)
+		case line.Kind == dumpEndKind:
+			end = &line
+		case line.Schema != nil:
+			tabName = line.Table
+			seen.Tables++
+			err = onTable(DumpTable{Name: line.Table,
+				Schema: *line.Schema, Records: []DumpRecord{}})
+		case tabName != "" && line.Table == tabName:
+			seen.Records++
+			err = onRecord(DumpRecord{line.Keys, line.Values})
+		default:
+			err = validationError(fmt.Errorf(
+				"dump line %d: record of table %s is not after its schema",
+				n, line.Table))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkDumpEnd() checks that a dump in NDJSON ended with the given
+// trailer, which is nil if there was none, and that its numbers of
+// tables and records are those in seen.
+func checkDumpEnd(end *DumpLine, seen DumpLine) error {
+	if end == nil {
+		return validationError(fmt.Errorf(
+			"dump has no trailer; it may be incomplete"))
+	}
+	if end.Tables != seen.Tables || end.Records != seen.Records {
+		return validationError(fmt.Errorf(
+			"dump trailer gives %d tables and %d records, but %d and %d were read",
+			end.Tables, end.Records, seen.Tables, seen.Records))
+	}
+	return nil
+}
+
+// ----- load
+
+// dumpLoader loads a dump into a database as the dump is read,
+// within a transaction.  each table is created, then its records
+// are inserted.  none of the tables may exist already.
+type dumpLoader struct {
+	tx recordStore
+	exists map[string]int	// the tables in the database or the dump.
+	created []string
+	nrecs int	// the records of the last table inserted so far.
+	total int64
+}
+
+// loadDump() calls scan with a loader for the given database, in one
+// transaction, and returns the result of the load.  if scan fails,
+// the transaction is rolled back, so that none of the dump is loaded.
+func loadDump(d dbType, scan func(l *dumpLoader) error) (LoadResponse, error) {
+	ret := LoadResponse{Tables: []string{}, Kind: "LoadResponse"}
+	err := d.storage().Transact(func(tx recordStore) error {
+		names, err := tx.ListTables()
+		if err != nil {
+			return err
+		}
+		l := &dumpLoader{tx: tx, exists: listToMap(names)}
+		if err = scan(l); err != nil {
+			return err
+		}
+		ret.Tables = append(ret.Tables, l.created...)
+		ret.NumRecords = l.total
+		return nil
+	})
+	if err != nil {
+		return LoadResponse{Tables: []string{}, Kind: "LoadResponse"}, err
+	}
+	return ret, nil
+}
+
+// table() creates the given table.  its records are added after.
+func (l *dumpLoader) table(tab DumpTable) error {
+	if err := checkDumpTable(l.exists, tab.Name); err != nil {
+		return err
+	}
+	l.exists[tab.Name] = 1
+	if err := l.tx.CreateTable(tab.Name, tab.Schema); err != nil {
+		return err
+	}
+	l.created = append(l.created, tab.Name)
+	l.nrecs = 0
+	return nil
+}
+
+// record() inserts a record of the last table created.
+func (l *dumpLoader) record(rec DumpRecord) error {
+	tabName := l.created[len(l.created)-1]
+	if err := checkDumpRecord(tabName, l.nrecs, rec); err != nil {
+		return err
+	}
+	if _, err := l.tx.Insert(tabName,
+		KVRecord{rec.Keys, rec.Values}); err != nil {
+		return annotateError(err, fmt.Sprintf(
+			"table %s record %d", tabName, l.nrecs))
+	}
+	l.nrecs++
+	l.total++
+	return nil
+}
+
+// loadDatabase() loads the dump into the database.  the whole dump
+// is checked first, so that a bad dump is rejected before it is loaded.
+func loadDatabase(d dbType, dump DumpResponse) (LoadResponse, error) {
+	if err := checkDump(d, dump); err != nil {
+		return LoadResponse{Tables: []string{}, Kind: "LoadResponse"}, err
+	}
+	return loadDump(d, func(l *dumpLoader) error {
+		for _, tab := range dump.Tables {
+			if err := l.table(tab); err != nil {
+				return err
+			}
+			for _, rec := range tab.Records {
+				if err := l.record(rec); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// loadNDJSON() loads the dump in NDJSON read from r into the
+// database, as it is read.
+func loadNDJSON(d dbType, r io.Reader) (LoadResponse, error) {
+	return loadDump(d, func(l *dumpLoader) error {
+		return scanNDJSONDump(r, l.table, l.record)
+	})
+}
+
+// checkDump() checks that the dump can be loaded into the database:
+// its version is known, its table names are valid and new,
+// and its records are well formed.
+func checkDump(d dbType, dump DumpResponse) error {
+	if err := checkDumpVersion(dump.Version); err != nil {
+		return err
+	}
+	names, err := d.storage().ListTables()
+	if err != nil {
+		return err
+	}
+	exists := listToMap(names)
+	for _, tab := range dump.Tables {
+		if err = checkDumpTable(exists, tab.Name); err != nil {
+			return err
+		}
+		exists[tab.Name] = 1
+		for i, rec := range tab.Records {
+			if err = checkDumpRecord(tab.Name, i, rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkDumpVersion() checks that a dump's version is known.
+func checkDumpVersion(version int) error {
+	if version < 1 || version > dumpVersion {
+		return validationError(fmt.Errorf(
+			"dump version %d is not supported (1 to %d)",
+			version, dumpVersion))
+	}
+	return nil
+}
+
+// checkDumpTable() checks that a dump's table name is valid,
+// and not one of the given existing tables.
+func checkDumpTable(exists map[string]int, tabName string) error {
+	if _, err := validate_table_name(tabName); err != nil {
+		return validationError(err)
+	}
+	if exists[tabName] != 0 {
+		return conflictError(fmt.Errorf("table %s already exists", tabName))
+	}
+	return nil
+}
+
+// checkDumpRecord() checks that record i of a dump's table
+// has a value for each key.
+func checkDumpRecord(tabName string, i int, rec DumpRecord) error {
+	if len(rec.Keys) != len(rec.Values) {
+		return validationError(fmt.Errorf(
+			"table %s record %d: %d keys but %d values",
+			tabName, i, len(rec.Keys), len(rec.Values)))
+	}
+	return nil
+}
+
+// ----- offline use
+
+// offlineDb() opens the named database outside the plugin, for
+// use by commands.  apid must have been initialized; its config and
+// log services are used as the plugin would use them.
+// only sqlite databases can be opened this way.  a database opened
+// readOnly is used as it is, with its catalog neither migrated nor
+// reconciled, so that a file that can't be written can be dumped.
+func offlineDb(dbName string, readOnly bool) (dbType, error) {
+	if err := initConfig(apid.Config()); err != nil {
+		return dbType{}, err
+	}
+	log = apid.Log().ForModule(pluginData.Name)	// NOTE: non-local var
+	if !readOnly {
+		d, err := initDB(dbName)
+		if err == nil && !d.isSQL() {
+			err = fmt.Errorf("database %s: driver %s keeps nothing to dump or load",
+				dbName, dbDriver)
+		}
+		return d, err
+	}
+	if dbDriver != "sqlite3" {
+		return dbType{}, fmt.Errorf("database %s: driver %s keeps nothing to dump or load",
+			dbName, dbDriver)
+	}
+	d, err := openSqliteHandle("file:" + dbName + "?mode=ro")
+	if err == nil {
+		_, err = checkCatalogVersion(d)
+	}
+	if err != nil {
+		if d.handle != nil {
+			d.handle.Close() // nolint
+		}
+		return dbType{}, fmt.Errorf("database %s: %s", dbName, err)
+	}
+	return d, nil
+}
+
+// DumpDatabase writes a dump of the named database to w,
+// in NDJSON if ndjson is true, otherwise as one json document.
+// it is for commands, such as cmd/dbdump, that work on a database
+// outside the plugin.  apid must have been initialized.
+// the database is only read; its file need not be writable.
+func DumpDatabase(dbName string, w io.Writer, ndjson bool) error {
+	d, err := offlineDb(dbName, true)
+	if err != nil {
+		return err
+	}
+	defer d.handle.Close() // nolint
+	if ndjson {
+		return dumpNDJSON(d, w)
+	}
+	dump, err := dumpDatabase(d)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// LoadDatabase reads a dump from r, in NDJSON if ndjson is true,
+// otherwise as one json document, and loads it into the named
+// database, as the runDbLoad API does.  it is for commands, as is
+// DumpDatabase.  it returns the number of records loaded.
+func LoadDatabase(dbName string, r io.Reader, ndjson bool) (int64, error) {
+	var dump DumpResponse
+	if !ndjson {
+		if err := json.NewDecoder(r).Decode(&dump); err != nil {
+			return 0, err
+		}
+	}
+	d, err := offlineDb(dbName, false)
+	if err != nil {
+		return 0, err
+	}
+	defer d.handle.Close() // nolint
+	var res LoadResponse
+	if ndjson {
+		res, err = loadNDJSON(d, r)
+	} else {
+		res, err = loadDatabase(d, dump)
+	}
+	return res.NumRecords, err
+}
@@ -1,5 +1,7 @@
 #! /bin/bash
+#	dump.sh [DATABASE]
+# dump the schemas and records of all tables of the database,
+# by default apidCRUD.db, as NDJSON on stdout.
 
-DATABASE=apidCRUD.db
-echo ".tables" | sqlite3 "$DATABASE"
-echo "select * from bundles;" | sqlite3 "$DATABASE"
+DATABASE=${1:-apidCRUD.db}
+go run ./cmd/dbdump -ndjson "$DATABASE"
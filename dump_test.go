@@ -0,0 +1,415 @@
+package apidCRUD
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ----- unit tests for dumpDatabase() and loadDatabase()
+
+// mkDumpDb() returns a database holding tables t1, with n records,
+// and t2, empty, and the function that removes it.
+func mkDumpDb(n int) (dbType, func()) {
+	return mkTempDb(tempDbOpts{
+		catalog: true,
+		tables: []string{"t1", "t2"},
+		records: n,
+	})
+}
+
+// dumpString() returns the dump as json, for comparison.
+func dumpString(dump DumpResponse) string {
+	js, _ := json.Marshal(dump)
+	return string(js)
+}
+
+func Test_dumpLoad(t *testing.T) {
+	cx := newTestContext(t)
+	defer func(saved int) { maxRecs = saved }(maxRecs)
+	maxRecs = 2	// so that t1 is selected in parts.
+	tdb, cleanup := mkDumpDb(5)
+	defer cleanup()
+
+	dump, err := dumpDatabase(tdb)
+	if !cx.assertErrorNil(err, "dumpDatabase") {
+		return
+	}
+	cx.assertEqual(2, len(dump.Tables), "number of tables")
+	cx.assertEqual(5, len(dump.Tables[0].Records), "records of t1")
+	cx.assertEqual(`{"keys":["id","name"],"values":["5","r4"]}`,
+		func() string {
+			js, _ := json.Marshal(dump.Tables[0].Records[4])
+			return string(js)
+		}(), "last record of t1")
+
+	// the dump loads into another backend, and dumps the same.
+	mdb, _ := openMemoryDB("test")
+	res, err := loadDatabase(mdb, dump)
+	cx.assertErrorNil(err, "loadDatabase")
+	cx.assertEqual("t1,t2", strings.Join(res.Tables, ","), "tables loaded")
+	cx.assertEqual(int64(5), res.NumRecords, "records loaded")
+	dump2, err := dumpDatabase(mdb)
+	cx.assertErrorNil(err, "dumpDatabase of loaded database")
+	cx.assertEqual(dumpString(dump), dumpString(dump2), "dump of loaded")
+
+	// loading it again conflicts with the tables loaded.
+	_, err = loadDatabase(mdb, dump)
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(http.StatusConflict, code, "reload status")
+}
+
+func Test_loadDatabase_failure(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkDumpDb(0)
+	defer cleanup()
+
+	dump := DumpResponse{Version: dumpVersion, Tables: []DumpTable{
+		{Name: "t3", Schema: goldenSchema, Records: []DumpRecord{
+			{Keys: []string{"name"}, Values: []interface{}{"x"}},
+			{Keys: []string{"bogus"}, Values: []interface{}{"x"}},
+		}},
+	}}
+	_, err := loadDatabase(tdb, dump)
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(http.StatusUnprocessableEntity, code, "bad record status")
+	cx.assertTrue(err != nil && strings.HasPrefix(err.Error(),
+		"table t3 record 1"), "bad record message")
+	names, _ := tdb.storage().ListTables()
+	cx.assertEqual("t1,t2", strings.Join(names, ","),
+		"created table deleted")
+}
+
+// tables adopted from outside the API are dumped in order of their
+// primary key, which need not be id, or of rowid if they have none.
+func Test_dumpDatabase_adopted(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{
+		catalog: true,
+		setup: []string{
+			"create table bykey (k integer primary key, v text)",
+			"insert into bykey values (20, 'b'), (10, 'a')",
+			`insert into _tables_ (name, schema) values ('bykey',
+				'{"Fields":[{"Name":"k","Properties":["is_primary_key"]},{"Name":"v"}]}')`,
+			"create table nokey (a text, b text)",
+			"insert into nokey values ('x', 'y')",
+			`insert into _tables_ (name, schema) values ('nokey',
+				'{"Fields":[{"Name":"a"},{"Name":"b"}]}')`,
+		},
+	})
+	defer cleanup()
+
+	dump, err := dumpDatabase(tdb)
+	if !cx.assertErrorNil(err, "dumpDatabase") {
+		return
+	}
+	cx.assertEqual(`{"version":1,"tables":[`+
+		`{"name":"bykey","schema":{"Fields":[{"Name":"k","Properties":["is_primary_key"]},{"Name":"v","Properties":null}]},"records":[`+
+		`{"keys":["k","v"],"values":["10","a"]},{"keys":["k","v"],"values":["20","b"]}]},`+
+		`{"name":"nokey","schema":{"Fields":[{"Name":"a","Properties":null},{"Name":"b","Properties":null}]},"records":[`+
+		`{"keys":["a","b"],"values":["x","y"]}]}],"kind":"DumpResponse"}`,
+		dumpString(dump), "dump")
+
+	// the memory backend dumps such tables the same.
+	mdb, _ := openMemoryDB("test")
+	_, err = loadDatabase(mdb, dump)
+	cx.assertErrorNil(err, "loadDatabase")
+	dump2, err := dumpDatabase(mdb)
+	cx.assertErrorNil(err, "dumpDatabase of loaded database")
+	cx.assertEqual(dumpString(dump), dumpString(dump2), "dump of loaded")
+}
+
+// ----- unit tests for checkDump()
+
+// inputs and outputs for one checkDump testcase.
+type checkDump_TC struct {
+	dump string
+	xcode int
+}
+
+// table of checkDump testcases.  the database has tables t1 and t2.
+var checkDump_Tab = []checkDump_TC {
+	{ `{"version":1,"tables":[]}`, 0 },
+	{ `{"version":1,"tables":[{"name":"t3","records":[{"keys":["a"],"values":["x"]}]}]}`, 0 },
+	{ `{"version":0,"tables":[]}`, 422 },
+	{ `{"version":2,"tables":[]}`, 422 },
+	{ `{"version":1,"tables":[{"name":"t-3"}]}`, 422 },
+	{ `{"version":1,"tables":[{"name":"t1"}]}`, 409 },
+	{ `{"version":1,"tables":[{"name":"t3"},{"name":"t3"}]}`, 409 },
+	{ `{"version":1,"tables":[{"name":"t3","records":[{"keys":["a"],"values":[]}]}]}`, 422 },
+}
+
+// run one testcase for function checkDump.
+func checkDump_Checker(cx *testContext, tdb dbType, tc *checkDump_TC) {
+	var dump DumpResponse
+	err := json.Unmarshal([]byte(tc.dump), &dump)
+	if !cx.assertErrorNil(err, "unmarshal") {
+		return
+	}
+	err = checkDump(tdb, dump)
+	code := 0
+	if err != nil {
+		code, _ = classifyError(badStat, err)
+	}
+	cx.assertEqual(tc.xcode, code, "status")
+}
+
+// the checkDump test suite.  run all checkDump testcases.
+func Test_checkDump(t *testing.T) {
+	cx := newTestContext(t, "checkDump_Tab")
+	tdb, cleanup := mkDumpDb(0)
+	defer cleanup()
+	for _, tc := range checkDump_Tab {
+		checkDump_Checker(cx, tdb, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for scanNDJSONDump()
+
+// inputs and outputs for one scanNDJSONDump testcase.
+// xres is the tables read, as name:number of records,... .
+type scanNDJSONDump_TC struct {
+	input string
+	xres string
+	xsucc bool
+}
+
+// table of scanNDJSONDump testcases.
+var scanNDJSONDump_Tab = []scanNDJSONDump_TC {
+	{ `{"kind":"DumpResponse","version":1}
+{"kind":"DumpEnd"}`, "", true },
+	{ `{"kind":"DumpResponse","version":1}`, "", false },
+	{ `{"version":1}
+{"table":"a","schema":{"Fields":[{"Name":"id"}]}}
+{"table":"a","keys":["id"],"values":["1"]}
+{"table":"a","keys":["id"],"values":["2"]}
+{"table":"b","schema":{"Fields":[{"Name":"id"}]}}
+{"kind":"DumpEnd","tables":2,"records":2}
+`, "a:2,b:0", true },
+	{ `{"version":1}
+{"table":"a","schema":{"Fields":[{"Name":"id"}]}}
+{"table":"a","keys":["id"],"values":["1"]}
+`, "", false },
+	{ `{"version":1}
+{"table":"a","schema":{"Fields":[{"Name":"id"}]}}
+{"table":"a","keys":["id"],"values":["1"]}
+{"kind":"DumpEnd","tables":1,"records":2}
+`, "", false },
+	{ `{"version":1}
+{"table":"a","schema":{"Fields":[{"Name":"id"}]}}
+{"kind":"DumpEnd","tables":1}
+{"table":"a","keys":["id"],"values":["1"]}
+`, "", false },
+	{ "", "", false },
+	{ `{"table":"a","schema":{"Fields":[]}}`, "", false },
+	{ `{"version":2}`, "", false },
+	{ `{"version":1}
+{"table":"a","keys":["id"],"values":["1"]}`, "", false },
+	{ `{"version":1}
+{"table":"a","schema":{"Fields":[]}}
+{"table":"b","keys":["id"],"values":["1"]}`, "", false },
+	{ `{"version":1}
+{"table":"a","bogus":1}`, "", false },
+	{ `{"version":1}
+not json`, "", false },
+}
+
+// run one testcase for function scanNDJSONDump.
+func scanNDJSONDump_Checker(cx *testContext, tc *scanNDJSONDump_TC) {
+	tabs := []DumpTable{}
+	err := scanNDJSONDump(strings.NewReader(tc.input),
+		func(tab DumpTable) error {
+			tabs = append(tabs, tab)
+			return nil
+		},
+		func(rec DumpRecord) error {
+			tab := &tabs[len(tabs)-1]
+			tab.Records = append(tab.Records, rec)
+			return nil
+		})
+	if !cx.assertEqual(tc.xsucc, err == nil, "succ") || err != nil {
+		return
+	}
+	res := make([]string, len(tabs))
+	for i, tab := range tabs {
+		res[i] = fmt.Sprintf("%s:%d", tab.Name, len(tab.Records))
+	}
+	cx.assertEqual(tc.xres, strings.Join(res, ","), "result")
+}
+
+// the scanNDJSONDump test suite.  run all scanNDJSONDump testcases.
+func Test_scanNDJSONDump(t *testing.T) {
+	cx := newTestContext(t, "scanNDJSONDump_Tab")
+	for _, tc := range scanNDJSONDump_Tab {
+		scanNDJSONDump_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+func Test_dumpNDJSON(t *testing.T) {
+	cx := newTestContext(t)
+	defer func(saved int) { maxRecs = saved }(maxRecs)
+	maxRecs = 2	// so that t1 is read and loaded in parts.
+	tdb, cleanup := mkDumpDb(5)
+	defer cleanup()
+	dump, err := dumpDatabase(tdb)
+	cx.assertErrorNil(err, "dumpDatabase")
+
+	var buf bytes.Buffer
+	err = dumpNDJSON(tdb, &buf)
+	cx.assertErrorNil(err, "dumpNDJSON")
+	cx.assertEqual(9, strings.Count(buf.String(), "\n"), "number of lines")
+	cx.assertTrue(strings.HasSuffix(buf.String(),
+		`{"kind":"DumpEnd","tables":2,"records":5}`+"\n"), "trailer")
+
+	mdb, _ := openMemoryDB("test")
+	res, err := loadNDJSON(mdb, &buf)
+	cx.assertErrorNil(err, "loadNDJSON")
+	cx.assertEqual(int64(5), res.NumRecords, "records loaded")
+	dump2, err := dumpDatabase(mdb)
+	cx.assertErrorNil(err, "dumpDatabase of loaded database")
+	cx.assertEqual(dumpString(dump), dumpString(dump2), "dump of loaded")
+}
+
+// loadFailure_Checker loads a bad NDJSON dump into the given
+// database, whose tables are xnames, and checks that the load fails
+// leaving none of the tables it created.
+func loadFailure_Checker(cx *testContext, d dbType, xnames string) {
+	_, err := loadNDJSON(d, strings.NewReader(`{"version":1}
+{"table":"t3","schema":{"Fields":[{"Name":"id","Properties":["is_primary_key"]},{"Name":"name"}]}}
+{"table":"t3","keys":["name"],"values":["x"]}
+{"table":"t3","keys":["name"],"values":["y"]}
+{"table":"t4","schema":{"Fields":[{"Name":"id","Properties":["is_primary_key"]},{"Name":"name"}]}}
+{"table":"t4","keys":["bogus"],"values":["x"]}
+`))
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(http.StatusUnprocessableEntity, code, "bad record status")
+	cx.assertTrue(err != nil && strings.HasPrefix(err.Error(),
+		"table t4 record 0"), "bad record message")
+	names, _ := d.storage().ListTables()
+	cx.assertEqual(xnames, strings.Join(names, ","),
+		"created tables rolled back")
+}
+
+// a failed NDJSON load, which is one transaction,
+// leaves none of the tables it created.
+func Test_loadNDJSON_failure(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkDumpDb(0)
+	defer cleanup()
+	loadFailure_Checker(cx, tdb, "t1,t2")
+	cx.bump()
+	mdb, _ := openMemoryDB("test")
+	loadFailure_Checker(cx, mdb, "")
+}
+
+// ----- unit tests for DumpDatabase()
+
+// DumpDatabase reads the database as it is: it neither migrates its
+// catalog, nor creates a database that does not exist.
+func Test_DumpDatabase_readOnly(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{
+		catalog: true,
+		tables: []string{"t1"},
+		records: 2,
+		setup: catalogVersionSetup(0),
+	})
+	defer cleanup()
+	var path string
+	_ = tdb.handle.QueryRow("select file from pragma_database_list").Scan(&path)
+
+	var buf bytes.Buffer
+	err := DumpDatabase(path, &buf, true)
+	cx.assertErrorNil(err, "DumpDatabase")
+	cx.assertEqual(5, strings.Count(buf.String(), "\n"), "number of lines")
+	version, _ := getCatalogVersion(tdb)
+	cx.assertEqual(0, version, "catalog version after dump")
+
+	missing := path + ".missing"
+	err = DumpDatabase(missing, &buf, true)
+	cx.assertTrue(err != nil, "missing database")
+	_, err = os.Stat(missing)
+	cx.assertTrue(os.IsNotExist(err), "missing database not created")
+}
+
+// ----- end-to-end tests of dump and load
+
+func Test_dumpLoadApi(t *testing.T) {
+	cx := newTestContext(t)
+	reg, cleanup := mkTempDbs()
+	defer cleanup()
+	defer func(saved *dbRegistry) { dbs = saved }(dbs)
+	dbs = reg
+	ws := newApiWiring("", apiTable, defaultMiddleware...)
+
+	backupCall(cx, ws, http.MethodPost, "/db/a/_schema/t1",
+		`{"fields":[{"name":"id","properties":["is_primary_key"]},{"name":"name"}]}`,
+		http.StatusCreated)
+	backupCall(cx, ws, http.MethodPost, "/db/a/_table/t1",
+		`{"records":[{"keys":["name"],"values":["x"]}]}`,
+		http.StatusCreated)
+
+	w := backupCall(cx, ws, http.MethodGet, "/db/a/_admin/dump", "",
+		http.StatusOK)
+	cx.assertTrue(strings.Contains(w.Body.String(),
+		`"records":[{"keys":["id","name"],"values":["1","x"]}]`),
+		"json dump")
+
+	r, _ := http.NewRequest(http.MethodGet, "/db/a/_admin/dump",
+		strings.NewReader(""))
+	r.Header.Set("Accept", ndjsonType)
+	w = httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(http.StatusOK, w.Code, "ndjson dump status")
+	cx.assertEqual(ndjsonType, w.Header().Get("Content-Type"),
+		"ndjson dump content type")
+	ndjson := w.Body.String()
+
+	r, _ = http.NewRequest(http.MethodPost, "/db/b/_admin/load",
+		strings.NewReader(ndjson))
+	r.Header.Set("Content-Type", ndjsonType)
+	w = httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(http.StatusCreated, w.Code, "ndjson load status")
+	cx.assertTrue(strings.Contains(w.Body.String(), `"numRecords":1`),
+		"ndjson load result")
+
+	backupCall(cx, ws, http.MethodGet, "/db/b/_table/t1/1", "",
+		http.StatusOK)
+	backupCall(cx, ws, http.MethodPost, "/db/b/_admin/load",
+		`{"version":1,"tables":[{"name":"t1","schema":{},"records":[]}]}`,
+		http.StatusConflict)
+
+	// an NDJSON dump cut short, without its trailer, loads nothing.
+	lines := strings.SplitAfter(ndjson, "\n")
+	truncated := strings.Join(lines[:len(lines)-2], "")
+	r, _ = http.NewRequest(http.MethodPost, "/db/b/_admin/load",
+		strings.NewReader(strings.Replace(truncated, `"t1"`, `"t4"`, -1)))
+	r.Header.Set("Content-Type", ndjsonType)
+	w = httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(http.StatusUnprocessableEntity, w.Code,
+		"truncated ndjson load status")
+	backupCall(cx, ws, http.MethodGet, "/db/b/_table/t4/1", "",
+		http.StatusNotFound)
+
+	// an NDJSON load is not limited by maxBodySize; a json load is.
+	defer func(saved int) { maxBodySize = saved }(maxBodySize)
+	maxBodySize = 64
+	r, _ = http.NewRequest(http.MethodPost, "/db/b/_admin/load",
+		strings.NewReader(strings.Replace(ndjson, `"t1"`, `"t2"`, -1)))
+	r.Header.Set("Content-Type", ndjsonType)
+	w = httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(http.StatusCreated, w.Code, "large ndjson load status")
+	backupCall(cx, ws, http.MethodPost, "/db/b/_admin/load",
+		`{"version":1,"tables":[{"name":"t3","schema":{"fields":[{"name":"id"}]},"records":[]}]}`,
+		http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,244 @@
+package apidCRUD
+
+// this module defines the typed errors used by the handlers,
+// and the mapping from errors (including database driver errors)
+// to http status codes and machine-readable error codes.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// machine-readable error codes, returned in ErrorResponse.ErrorCode .
+const (
+	errCodeBadRequest = "bad_request"
+	errCodeNotFound = "not_found"
+	errCodeConflict = "conflict"
+	errCodeValidation = "validation"
+	errCodeTooLarge = "too_large"
+	errCodeUnavailable = "unavailable"
+	errCodeTimeout = "timeout"
+	errCodeNotImplemented = "not_implemented"
+	errCodeInternal = "internal"
+)
+
+// validation rules reported in FieldError.Rule .
+const (
+	ruleParam = "param"		// request parameter failed its validator.
+	ruleIdentifier = "identifier"	// not a valid SQL identifier.
+	ruleDuplicate = "duplicate"	// key given more than once in a record.
+	ruleLength = "length"		// number of keys != number of values.
+)
+
+// apiError is an error that carries its own http status and error code,
+// and optionally the list of offending fields.
+type apiError struct {
+	status int
+	errCode string
+	err error
+	fields []FieldError
+}
+
+// Error() returns the message of the underlying error.
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+// notFoundError() marks err as a missing table or record (404).
+func notFoundError(err error) error {
+	return &apiError{http.StatusNotFound, errCodeNotFound, err, nil}
+}
+
+// conflictError() marks err as a conflict with existing data (409).
+func conflictError(err error) error {
+	return &apiError{http.StatusConflict, errCodeConflict, err, nil}
+}
+
+// validationError() marks err as well-formed but invalid input (422).
+func validationError(err error) error {
+	return &apiError{http.StatusUnprocessableEntity, errCodeValidation, err, nil}
+}
+
+// tooLargeError() marks err as a request body over the size limit (413).
+func tooLargeError(err error) error {
+	return &apiError{http.StatusRequestEntityTooLarge, errCodeTooLarge, err, nil}
+}
+
+// unavailableError() marks err as a database that can't be used
+// at present (503).
+func unavailableError(err error) error {
+	return &apiError{http.StatusServiceUnavailable, errCodeUnavailable,
+		err, nil}
+}
+
+// contextError() returns the error to report for a request whose
+// context ended with the given error, either by timing out (504)
+// after the given timeout, or by being canceled, typically when
+// the client went away (503).
+func contextError(err error, timeout time.Duration) error {
+	if err == context.DeadlineExceeded {
+		return &apiError{http.StatusGatewayTimeout, errCodeTimeout,
+			fmt.Errorf("statement timeout: request exceeded %s",
+				timeout), nil}
+	}
+	return &apiError{http.StatusServiceUnavailable, errCodeUnavailable,
+		fmt.Errorf("request canceled: %s", err), nil}
+}
+
+// notImplementedError() marks err as a feature the database
+// backend doesn't support (501).
+func notImplementedError(err error) error {
+	return &apiError{http.StatusNotImplemented, errCodeNotImplemented,
+		err, nil}
+}
+
+// internalError() marks err as a failure on our side (500).
+func internalError(err error) error {
+	return &apiError{http.StatusInternalServerError, errCodeInternal, err, nil}
+}
+
+// fieldsError() returns an error with the given status,
+// listing the given offending fields.
+// the message is the concatenation of the fields' messages.
+func fieldsError(status int, fields []FieldError) error {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Message
+	}
+	return &apiError{status, statusErrCode(status),
+		fmt.Errorf("%s", strings.Join(msgs, "; ")), fields}
+}
+
+// recoveredError is the error reported for a panic in an API call.
+// the panic itself is only logged; the client gets the correlation id,
+// which identifies the log entry.
+type recoveredError struct {
+	corrId string
+}
+
+// Error() returns a message naming the correlation id.
+func (e *recoveredError) Error() string {
+	return fmt.Sprintf("internal error, correlation id %s", e.corrId)
+}
+
+// errorCorrelation() returns the correlation id carried by err, if any.
+func errorCorrelation(err error) string {
+	if rerr, ok := err.(*recoveredError); ok {
+		return rerr.corrId
+	}
+	return ""
+}
+
+// errorFields() returns the list of offending fields carried by err, if any.
+func errorFields(err error) []FieldError {
+	if aerr, ok := err.(*apiError); ok {
+		return aerr.fields
+	}
+	return nil
+}
+
+// statusErrCode() returns the default error code for an http status.
+func statusErrCode(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return errCodeNotFound
+	case http.StatusConflict:
+		return errCodeConflict
+	case http.StatusUnprocessableEntity:
+		return errCodeValidation
+	case http.StatusRequestEntityTooLarge:
+		return errCodeTooLarge
+	case http.StatusServiceUnavailable:
+		return errCodeUnavailable
+	case http.StatusGatewayTimeout:
+		return errCodeTimeout
+	case http.StatusNotImplemented:
+		return errCodeNotImplemented
+	}
+	if status >= http.StatusInternalServerError {
+		return errCodeInternal
+	}
+	return errCodeBadRequest
+}
+
+// sqliteErrorClass() returns the http status implied by a sqlite error.
+// the ok return value is false if err is not a sqlite error.
+func sqliteErrorClass(err error) (int, bool) {
+	serr, ok := err.(sqlite3.Error)
+	if !ok {
+		return 0, false
+	}
+	switch serr.Code {
+	case sqlite3.ErrConstraint:
+		if serr.ExtendedCode == sqlite3.ErrConstraintNotNull ||
+			serr.ExtendedCode == sqlite3.ErrConstraintCheck {
+			return http.StatusUnprocessableEntity, true
+		}
+		return http.StatusConflict, true
+	case sqlite3.ErrMismatch, sqlite3.ErrTooBig, sqlite3.ErrRange:
+		return http.StatusUnprocessableEntity, true
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return http.StatusServiceUnavailable, true
+	case sqlite3.ErrError:
+		// sqlite uses its generic error code for SQL errors,
+		// which are distinguishable only by message.
+		msg := serr.Error()
+		switch {
+		case strings.HasPrefix(msg, "no such table"):
+			return http.StatusNotFound, true
+		case strings.HasPrefix(msg, "no such column"),
+			strings.Contains(msg, "has no column named"):
+			return http.StatusUnprocessableEntity, true
+		case strings.Contains(msg, "already exists"):
+			return http.StatusConflict, true
+		}
+		return http.StatusBadRequest, true
+	}
+	return http.StatusInternalServerError, true
+}
+
+// errorClass() returns the http status and error code implied by err.
+// the ok return value is false if err carries no such information.
+func errorClass(err error) (int, string, bool) {
+	if aerr, ok := err.(*apiError); ok {
+		return aerr.status, aerr.errCode, true
+	}
+	if _, ok := err.(*recoveredError); ok {
+		return http.StatusInternalServerError, errCodeInternal, true
+	}
+	switch err {
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout, errCodeTimeout, true
+	case context.Canceled:
+		return http.StatusServiceUnavailable, errCodeUnavailable, true
+	}
+	if status, ok := sqliteErrorClass(err); ok {
+		return status, statusErrCode(status), true
+	}
+	return 0, "", false
+}
+
+// classifyError() returns the http status and error code to report
+// for err.  defcode is used as the status if err carries none.
+func classifyError(defcode int, err error) (int, string) {
+	if status, errCode, ok := errorClass(err); ok {
+		return status, errCode
+	}
+	return defcode, statusErrCode(defcode)
+}
+
+// annotateError() returns an error whose message is err's message
+// preceded by prefix, preserving err's status and error code, if any.
+func annotateError(err error, prefix string) error {
+	msg := fmt.Errorf("%s: %s", prefix, err)
+	status, errCode, ok := errorClass(err)
+	if !ok {
+		return msg
+	}
+	return &apiError{status, errCode, msg, errorFields(err)}
+}
@@ -0,0 +1,125 @@
+package apidCRUD
+
+import (
+	"testing"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ----- unit tests for classifyError().
+
+// inputs and outputs for one classifyError testcase.
+type classifyError_TC struct {
+	defcode int
+	err error
+	xcode int
+	xerrCode string
+}
+
+// table of classifyError testcases.
+var classifyError_Tab = []classifyError_TC {
+	{ badStat, fmt.Errorf("plain"), badStat, errCodeBadRequest },
+	{ http.StatusInternalServerError, fmt.Errorf("plain"),
+		http.StatusInternalServerError, errCodeInternal },
+	{ badStat, notFoundError(fmt.Errorf("x")),
+		http.StatusNotFound, errCodeNotFound },
+	{ badStat, conflictError(fmt.Errorf("x")),
+		http.StatusConflict, errCodeConflict },
+	{ badStat, validationError(fmt.Errorf("x")),
+		http.StatusUnprocessableEntity, errCodeValidation },
+	{ badStat, internalError(fmt.Errorf("x")),
+		http.StatusInternalServerError, errCodeInternal },
+	{ badStat, &recoveredError{"abc"},
+		http.StatusInternalServerError, errCodeInternal },
+	{ badStat, context.DeadlineExceeded,
+		http.StatusGatewayTimeout, errCodeTimeout },
+	{ badStat, context.Canceled,
+		http.StatusServiceUnavailable, errCodeUnavailable },
+	{ badStat, sqlite3.Error{Code: sqlite3.ErrConstraint,
+			ExtendedCode: sqlite3.ErrConstraintUnique},
+		http.StatusConflict, errCodeConflict },
+	{ badStat, sqlite3.Error{Code: sqlite3.ErrConstraint,
+			ExtendedCode: sqlite3.ErrConstraintNotNull},
+		http.StatusUnprocessableEntity, errCodeValidation },
+	{ badStat, sqlite3.Error{Code: sqlite3.ErrMismatch},
+		http.StatusUnprocessableEntity, errCodeValidation },
+	{ badStat, sqlite3.Error{Code: sqlite3.ErrBusy},
+		http.StatusServiceUnavailable, errCodeUnavailable },
+	{ badStat, sqlite3.Error{Code: sqlite3.ErrCorrupt},
+		http.StatusInternalServerError, errCodeInternal },
+	{ badStat, sqlite3.Error{Code: sqlite3.ErrError},
+		badStat, errCodeBadRequest },
+	{ badStat, annotateError(notFoundError(fmt.Errorf("x")), "pfx"),
+		http.StatusNotFound, errCodeNotFound },
+	{ badStat, annotateError(fmt.Errorf("x"), "pfx"),
+		badStat, errCodeBadRequest },
+}
+
+// run one testcase for function classifyError.
+func classifyError_Checker(cx *testContext, tc *classifyError_TC) {
+	code, errCode := classifyError(tc.defcode, tc.err)
+	cx.assertEqual(tc.xcode, code, "status")
+	cx.assertEqual(tc.xerrCode, errCode, "error code")
+}
+
+// the classifyError test suite.  run all classifyError testcases.
+func Test_classifyError(t *testing.T) {
+	cx := newTestContext(t, "classifyError_Tab")
+	for _, tc := range classifyError_Tab {
+		classifyError_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for annotateError().
+
+func Test_annotateError(t *testing.T) {
+	cx := newTestContext(t)
+	err := annotateError(conflictError(fmt.Errorf("abc")), "xyz")
+	cx.assertEqual("xyz: abc", err.Error(), "message")
+}
+
+// ----- unit tests for sqliteErrorClass() using real database errors.
+
+// inputs and outputs for one sqliteErrorClass testcase.
+type sqliteErrorClass_TC struct {
+	query string
+	xcode int
+}
+
+// table of sqliteErrorClass testcases.
+var sqliteErrorClass_Tab = []sqliteErrorClass_TC {
+	{ `select id from bogus`, http.StatusNotFound },
+	{ `select bogus from bundles`, http.StatusUnprocessableEntity },
+	{ `insert into bundles (bogus) values (1)`,
+		http.StatusUnprocessableEntity },
+	{ `insert into _tables_ (name, schema) values ("users", "x")`,
+		http.StatusConflict },
+	{ `insert into bundles (name) values ("n")`,
+		http.StatusUnprocessableEntity },
+	{ `create table bundles(id integer)`, http.StatusConflict },
+	{ `bogus syntax`, http.StatusBadRequest },
+}
+
+// run one testcase for function sqliteErrorClass.
+func sqliteErrorClass_Checker(cx *testContext, tc *sqliteErrorClass_TC) {
+	_, err := db.handle.Exec(tc.query)
+	if !cx.assertTrue(err != nil, "expected error") {
+		return
+	}
+	code, ok := sqliteErrorClass(err)
+	cx.assertTrue(ok, "sqlite error")
+	cx.assertEqual(tc.xcode, code, "status")
+}
+
+// the sqliteErrorClass test suite.  run all sqliteErrorClass testcases.
+func Test_sqliteErrorClass(t *testing.T) {
+	cx := newTestContext(t, "sqliteErrorClass_Tab")
+	for _, tc := range sqliteErrorClass_Tab {
+		sqliteErrorClass_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
@@ -0,0 +1,32 @@
+#! /bin/bash
+#	backup.sh DBNAME [SNAPSHOT]
+# with no SNAPSHOT, take a snapshot of the named database,
+# and print its name; otherwise restore the named snapshot into
+# the database, and print the snapshot's name.
+# use _default as DBNAME for the default database.
+# the APIs are POST on /db/DBNAME/_admin/backup or /db/DBNAME/_admin/restore
+# aka runDbBackupInDb and runDbRestoreInDb .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+if [[ $# -lt 1 || $# -gt 2 ]]; then
+	echo 1>&2 "error: DBNAME, and optionally SNAPSHOT, must be specified on cmd line"
+	exit 1
+fi
+DBPATH="db/$1"
+if [[ "$1" == _default ]]; then
+	DBPATH=db
+fi
+
+if [[ $# -eq 1 ]]; then
+	out=$(apicurl POST "$DBPATH/_admin/backup")
+else
+	out=$(apicurl POST "$DBPATH/_admin/restore" -d "{\"name\":\"$2\"}")
+fi
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | jq -r .name
+exit $xstat
@@ -0,0 +1,22 @@
+#! /bin/bash
+#	batchtest.sh NAME
+# create a record and a second record that refers to it,
+# both in one transaction.
+# the API is POST /db/_batch aka runDbBatch .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+NAME=${1:-batch}
+OP1='{"op":"create","table":"'$TABLE_NAME'","record":{"keys":["name","uri"],"values":["'$NAME'-1","host1"]}}'
+OP2='{"op":"create","table":"'$TABLE_NAME'","record":{"keys":["name","uri"],"values":["'$NAME'-2",{"$ref":0}]}}'
+BODY="{\"operations\":[$OP1,$OP2]}"
+# echo 1>&2 "# BODY=$BODY"
+
+out=$(apicurl POST "db/_batch" -v -d "$BODY")
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | jq -S '.results[].ids[]'
+exit $xstat
@@ -0,0 +1,28 @@
+#! /bin/bash
+#	dbtabtest.sh DBNAME TABNAME
+# create a table in the named database, print the names of the
+# database's tables, then delete the table.
+# the APIs are POST and DELETE on /db/DBNAME/_schema/TABNAME
+# and GET on /db/DBNAME/_table,
+# aka createDbTableInDb, deleteDbTableInDb and getDbTablesInDb .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+if [[ $# -ne 2 ]]; then
+	echo 1>&2 "error: DBNAME and TABNAME must be specified on cmd line"
+	exit 1
+fi
+DBNAME=$1
+TABNAME=$2
+BTABLE='{"fields":[{"name":"id","properties":["is_primary_key"]},{"name":"name"}]}'
+
+apicurl POST "db/$DBNAME/_schema/$TABNAME" -d "$BTABLE" 1>&2 || exit 1
+out=$(apicurl GET "db/$DBNAME/_table")
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | jq -S -r .names[]
+apicurl DELETE "db/$DBNAME/_schema/$TABNAME" 1>&2
+exit $xstat
@@ -15,5 +15,5 @@ fi
 
 for tab in "$@"; do
 out=$(apicurl GET "db/_schema/$tab" -v)
-echo "$out" | jq -r -S .Schema
+echo "$out" | jq -r '.columns[].name'
 done
@@ -0,0 +1,52 @@
+#! /bin/bash
+#	dumptest.sh DBNAME
+#	dumptest.sh -l DBNAME TABNAME
+# dump the named database, and print the names of its tables.
+# with -l, load a dump of one table TABNAME with one record into
+# the database, print the number of records loaded,
+# then delete the table.
+# use _default as DBNAME for the default database.
+# the APIs are GET on /db/DBNAME/_admin/dump and POST on
+# /db/DBNAME/_admin/load, aka getDbDumpInDb and runDbLoadInDb .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+LOAD=false
+if [[ "$1" == "-l" ]]; then
+	LOAD=true
+	shift
+fi
+if [[ $# -lt 1 ]]; then
+	echo 1>&2 "error: DBNAME must be specified on cmd line"
+	exit 1
+fi
+DBPATH="db/$1"
+if [[ "$1" == _default ]]; then
+	DBPATH=db
+fi
+
+if [[ "$LOAD" == false ]]; then
+	out=$(apicurl GET "$DBPATH/_admin/dump")
+	xstat=$?
+	echo 1>&2 "$out"
+	echo "$out" | jq -r '.tables[].name'
+	exit $xstat
+fi
+
+if [[ $# -ne 2 ]]; then
+	echo 1>&2 "error: DBNAME and TABNAME must be specified on cmd line"
+	exit 1
+fi
+TABNAME=$2
+SCHEMA='{"Fields":[{"Name":"id","Properties":["is_primary_key"]},{"Name":"name"}]}'
+DUMP="{\"version\":1,\"tables\":[{\"name\":\"$TABNAME\",\"schema\":$SCHEMA,\"records\":[{\"keys\":[\"name\"],\"values\":[\"x\"]}]}]}"
+
+out=$(apicurl POST "$DBPATH/_admin/load" -d "$DUMP")
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | jq -r .numRecords
+apicurl DELETE "$DBPATH/_schema/$TABNAME" 1>&2
+exit $xstat
@@ -0,0 +1,15 @@
+#! /bin/bash
+#	metrics.sh
+# print the names of the metrics that have values.
+# the API is GET on /db/_metrics aka getDbMetrics .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+out=$(apicurl GET "db/_metrics")
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | grep -v '^#' | sed -e 's/[{ ].*//' | sort -u
+exit $xstat
@@ -0,0 +1,15 @@
+#! /bin/bash
+#	readytest.sh
+# print the readiness status.
+# the API is GET on /db/_ready aka getDbReady .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+out=$(apicurl GET "db/_ready")
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | jq -r '.status'
+exit $xstat
@@ -0,0 +1,23 @@
+#! /bin/bash
+#	reconcile.sh [-n]
+# reconcile the table catalog with the database,
+# and print the names of the unmanaged tables.
+# with -n, only report; otherwise import the unmanaged tables.
+# the API is GET or POST on /db/_admin/reconcile
+# aka getDbReconcile or runDbReconcile .
+
+# ----- start of mainline code
+PROGDIR=$(cd "$(dirname "$0")" && /bin/pwd)
+. "$PROGDIR/tester-env.sh" || exit 1
+. "$PROGDIR/test-common.sh" || exit 1
+
+VERB=POST
+if [[ "$1" == "-n" ]]; then
+	VERB=GET
+fi
+
+out=$(apicurl "$VERB" "db/_admin/reconcile")
+xstat=$?
+echo 1>&2 "$out"
+echo "$out" | jq -r '.unmanaged[]'
+exit $xstat
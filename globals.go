@@ -4,22 +4,39 @@ package apidCRUD
 // do not put functions here.
 
 import (
+	"context"
 	"net/http"
 	"database/sql"
+	"time"
 	"github.com/apid/apid-core"
 )
 
 // dbType is intended to encapsulate the database handle type.
+// ctx, if not nil, is the context in which statements are run;
+// see withContext().
+// store is the storage backend, if it is not sqlite; see storage().
+// handle is nil for backends not reached thru database/sql.
+// name is the name of a database from the registry (see dbs),
+// or empty for the default database.
+// refs counts the requests using the database; see acquireDb().
 type dbType struct {
 	handle *sql.DB
+	ctx context.Context
+	store storage
+	name string
+	refs *dbRefs
 }
 
 // badStat is a convenience constant, the http status for a bad request.
 const badStat = http.StatusBadRequest
 
-// db is our global database handle
+// db is our global database handle, for the default database.
+// the named databases are in the registry dbs.
 var db dbType
 
+// dbs is the registry of named databases.
+var dbs = newDbRegistry(map[string]string{})
+
 // log is our global log variable
 var log apid.LogService
 
@@ -33,7 +50,17 @@ var log apid.LogService
 // dbName is the name of the database that is implicitly used in these APIs.
 var dbName = "apidCRUD.db"
 
-// dbDriver is the name of the database driver to use
+// databases is a comma-separated list of name=dbname pairs, naming
+// the databases besides the default one.  each is served under
+// /db/{db_name}, with the same driver as the default database.
+var databases = ""
+
+// backupDir is the directory in which database snapshots are saved.
+// empty disables saving them; a snapshot can still be streamed.
+var backupDir = "backups"
+
+// dbDriver is the name of the database driver to use,
+// one of the keys of storageDrivers.
 var dbDriver = "sqlite3"
 
 // basePath is the prefix applied to paths in the API description table
@@ -44,3 +71,79 @@ var maxRecs = 1000
 
 // tobleOfTables is the name of the internal table of table names/schemas
 var  tableOfTables = "_tables_"
+
+// catalogMetaTable is the name of the internal table that records
+// the version of the catalog schema (see catalog.go).
+var catalogMetaTable = "_tables_meta"
+
+// corsOrigins is a comma-separated list of the origins allowed
+// to make cross-origin requests.  "*" allows any origin.
+// empty disables CORS.
+var corsOrigins = ""
+
+// corsMethods is a comma-separated list of the methods allowed
+// in cross-origin requests.  empty allows the methods of each path.
+var corsMethods = ""
+
+// corsHeaders is a comma-separated list of the request headers allowed
+// in cross-origin requests.  empty allows whatever is requested.
+var corsHeaders = "Accept,Content-Type"
+
+// corsCredentials controls whether cross-origin requests
+// may include credentials (cookies, authorization).
+// they are allowed only for origins listed by name, not for
+// origins allowed by "*".
+var corsCredentials = false
+
+// corsMaxAge is the number of seconds a preflight response may be cached.
+var corsMaxAge = "600"
+
+// compressMinSize is the smallest response body, in bytes,
+// that will be compressed.
+var compressMinSize = 1024
+
+// maxBodySize is the max size, in bytes, of a request body.
+var maxBodySize = 1 << 20
+
+// strictJSON controls whether a request body may contain object fields
+// that the API doesn't know.  if true, such fields are an error.
+var strictJSON = true
+
+// queryTimeout is the max time allowed for the statements of one
+// API request.  zero means no limit.
+var queryTimeout = 30 * time.Second
+
+// adminTimeout takes the place of queryTimeout for the admin APIs
+// that copy a whole database (dump, load, backup, restore),
+// which can run much longer than a query.  zero means no limit.
+var adminTimeout time.Duration
+
+// dbMaxOpenConns is the max number of open connections to the database.
+// zero means no limit.
+var dbMaxOpenConns = 0
+
+// dbMaxIdleConns is the max number of idle connections kept open.
+var dbMaxIdleConns = 2
+
+// dbConnMaxLifetime is the max time a connection may be reused.
+// zero means no limit.
+var dbConnMaxLifetime time.Duration
+
+// sqliteJournalMode is the journal_mode pragma of sqlite connections.
+// WAL lets readers run alongside a writer.  empty is sqlite's default.
+var sqliteJournalMode = "WAL"
+
+// sqliteSynchronous is the synchronous pragma of sqlite connections.
+// empty is sqlite's default.
+var sqliteSynchronous = "NORMAL"
+
+// sqliteBusyTimeout is how long a sqlite connection waits for a lock
+// held by another connection, before failing with "database is locked".
+var sqliteBusyTimeout = 5 * time.Second
+
+// sqliteForeignKeys controls whether sqlite enforces foreign keys.
+var sqliteForeignKeys = true
+
+// sqliteCacheSize is the cache_size pragma of sqlite connections,
+// in pages, or in KiB if negative.  empty is sqlite's default.
+var sqliteCacheSize = ""
@@ -140,6 +140,8 @@ func errorRet_Checker(cx *testContext, tc *errorRet_TC) {
 	}
 	cx.assertEqual(tc.code, eresp.Code, "ErrorResponse.Code")
 	cx.assertEqual(tc.msg, eresp.Message, "ErrorResponse.Message")
+	cx.assertEqual(statusErrCode(tc.code), eresp.ErrorCode,
+		"ErrorResponse.ErrorCode")
 }
 
 func Test_errorRet(t *testing.T) {
@@ -189,9 +191,9 @@ type idclause_TC struct {
 }
 
 var idclause_Tab = []idclause_TC {
-	{ "id_field=id&id=123", "WHERE id = ?", "123", true },
-	{ "id_field=id&ids=123", "WHERE id in (?)", "123", true },
-	{ "id_field=id&ids=123,456", "WHERE id in (?,?)", "123,456", true },
+	{ "id_field=id&id=123", "WHERE `id` = ?", "123", true },
+	{ "id_field=id&ids=123", "WHERE `id` = ?", "123", true },
+	{ "id_field=id&ids=123,456", "WHERE `id` IN (?,?)", "123,456", true },
 	{ "id_field=id", "", "", true },
 }
 
@@ -224,7 +226,7 @@ func idListToA(idlist []interface{}) (string, error) {
 
 func mkIdClause_Checker(cx *testContext, tc *idclause_TC) {
 	params := fakeParams(tc.paramstr)
-	res, idlist := mkIdClause(params)
+	res, idlist := mkIdClause(sqliteDialect{}, newRecordQuery(params), 1)
 	cx.assertEqual(tc.xres, res, "mkIdClause query string")
 
 	resids, err := idListToA(idlist)
@@ -240,29 +242,6 @@ func Test_mkIdClause(t *testing.T) {
 	}
 }
 
-// ----- unit tests for mkIdClauseUpdate()
-
-var mkIdClauseUpdate_Tab = []idclause_TC {
-	{ "id_field=id&id=123", "WHERE id = 123", "", true },
-	{ "id_field=id&ids=123", "WHERE id in (123)", "", true },
-	{ "id_field=id&ids=123,456", "WHERE id in (123,456)", "", true },
-	{ "id_field=id", "", "", true },
-}
-
-func mkIdClauseUpdate_Checker(cx *testContext, tc *idclause_TC) {
-	params := fakeParams(tc.paramstr)
-	res := mkIdClauseUpdate(params)
-	cx.assertEqual(tc.xres, res, "result")
-}
-
-func Test_mkIdClauseUpdate(t *testing.T) {
-	cx := newTestContext(t, "mkIdClauseUpdate_Tab")
-	for _, tc := range mkIdClauseUpdate_Tab {
-		mkIdClauseUpdate_Checker(cx, &tc)
-		cx.bump()
-	}
-}
-
 // ----- unit tests for idTypesToInterface()
 
 type idTypesToInterface_TC struct {
@@ -306,17 +285,17 @@ type mkSelectString_TC struct {
 
 var mkSelectString_Tab = []mkSelectString_TC {
 	{"table_name=T&id_field=id&id=456&fields=a&limit=1&offset=0",
-		"SELECT id,a FROM T WHERE id = ? LIMIT 1 OFFSET 0",
+		"SELECT `id`,`a` FROM `T` WHERE `id` = ? ORDER BY `id` LIMIT 1 OFFSET 0",
 		"456", true},
 	{"table_name=T&id_field=id&ids=123,456&fields=a,b,c&limit=1&offset=0",
-		"SELECT id,a,b,c FROM T WHERE id in (?,?) LIMIT 1 OFFSET 0",
+		"SELECT `id`,`a`,`b`,`c` FROM `T` WHERE `id` IN (?,?) ORDER BY `id` LIMIT 1 OFFSET 0",
 		"123,456", true},
 }
 
 // run one tc case
 func mkSelectString_Checker(cx *testContext, tc *mkSelectString_TC) {
 	params := fakeParams(tc.paramstr)
-	res, idlist := mkSelectString(params)
+	res, idlist := mkSelectString(sqliteDialect{}, newRecordQuery(params))
 	if !cx.assertEqual(tc.xres, res, "result") {
 		return
 	}
@@ -509,6 +488,49 @@ func Test_validateRecords(t *testing.T) {
 	}
 }
 
+// ----- unit tests for the field list returned by validateRecords()
+
+// inputs and outputs for one validateRecords_fields testcase.
+// xfields lists the expected offending fields, as RECORD:FIELD:RULE
+// items separated by spaces.
+type validateRecords_fields_TC struct {
+	desc string
+	xfields string
+}
+
+// table of validateRecords_fields testcases.
+var validateRecords_fields_Tab = []validateRecords_fields_TC {
+	{"k1,k2|v1,v2", ""},
+	{"k1,,k3|v1,v2,v3", "0::identifier"},
+	{"k1,k2|v1;k3,k3|v3,v4", "0::length 1:k3:duplicate"},
+	{"k1|v1;1x,k2,y z|v1,v2,v3;k4|v4", "1:1x:identifier 1:y z:identifier"},
+}
+
+// run one testcase for the field list from validateRecords.
+func validateRecords_fields_Checker(cx *testContext,
+		tc *validateRecords_fields_TC) {
+	err := validateRecords(mkRecords(tc.desc))
+	fields := errorFields(err)
+	items := make([]string, len(fields))
+	for i, f := range fields {
+		items[i] = fmt.Sprintf("%d:%s:%s", f.Record, f.Field, f.Rule)
+	}
+	cx.assertEqual(tc.xfields, strings.Join(items, " "), "fields")
+	if err != nil {
+		code, _ := classifyError(badStat, err)
+		cx.assertEqual(http.StatusUnprocessableEntity, code, "status")
+	}
+}
+
+// the validateRecords_fields test suite.
+func Test_validateRecords_fields(t *testing.T) {
+	cx := newTestContext(t, "validateRecords_fields_Tab")
+	for _, tc := range validateRecords_fields_Tab {
+		validateRecords_fields_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
 // ----- unit tests for convValues()
 
 // inputs and outputs for one convValues testcase.
@@ -632,7 +654,7 @@ var createDbRecords_Tab = []apiCall_TC {
 		getDbRecordHandler,
 		http.MethodGet,
 		`/test/db/_table/tabname|table_name=bundles&id=123|fields=name,uri`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 	{"get record 1",
 		getDbRecordHandler,
 		http.MethodGet,
@@ -654,7 +676,7 @@ var createDbRecords_Tab = []apiCall_TC {
 		getDbRecordHandler,
 		http.MethodGet,
 		`/test/db/_table/tabname|table_name=bundles&id=123|fields=name,uri,bogus`,
-		http.StatusBadRequest, noCheck},
+		http.StatusUnprocessableEntity, noCheck},
 
 	{"delete records 2,4",
 		deleteDbRecordsHandler,
@@ -678,19 +700,19 @@ var createDbRecords_Tab = []apiCall_TC {
 		deleteDbRecordHandler,
 		http.MethodDelete,
 		`/test/db/_table/tabname|table_name=bogus|id=1`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 
 	{"get record 2 expecting failure",
 		getDbRecordHandler,
 		http.MethodGet,
 		`/test/db/_table/tabname|table_name=bundles&id=2`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 
 	{"get record 4 expecting failure",
 		getDbRecordHandler,
 		http.MethodGet,
 		`/test/db/_table/tabname|table_name=bundles&id=4`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 
 	{"delete record 1",
 		deleteDbRecordHandler,
@@ -702,13 +724,13 @@ var createDbRecords_Tab = []apiCall_TC {
 		deleteDbRecordHandler,
 		http.MethodDelete,
 		`/test/db/_table/tabname|table_name=bundles&id=1`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 
 	{"get record 1 expecting failure",
 		getDbRecordHandler,
 		http.MethodGet,
 		`/test/db/_table/tabname|table_name=bundles&id=1`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 
 	{"update records missing id",
 		updateDbRecordsHandler,
@@ -738,7 +760,7 @@ var createDbRecords_Tab = []apiCall_TC {
 		updateDbRecordsHandler,
 		http.MethodPatch,
 		`/test/db/_table/tabname|table_name=xxx&id=1||{"records":[]}`,
-		http.StatusBadRequest, noCheck},
+		http.StatusUnprocessableEntity, noCheck},
 
 	{"update record missing id",
 		updateDbRecordHandler,
@@ -768,7 +790,7 @@ var createDbRecords_Tab = []apiCall_TC {
 		createDbRecordsHandler,
 		http.MethodPost,
 		`/test/db/_table/tabname|table_name=bundles||{"records":[{"keys":["name","bogus"],"values":["abc3","xyz3"]}]}`,
-		http.StatusBadRequest, noCheck},
+		http.StatusUnprocessableEntity, noCheck},
 
 	{"get records missing table_name",
 		getDbRecordsHandler,
@@ -804,7 +826,7 @@ var createDbRecords_Tab = []apiCall_TC {
 		createDbRecordsHandler,
 		http.MethodPost,
 		`/test/db/_table/tabname|table_name=xxx||{"records":[{"keys":["name","uri"],"values":["abc4","xyz4","superfluous"]}]}`,
-		http.StatusBadRequest, noCheck},
+		http.StatusUnprocessableEntity, noCheck},
 }
 
 // the handlers must be called in a certain order, in order for the
@@ -854,23 +876,25 @@ func Test_getDbTablesHandler(t *testing.T) {
 
 type tablesQuery_TC struct {
 	self string
-	tableName string
-	fieldName string
+	badDb bool
 	xcode int
 }
 
 var tablesQuery_Tab = []tablesQuery_TC {
-	{"xyz", "bogus_table", "name", http.StatusBadRequest},
-	{"xyz", "_tables_", "bogus_field", http.StatusBadRequest},
-	{"xyz", "_tables_", "name", http.StatusOK},
+	{"xyz", true, http.StatusBadRequest},
+	{"xyz", false, http.StatusOK},
 }
 
 func tablesQuery_Checker(cx *testContext, tc *tablesQuery_TC) {
-	result := tablesQuery(tc.self, tc.tableName, tc.fieldName)
+	tdb := db
+	if tc.badDb {
+		tdb = mkBadDb()
+	}
+	result := tablesQuery(tdb, tc.self)
 	cx.assertEqual(tc.xcode, result.code, "returned code")
 }
 
-func Test_tablesQuery_bogusField(t *testing.T) {
+func Test_tablesQuery(t *testing.T) {
 	cx := newTestContext(t, "tablesQuery_Tab")
 	for _, tc := range tablesQuery_Tab {
 		tablesQuery_Checker(cx, &tc)
@@ -1107,7 +1131,7 @@ var createDbTable_Tab = []apiCall_TC {
 		createDbTableHandler,
 		http.MethodPost,
 		`/test/db/_schema/ABC|table_name=ABC||`+users_schema,
-		http.StatusBadRequest, noCheck},
+		http.StatusConflict, noCheck},
 	{"create record in ABC",
 		createDbRecordsHandler,
 		http.MethodPost,
@@ -1143,7 +1167,7 @@ var deleteDbTable_Tab = []apiCall_TC {
 		deleteDbTableHandler,
 		http.MethodDelete,
 		`/test/db/_schema/ABCD|table_name=ABCD`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 	{"create table ABCD expecting success",
 		createDbTableHandler,
 		http.MethodPost,
@@ -1158,7 +1182,7 @@ var deleteDbTable_Tab = []apiCall_TC {
 		deleteDbTableHandler,
 		http.MethodDelete,
 		`/test/db/_schema/ABCD|table_name=ABCD`,
-		http.StatusBadRequest, noCheck},
+		http.StatusNotFound, noCheck},
 }
 
 // the deleteDbTable test suite.  run all deleteDbTable testcases.
@@ -1172,40 +1196,45 @@ func Test_deleteDbTableHandler(t *testing.T) {
 type schemaQuery_TC struct {
 	self string
 	tableName string
-	fieldName string
-	selector string
-	item string
 	xcode int
-	xdata string
+	xexists bool
+	xcolumns string
 }
 
 // table of schemaQuery testcases.
 var schemaQuery_Tab = []schemaQuery_TC {
-	// a good request
-	{ "http://abc", "_tables_", "schema", "name", "users", http.StatusOK, "{users_schema SchemaResponse http://abc}" },
+	// a table that exists and is in the table of tables.
+	{ "http://abc", "bundles", http.StatusOK, true, "id,name,uri" },
 
-	// a good request
-	{ "http://abc", "_tables_", "schema", "name", "bundles", http.StatusOK, "{bundles_schema SchemaResponse http://abc}" },
+	// a table that is only in the table of tables.
+	{ "http://abc", "users", http.StatusOK, false, "" },
 
-	// bogus table
-	{ "http://abc", "bogus", "schema", "name", "users", http.StatusBadRequest, "xxx" },
+	// a table that is not in the table of tables.
+	{ "http://abc", "xxx", http.StatusOK, true, "id,name,uri" },
 
-	// bogus field
-	{ "http://abc", "_tables_", "schema", "bogus", "users", http.StatusBadRequest, "xxx" },
-
-	// bogus item
-	{ "http://abc", "_tables_", "schema", "name", "bogus", http.StatusBadRequest, "xxx" },
+	// bogus table
+	{ "http://abc", "bogus", http.StatusNotFound, false, "" },
 }
 
 // run one testcase for function schemaQuery.
 func schemaQuery_Checker(cx *testContext, tc *schemaQuery_TC) {
-	res := schemaQuery(tc.self, tc.tableName, tc.fieldName,
-			tc.selector, tc.item)
+	res := schemaQuery(db, tc.self, tc.tableName, true)
 	cx.assertEqual(tc.xcode, res.code, "returned code")
-	if tc.xcode == http.StatusOK {
-		dataStr := fmt.Sprintf("%v", res.data)
-		cx.assertEqual(tc.xdata, dataStr, "returned data")
+	if tc.xcode != http.StatusOK {
+		return
 	}
+	desc, ok := res.data.(SchemaResponse)
+	if !cx.assertTrue(ok, "response type") {
+		return
+	}
+	cx.assertEqual(tc.self, desc.Self, "self")
+	cx.assertEqual(tc.tableName, desc.Name, "name")
+	cx.assertEqual(tc.xexists, desc.Exists, "exists")
+	names := []string{}
+	for _, col := range desc.Columns {
+		names = append(names, col.Name)
+	}
+	cx.assertEqual(tc.xcolumns, strings.Join(names, ","), "columns")
 }
 
 // the schemaQuery test suite.  run all schemaQuery testcases.
@@ -1235,6 +1264,16 @@ var describeDbTable_Tab = []apiCall_TC {
 		describeDbTableHandler,
 		http.MethodGet,
 		`/test/db/_schema/bogus|table_name=bogus`,
+		http.StatusNotFound, noCheck},
+	{"get schema with refresh",
+		describeDbTableHandler,
+		http.MethodGet,
+		`/test/db/_schema/bundles|table_name=bundles|refresh=true`,
+		http.StatusOK, noCheck},
+	{"get schema with bad refresh",
+		describeDbTableHandler,
+		http.MethodGet,
+		`/test/db/_schema/bundles|table_name=bundles|refresh=maybe`,
 		http.StatusBadRequest, noCheck},
 	{"get schema for no table_name",
 		describeDbTableHandler,
@@ -1487,3 +1526,159 @@ func Test_listToMap(t *testing.T) {
 		cx.bump()	// increment testno.
 	}
 }
+
+// ----- unit tests for runDbBatchHandler().
+
+// table of runDbBatch testcases.
+var runDbBatch_Tab = []apiCall_TC {
+	{"setup: create table xxxbatch",
+		createDbTableHandler,
+		http.MethodPost,
+		`/test/db/_schema/xxxbatch|table_name=xxxbatch||`+users_schema,
+		http.StatusCreated, noCheck},
+	{"batch with malformed body",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||bogus`,
+		http.StatusBadRequest, noCheck},
+	{"batch with no operations",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[]}`,
+		http.StatusBadRequest, noCheck},
+	{"batch create, create with ref, update with ref, get with ref",
+		runDbBatchHandler,
+		http.MethodPost,
+		`http://localhost/test/db/_batch|||{"operations":[{"op":"create","table":"xxxbatch","record":{"keys":["name","uri"],"values":["hdr","uri-h"]}},{"op":"create","table":"xxxbatch","record":{"keys":["name","uri"],"values":["line",{"$ref":0}]}},{"op":"update","table":"xxxbatch","id":{"$ref":0},"record":{"keys":["uri"],"values":["uri-x"]}},{"op":"get","table":"xxxbatch","id":{"$ref":1},"fields":"name,uri"}]}`,
+		http.StatusOK,
+		`{"results":[{"op":"create","ids":[1],"numChanged":0,"kind":"BatchResult"},{"op":"create","ids":[2],"numChanged":0,"kind":"BatchResult"},{"op":"update","numChanged":1,"kind":"BatchResult"},{"op":"get","numChanged":0,"records":[{"keys":["name","uri"],"values":["line","1"],"kind":"KVResponse","self":"http://localhost/test/db/_table/xxxbatch/2"}],"kind":"BatchResult"}],"kind":"BatchResponse"}`},
+	{"batch rolled back after failing delete",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[{"op":"create","table":"xxxbatch","record":{"keys":["name","uri"],"values":["n3","u3"]}},{"op":"delete","table":"xxxbatch","id":1},{"op":"delete","table":"xxxbatch","id":1001}]}`,
+		http.StatusNotFound, noCheck},
+	{"record 1 still present after rollback",
+		getDbRecordHandler,
+		http.MethodGet,
+		`/test/db/_table/xxxbatch|table_name=xxxbatch&id=1|fields=name`,
+		http.StatusOK, noCheck},
+	{"record 3 absent after rollback",
+		getDbRecordHandler,
+		http.MethodGet,
+		`/test/db/_table/xxxbatch|table_name=xxxbatch&id=3|fields=name`,
+		http.StatusNotFound, noCheck},
+	{"batch with unknown operation",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[{"op":"bogus","table":"xxxbatch"}]}`,
+		http.StatusBadRequest, noCheck},
+	{"batch with forward ref",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[{"op":"get","table":"xxxbatch","id":{"$ref":1}},{"op":"create","table":"xxxbatch","record":{"keys":["name","uri"],"values":["n4","u4"]}}]}`,
+		http.StatusBadRequest, noCheck},
+	{"batch update with invalid key",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[{"op":"update","table":"xxxbatch","id":"1","record":{"keys":["bad key"],"values":["x"]}}]}`,
+		http.StatusUnprocessableEntity, noCheck},
+	{"batch create with no keys",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[{"op":"get","table":"xxxbatch","id":1},{"op":"create","table":"xxxbatch","record":{"keys":[],"values":[]}}]}`,
+		http.StatusUnprocessableEntity,
+		`{"code":422,"errorCode":"validation","message":"batch operation 1 (create): create: record has no keys","kind":"ErrorResponse"}`},
+	{"batch delete across ids",
+		runDbBatchHandler,
+		http.MethodPost,
+		`/test/db/_batch|||{"operations":[{"op":"delete","table":"xxxbatch","id":"1"},{"op":"delete","table":"xxxbatch","id":2}]}`,
+		http.StatusOK,
+		`{"results":[{"op":"delete","numChanged":1,"kind":"BatchResult"},{"op":"delete","numChanged":1,"kind":"BatchResult"}],"kind":"BatchResponse"}`},
+	{"teardown: delete table xxxbatch",
+		deleteDbTableHandler,
+		http.MethodDelete,
+		`/test/db/_schema/xxxbatch|table_name=xxxbatch`,
+		http.StatusOK, noCheck},
+}
+
+// the runDbBatch test suite.  run all runDbBatch testcases.
+func Test_runDbBatchHandler(t *testing.T) {
+	apiCalls_Runner(t, "runDbBatch_Tab", runDbBatch_Tab)
+}
+
+// ----- unit tests for the object record format.
+
+// table of object-format testcases.
+var objectFormat_Tab = []apiCall_TC {
+	{"setup: create table xxxobj",
+		createDbTableHandler,
+		http.MethodPost,
+		`/test/db/_schema/xxxobj|table_name=xxxobj||`+users_schema,
+		http.StatusCreated, noCheck},
+	{"create records in object format",
+		createDbRecordsHandler,
+		http.MethodPost,
+		`/test/db/_table/xxxobj|table_name=xxxobj|format=object|{"records":[{"name":"name-a","uri":"uri-a"},{"uri":"uri-b","name":"name-b"}]}`,
+		http.StatusCreated, `{"ids":[1,2],"kind":"Collection"}`},
+	{"create record in object format with invalid key",
+		createDbRecordsHandler,
+		http.MethodPost,
+		`/test/db/_table/xxxobj|table_name=xxxobj|format=object|{"records":[{"bad key":"x"}]}`,
+		http.StatusUnprocessableEntity, noCheck},
+	{"create record with invalid format",
+		createDbRecordsHandler,
+		http.MethodPost,
+		`/test/db/_table/xxxobj|table_name=xxxobj|format=xml|{"records":[]}`,
+		http.StatusBadRequest, noCheck},
+	{"get records in object format",
+		getDbRecordsHandler,
+		http.MethodGet,
+		`/test/db/_table/xxxobj|table_name=xxxobj|ids=1,2&fields=name,uri&format=object`,
+		http.StatusOK,
+		`{"records":[{"name":"name-a","uri":"uri-a"},{"name":"name-b","uri":"uri-b"}],"kind":"Collection"}`},
+	{"get record in object format",
+		getDbRecordHandler,
+		http.MethodGet,
+		`/test/db/_table/xxxobj|table_name=xxxobj&id=2|fields=uri&format=object`,
+		http.StatusOK,
+		`{"records":[{"uri":"uri-b"}],"kind":"Collection"}`},
+	{"get record in default format",
+		getDbRecordHandler,
+		http.MethodGet,
+		`http://localhost/test/db/_table/xxxobj|table_name=xxxobj&id=2|fields=uri`,
+		http.StatusOK,
+		`{"records":[{"keys":["uri"],"values":["uri-b"],"kind":"KVResponse","self":"http://localhost/test/db/_table/xxxobj/2"}],"kind":"Collection"}`},
+	{"teardown: delete table xxxobj",
+		deleteDbTableHandler,
+		http.MethodDelete,
+		`/test/db/_schema/xxxobj|table_name=xxxobj`,
+		http.StatusOK, noCheck},
+}
+
+// the object format test suite.  run all objectFormat testcases.
+func Test_objectFormat(t *testing.T) {
+	apiCalls_Runner(t, "objectFormat_Tab", objectFormat_Tab)
+}
+
+// ----- unit tests for structured validation errors thru the API.
+
+// table of field-level validation error testcases.
+var fieldErrors_Tab = []apiCall_TC {
+	{"create records with several bad fields",
+		createDbRecordsHandler,
+		http.MethodPost,
+		`/test/db/_table/bundles|table_name=bundles||{"records":[{"keys":["name","uri"],"values":["a","b"]},{"keys":["bad key","uri"],"values":["a"]}]}`,
+		http.StatusUnprocessableEntity,
+		`{"code":422,"errorCode":"validation","message":"Record 1 nkeys != nvalues; invalid key bad key","kind":"ErrorResponse","fields":[{"record":1,"field":"","rule":"length","message":"Record 1 nkeys != nvalues"},{"record":1,"field":"bad key","rule":"identifier","message":"invalid key bad key"}]}`},
+	{"get records with several bad params",
+		getDbRecordsHandler,
+		http.MethodGet,
+		`/test/db/_table/bundles|table_name=bundles|limit=x&offset=y`,
+		http.StatusBadRequest,
+		`{"code":400,"errorCode":"bad_request","message":"strconv.ParseInt: parsing \"x\": invalid syntax; strconv.ParseInt: parsing \"y\": invalid syntax","kind":"ErrorResponse","fields":[{"record":-1,"field":"limit","rule":"param","message":"strconv.ParseInt: parsing \"x\": invalid syntax"},{"record":-1,"field":"offset","rule":"param","message":"strconv.ParseInt: parsing \"y\": invalid syntax"}]}`},
+}
+
+// the field errors test suite.  run all fieldErrors testcases.
+func Test_fieldErrors(t *testing.T) {
+	apiCalls_Runner(t, "fieldErrors_Tab", fieldErrors_Tab)
+}
@@ -0,0 +1,104 @@
+package apidCRUD
+
+// this module implements the health and readiness checks.
+// health means the plugin is alive and serving requests;
+// readiness means it is also able to do useful work.
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// readyCheck is one named readiness check.
+type readyCheck struct {
+	name string
+	check func(db dbType) error
+}
+
+// readyChecks are the checks done by getDbReadyHandler, in order.
+var readyChecks = []readyCheck{
+	{"db", checkDbPing},
+	{"catalog", checkCatalog},
+	{"migrations", checkMigrations},
+}
+
+// checkDbPing() checks that the database can be reached.
+func checkDbPing(db dbType) error {
+	return db.storage().Ping()
+}
+
+// checkCatalog() checks that the table of tables exists.
+// backends not reached thru database/sql keep their own catalog.
+func checkCatalog(db dbType) error {
+	if !db.isSQL() {
+		return nil
+	}
+	var n int
+	err := db.handle.QueryRowContext(db.context(),
+		"select count(*) from sqlite_master where type = 'table' and name = ?",
+		tableOfTables).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no table %s", tableOfTables)
+	}
+	return nil
+}
+
+// checkMigrations() checks that the catalog schema is at least
+// the version this code requires.
+func checkMigrations(db dbType) error {
+	if !db.isSQL() {
+		return nil
+	}
+	version, err := getCatalogVersion(db)
+	if err != nil {
+		return err
+	}
+	if version < catalogVersion {
+		return fmt.Errorf("catalog version is %d, need %d",
+			version, catalogVersion)
+	}
+	return nil
+}
+
+// runReadyChecks() runs all the readiness checks on the given database.
+// it returns the results, and whether all checks passed.
+// a check is skipped if an earlier check failed.
+func runReadyChecks(db dbType) ([]ReadyCheck, bool) {
+	ret := make([]ReadyCheck, len(readyChecks))
+	ok := true
+	for i, rc := range readyChecks {
+		ret[i] = ReadyCheck{Name: rc.name}
+		if !ok {
+			ret[i].Message = "skipped"
+			continue
+		}
+		if err := rc.check(db); err != nil {
+			ret[i].Message = err.Error()
+			ok = false
+			continue
+		}
+		ret[i].Ok = true
+	}
+	return ret, ok
+}
+
+// getDbHealthHandler handles GET requests on /db/_health .
+func getDbHealthHandler(harg *apiHandlerArg) apiHandlerRet {
+	return apiHandlerRet{http.StatusOK,
+		HealthResponse{"ok", "HealthResponse"}}
+}
+
+// getDbReadyHandler handles GET requests on /db/_ready .
+// the status is 503 if any check fails.
+func getDbReadyHandler(harg *apiHandlerArg) apiHandlerRet {
+	checks, ok := runReadyChecks(harg.db())
+	if !ok {
+		return apiHandlerRet{http.StatusServiceUnavailable,
+			ReadyResponse{"not ready", checks, "ReadyResponse"}}
+	}
+	return apiHandlerRet{http.StatusOK,
+		ReadyResponse{"ready", checks, "ReadyResponse"}}
+}
@@ -0,0 +1,75 @@
+package apidCRUD
+
+import (
+	"testing"
+	"net/http"
+)
+
+// ----- unit tests for getDbHealthHandler()
+
+func Test_getDbHealthHandler(t *testing.T) {
+	cx := newTestContext(t)
+	res := getDbHealthHandler(parseHandlerArg(http.MethodGet, "/db/_health"))
+	cx.assertEqual(http.StatusOK, res.code, "returned code")
+}
+
+// ----- unit tests for runReadyChecks()
+
+// inputs and outputs for one runReadyChecks testcase.
+type runReadyChecks_TC struct {
+	db dbType
+	xok bool
+	xchecks string	// one char per check: + ok, - failed, s skipped.
+}
+
+// run one testcase for function runReadyChecks.
+func runReadyChecks_Checker(cx *testContext, tc *runReadyChecks_TC) {
+	checks, ok := runReadyChecks(tc.db)
+	cx.assertEqual(tc.xok, ok, "ok")
+	res := ""
+	for _, c := range checks {
+		switch {
+		case c.Ok:
+			res += "+"
+		case c.Message == "skipped":
+			res += "s"
+		default:
+			res += "-"
+		}
+	}
+	cx.assertEqual(tc.xchecks, res, "checks")
+}
+
+// the runReadyChecks test suite.  run all runReadyChecks testcases.
+func Test_runReadyChecks(t *testing.T) {
+	empty, cleanup := mkTempDb(tempDbOpts{})
+	defer cleanup()
+	tab := []runReadyChecks_TC {
+		{ db, true, "+++" },
+		{ mkBadDb(), false, "-ss" },
+		{ dbType{}, false, "-ss" },
+		{ empty, false, "+-s" },
+	}
+	cx := newTestContext(t, "runReadyChecks_Tab")
+	for _, tc := range tab {
+		runReadyChecks_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for getDbReadyHandler()
+
+func Test_getDbReadyHandler(t *testing.T) {
+	cx := newTestContext(t)
+	res := getDbReadyHandler(parseHandlerArg(http.MethodGet, "/db/_ready"))
+	cx.assertEqual(http.StatusOK, res.code, "returned code")
+	cx.bump()
+
+	save := db
+	defer func() {
+		db = save
+	}()
+	db = mkBadDb()
+	res = getDbReadyHandler(parseHandlerArg(http.MethodGet, "/db/_ready"))
+	cx.assertEqual(http.StatusServiceUnavailable, res.code, "returned code")
+}
@@ -1,10 +1,20 @@
 package apidCRUD
 
-import "github.com/apid/apid-core"
+import (
+	"database/sql"
+
+	"github.com/apid/apid-core"
+	"github.com/mattn/go-sqlite3"
+)
 
 // init() is magically called at startup by the go runtime.
 // we take this opportunity to tell apid to call our initPlugin()
 // function when it does InitializePlugins().
+// we also register the sqlite driver that sets our pragmas
+// on each connection it opens.
 func init() {
 	apid.RegisterPlugin(initPlugin)
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: setSqlitePragmas,
+	})
 }
@@ -0,0 +1,287 @@
+package apidCRUD
+
+// this module collects metrics on the API calls and the database,
+// and renders them in the Prometheus text exposition format.
+// see https://prometheus.io/docs/instrumenting/exposition_formats/ .
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsType is the media type of the metrics text format.
+const metricsType = "text/plain; version=0.0.4; charset=utf-8"
+
+// latencyBuckets are the upper bounds, in seconds,
+// of the request latency histogram buckets.
+var latencyBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// routeKey identifies a route, method and status, for request counts.
+type routeKey struct {
+	route string
+	method string
+	status int
+}
+
+// metricMethods are the request methods counted by name.
+// others are counted as "other", so that clients can't add
+// series at will.
+var metricMethods = map[string]bool{
+	http.MethodGet: true,
+	http.MethodHead: true,
+	http.MethodPost: true,
+	http.MethodPut: true,
+	http.MethodPatch: true,
+	http.MethodDelete: true,
+	http.MethodOptions: true,
+}
+
+// histogram is a cumulative latency histogram.
+// counts[i] is the number of observations <= latencyBuckets[i].
+type histogram struct {
+	counts []uint64
+	sum float64
+	count uint64
+}
+
+// observe() adds one observation, in seconds, to the histogram.
+func (h *histogram) observe(secs float64) {
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+// apiMetrics holds the metrics collected since startup.
+// it must be accessed with lock held.
+type apiMetrics struct {
+	lock sync.Mutex
+	requests map[routeKey]uint64
+	tableRequests map[tableKey]uint64
+	errors map[int]uint64
+	latency map[string]*histogram
+	rowsRead map[tableKey]uint64
+	rowsWritten map[tableKey]uint64
+}
+
+// metrics is our global metrics state.
+var metrics = newApiMetrics()
+
+// rollbackCount is the number of transactions rolled back since startup.
+// it must be accessed atomically.
+var rollbackCount uint64
+
+// newApiMetrics() returns an empty apiMetrics object.
+func newApiMetrics() *apiMetrics {
+	return &apiMetrics{
+		requests: map[routeKey]uint64{},
+		tableRequests: map[tableKey]uint64{},
+		errors: map[int]uint64{},
+		latency: map[string]*histogram{},
+		rowsRead: map[tableKey]uint64{},
+		rowsWritten: map[tableKey]uint64{},
+	}
+}
+
+// noteRollback() counts a transaction rollback.
+func noteRollback() {
+	atomic.AddUint64(&rollbackCount, 1)
+}
+
+// isReadMethod() returns true iff the rows reported by a call
+// of the given method were read, rather than written.
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// observe() records one finished API call.
+// route is the matched path pattern, or empty if none matched.
+// dbName is the name of the database (empty for the default database),
+// and table the name of the table, if any.  the table is counted
+// only if the call succeeded, since the name of a missing table
+// would add a series.
+func (m *apiMetrics) observe(route string,
+		dbName string,
+		table string,
+		method string,
+		status int,
+		duration time.Duration,
+		rows int) {
+	if route == "" {
+		route = "none"
+	}
+	if !metricMethods[method] {
+		method = "other"
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.requests[routeKey{route, method, status}]++
+	if status >= badStat {
+		m.errors[status]++
+	}
+	h, ok := m.latency[route]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[route] = h
+	}
+	h.observe(duration.Seconds())
+
+	if table == "" || status >= badStat {
+		return
+	}
+	key := tableKey{dbName, table}
+	m.tableRequests[key]++
+	if isReadMethod(method) {
+		m.rowsRead[key] += uint64(rows)
+	} else {
+		m.rowsWritten[key] += uint64(rows)
+	}
+}
+
+// escapeLabel() escapes a label value for the text format.
+func escapeLabel(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val)
+}
+
+// writeMetricHeader() writes the HELP and TYPE lines of a metric.
+func writeMetricHeader(buf *bytes.Buffer, name, mtype, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, mtype)
+}
+
+// writeTableCounter() writes a counter labelled by database and table.
+// the default database's label is empty.
+func writeTableCounter(buf *bytes.Buffer,
+		name string,
+		help string,
+		vals map[tableKey]uint64) {
+	writeMetricHeader(buf, name, "counter", help)
+	keys := make([]tableKey, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].db != keys[j].db {
+			return keys[i].db < keys[j].db
+		}
+		return keys[i].table < keys[j].table
+	})
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s{db=\"%s\",table=\"%s\"} %d\n",
+			name, escapeLabel(k.db), escapeLabel(k.table), vals[k])
+	}
+}
+
+// render() returns the collected metrics, plus the given database
+// and process metrics, in the text exposition format.
+func (m *apiMetrics) render(db dbType) string {
+	var buf bytes.Buffer
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeMetricHeader(&buf, "apidcrud_requests_total", "counter",
+		"API requests, by route, method and status.")
+	rkeys := make([]routeKey, 0, len(m.requests))
+	for k := range m.requests {
+		rkeys = append(rkeys, k)
+	}
+	sort.Slice(rkeys, func(i, j int) bool {
+		a, b := rkeys[i], rkeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, k := range rkeys {
+		fmt.Fprintf(&buf,
+			"apidcrud_requests_total{route=\"%s\",method=\"%s\",status=\"%d\"} %d\n",
+			escapeLabel(k.route), k.method, k.status, m.requests[k])
+	}
+
+	writeTableCounter(&buf, "apidcrud_table_requests_total",
+		"Successful API requests, by database and table.", m.tableRequests)
+
+	writeMetricHeader(&buf, "apidcrud_errors_total", "counter",
+		"API requests that failed, by status.")
+	statuses := make([]int, 0, len(m.errors))
+	for s := range m.errors {
+		statuses = append(statuses, s)
+	}
+	sort.Ints(statuses)
+	for _, s := range statuses {
+		fmt.Fprintf(&buf, "apidcrud_errors_total{status=\"%d\"} %d\n",
+			s, m.errors[s])
+	}
+
+	writeMetricHeader(&buf, "apidcrud_request_duration_seconds", "histogram",
+		"API request latency, by route.")
+	routes := make([]string, 0, len(m.latency))
+	for r := range m.latency {
+		routes = append(routes, r)
+	}
+	sort.Strings(routes)
+	for _, r := range routes {
+		h := m.latency[r]
+		er := escapeLabel(r)
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(&buf,
+				"apidcrud_request_duration_seconds_bucket{route=\"%s\",le=\"%g\"} %d\n",
+				er, le, h.counts[i])
+		}
+		fmt.Fprintf(&buf,
+			"apidcrud_request_duration_seconds_bucket{route=\"%s\",le=\"+Inf\"} %d\n",
+			er, h.count)
+		fmt.Fprintf(&buf,
+			"apidcrud_request_duration_seconds_sum{route=\"%s\"} %g\n",
+			er, h.sum)
+		fmt.Fprintf(&buf,
+			"apidcrud_request_duration_seconds_count{route=\"%s\"} %d\n",
+			er, h.count)
+	}
+
+	writeTableCounter(&buf, "apidcrud_rows_read_total",
+		"Rows returned, by database and table.", m.rowsRead)
+	writeTableCounter(&buf, "apidcrud_rows_written_total",
+		"Rows created, changed or deleted, by database and table.", m.rowsWritten)
+
+	if db.handle != nil {
+		stats := db.handle.Stats()
+		writeMetricHeader(&buf, "apidcrud_db_open_connections", "gauge",
+			"Open database connections.")
+		fmt.Fprintf(&buf, "apidcrud_db_open_connections %d\n",
+			stats.OpenConnections)
+		writeMetricHeader(&buf, "apidcrud_db_in_use_connections", "gauge",
+			"Database connections in use.")
+		fmt.Fprintf(&buf, "apidcrud_db_in_use_connections %d\n",
+			stats.InUse)
+		writeMetricHeader(&buf, "apidcrud_db_idle_connections", "gauge",
+			"Idle database connections.")
+		fmt.Fprintf(&buf, "apidcrud_db_idle_connections %d\n",
+			stats.Idle)
+	}
+
+	writeMetricHeader(&buf, "apidcrud_tx_rollbacks_total", "counter",
+		"Database transactions rolled back.")
+	fmt.Fprintf(&buf, "apidcrud_tx_rollbacks_total %d\n",
+		atomic.LoadUint64(&rollbackCount))
+
+	writeMetricHeader(&buf, "apidcrud_panics_total", "counter",
+		"Panics recovered in API calls.")
+	fmt.Fprintf(&buf, "apidcrud_panics_total %d\n", panicsRecovered())
+
+	return buf.String()
+}
@@ -0,0 +1,120 @@
+package apidCRUD
+
+import (
+	"testing"
+	"strings"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// ----- unit tests for apiMetrics observe() and render()
+
+// inputs for one observed API call.
+type metricsCall struct {
+	route string
+	dbName string
+	table string
+	method string
+	status int
+	duration time.Duration
+	rows int
+}
+
+// the calls observed by Test_apiMetrics.
+var metricsCalls = []metricsCall {
+	{ "/db/_table/{table_name}", "", "users", http.MethodGet,
+		http.StatusOK, 3 * time.Millisecond, 2 },
+	{ "/db/_table/{table_name}", "", "users", http.MethodGet,
+		http.StatusOK, 300 * time.Millisecond, 5 },
+	{ "/db/_table/{table_name}", "", "users", http.MethodPost,
+		http.StatusCreated, 20 * time.Millisecond, 3 },
+	{ "/db/_table/{table_name}", "", "nosuch", http.MethodGet,
+		http.StatusNotFound, time.Millisecond, 0 },
+	{ "/db/{db_name}/_table/{table_name}", "a", "users", http.MethodGet,
+		http.StatusOK, time.Millisecond, 1 },
+	{ "/db/_table/{table_name}", "", "users", "BREW",
+		http.StatusMethodNotAllowed, time.Millisecond, 0 },
+	{ "", "", "", http.MethodGet,
+		http.StatusNotFound, time.Millisecond, 0 },
+}
+
+// lines expected in the rendered metrics.
+var metricsLines = []string {
+	`apidcrud_requests_total{route="/db/_table/{table_name}",method="GET",status="200"} 2`,
+	`apidcrud_requests_total{route="/db/_table/{table_name}",method="POST",status="201"} 1`,
+	`apidcrud_requests_total{route="none",method="GET",status="404"} 1`,
+	`apidcrud_requests_total{route="/db/_table/{table_name}",method="other",status="405"} 1`,
+	`apidcrud_table_requests_total{db="",table="users"} 3`,
+	`apidcrud_table_requests_total{db="a",table="users"} 1`,
+	`apidcrud_errors_total{status="404"} 2`,
+	`apidcrud_request_duration_seconds_bucket{route="/db/_table/{table_name}",le="0.005"} 3`,
+	`apidcrud_request_duration_seconds_bucket{route="/db/_table/{table_name}",le="0.25"} 4`,
+	`apidcrud_request_duration_seconds_bucket{route="/db/_table/{table_name}",le="+Inf"} 5`,
+	`apidcrud_request_duration_seconds_count{route="/db/_table/{table_name}"} 5`,
+	`apidcrud_rows_read_total{db="",table="users"} 7`,
+	`apidcrud_rows_read_total{db="a",table="users"} 1`,
+	`apidcrud_rows_written_total{db="",table="users"} 3`,
+	`# TYPE apidcrud_db_open_connections gauge`,
+	`# TYPE apidcrud_tx_rollbacks_total counter`,
+	`# TYPE apidcrud_panics_total counter`,
+}
+
+func Test_apiMetrics(t *testing.T) {
+	cx := newTestContext(t, "metricsLines")
+	m := newApiMetrics()
+	for _, c := range metricsCalls {
+		m.observe(c.route, c.dbName, c.table, c.method, c.status,
+			c.duration, c.rows)
+	}
+	text := m.render(db)
+	lines := map[string]bool{}
+	for _, line := range strings.Split(text, "\n") {
+		lines[line] = true
+	}
+	for _, xline := range metricsLines {
+		cx.assertTrue(lines[xline], "missing line: " + xline)
+		cx.bump()
+	}
+	cx.assertTrue(!strings.Contains(text, `table="nosuch"`),
+		"failed call s/b not counted by table")
+}
+
+// ----- unit tests for escapeLabel()
+
+func Test_escapeLabel(t *testing.T) {
+	cx := newTestContext(t)
+	cx.assertEqual(`a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"), "result")
+}
+
+// ----- unit tests for the rollback counter.
+
+func Test_noteRollback(t *testing.T) {
+	cx := newTestContext(t)
+	before := rollbackCount
+	err := execN(db, newXCmd("select nosuchcol from nosuchtable"))
+	cx.assertTrue(err != nil, "execN s/b failed")
+	cx.bump()
+	cx.assertEqual(before + 1, rollbackCount, "rollback count")
+}
+
+// ----- unit tests for getDbMetricsHandler()
+
+func Test_getDbMetricsHandler(t *testing.T) {
+	cx := newTestContext(t)
+	ws := newApiWiring("", []apiDesc{
+		{ "/db/_metrics", http.MethodGet, getDbMetricsHandler, nil },
+	})
+	r, _ := http.NewRequest(http.MethodGet, "/db/_metrics",
+		strings.NewReader(""))
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	if !cx.assertEqual(http.StatusOK, w.Code, "returned code") {
+		return
+	}
+	cx.assertEqual(metricsType, w.Header().Get("Content-Type"),
+		"Content-Type")
+	cx.bump()
+	cx.assertTrue(strings.Contains(w.Body.String(),
+		"# TYPE apidcrud_requests_total counter"), "body")
+}
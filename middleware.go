@@ -0,0 +1,146 @@
+package apidCRUD
+
+// this module defines middleware for apiHandler functions.
+// a middleware wraps an apiHandler to add behaviour that is common
+// to many APIs (logging, recovery, ...), so that it need not be
+// repeated in each handler.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"crypto/rand"
+	"encoding/hex"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/apid/apid-core"
+)
+
+// apiMiddleware is the type of a function that wraps an apiHandler,
+// returning a new apiHandler.
+type apiMiddleware func(apiHandler) apiHandler
+
+// defaultMiddleware is the global middleware applied to every API
+// registered by the plugin, outermost first.
+var defaultMiddleware = []apiMiddleware{
+	logMiddleware,
+	recoverMiddleware,
+	timeoutMiddleware,
+	dbMiddleware,
+}
+
+// chainMiddleware() wraps the given handler in the given middlewares.
+// the first middleware in the list is the outermost, so it sees
+// the call first and the result last.
+func chainMiddleware(handler apiHandler, mws ...apiMiddleware) apiHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+}
+
+// logMiddleware() logs each API call and its result code,
+// and the debug message, if any, given to errorRet().
+func logMiddleware(next apiHandler) apiHandler {
+	return func(harg *apiHandlerArg) apiHandlerRet {
+		lg := harg.log()
+		lg.Debugf("in API call: method=%s path=%s",
+			harg.req.Method, harg.req.URL.Path)
+		res := next(harg)
+		if erec, ok := res.data.(ErrorResponse); ok && erec.dmsg != "" {
+			lg.Debugf("errorRet %d [%s], %s",
+				res.code, erec.Message, erec.dmsg)
+		}
+		lg.Debugf("in API call: code=%d", res.code)
+		return res
+	}
+}
+
+// recoverMiddleware() turns a panic in the wrapped handler
+// into a 500 error return.
+func recoverMiddleware(next apiHandler) apiHandler {
+	return func(harg *apiHandlerArg) (res apiHandlerRet) {
+		defer func() {
+			if r := recover(); r != nil {
+				res = errorRet(http.StatusInternalServerError,
+					recoverPanic(harg.log(), r), "")
+			}
+		}()
+		return next(harg)
+	}
+}
+
+// timeoutMiddleware() limits the time the wrapped handler's
+// statements may run to queryTimeout, or to adminTimeout for the
+// admin APIs that copy a whole database.  if the request's context
+// ends (by timing out, or by the client going away) and the handler
+// fails, the failure is reported as a timeout or cancellation.
+func timeoutMiddleware(next apiHandler) apiHandler {
+	return func(harg *apiHandlerArg) apiHandlerRet {
+		ctx := harg.req.Context()
+		timeout := requestTimeout(harg.req.URL.Path)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+			harg.req = harg.req.WithContext(ctx)
+		}
+		res := next(harg)
+		if err := ctx.Err(); err != nil && res.code >= badStat {
+			return errorRet(res.code, contextError(err, timeout), "")
+		}
+		return res
+	}
+}
+
+// adminCopyOps are the _admin operations that copy a whole database.
+var adminCopyOps = map[string]bool{
+	"dump": true,
+	"load": true,
+	"backup": true,
+	"restore": true,
+}
+
+// requestTimeout() returns the timeout for a request with the given
+// URL path: adminTimeout for the _admin operations in adminCopyOps,
+// else queryTimeout.
+func requestTimeout(path string) time.Duration {
+	parts := splitPath(path)
+	n := len(parts)
+	if n >= 2 && parts[n-2] == "_admin" && adminCopyOps[parts[n-1]] {
+		return adminTimeout
+	}
+	return queryTimeout
+}
+
+// panicCount is the number of panics recovered since startup.
+// it must be accessed atomically.
+var panicCount uint64
+
+// panicsRecovered() returns the number of panics recovered since startup.
+func panicsRecovered() uint64 {
+	return atomic.LoadUint64(&panicCount)
+}
+
+// recoverPanic() handles the value returned by recover() after a panic
+// in an API call.  the panic and its stack trace are logged with the
+// given logger, under a new correlation id, the event is counted,
+// and the error to report to the client is returned.
+func recoverPanic(lg apid.LogService, val interface{}) error {
+	atomic.AddUint64(&panicCount, 1)
+	corrId := newRandomId()
+	lg.Errorf("panic in API call, correlation id %s: %v\n%s",
+		corrId, val, debug.Stack())
+	return &recoveredError{corrId}
+}
+
+// newRandomId() returns a random id, in hex.
+func newRandomId() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,245 @@
+package apidCRUD
+
+import (
+	"testing"
+	"context"
+	"time"
+	"encoding/json"
+	"strings"
+	"net/http"
+	"net/http/httptest"
+)
+
+// ----- unit tests for chainMiddleware()
+
+// tagMiddleware() returns a middleware that appends the given tag
+// to the result data (a string) of the handler it wraps.
+func tagMiddleware(tag string) apiMiddleware {
+	return func(next apiHandler) apiHandler {
+		return func(harg *apiHandlerArg) apiHandlerRet {
+			res := next(harg)
+			res.data = res.data.(string) + tag
+			return res
+		}
+	}
+}
+
+// a dummy handler, returns "h".
+func tagHandler(harg *apiHandlerArg) apiHandlerRet {
+	return apiHandlerRet{http.StatusOK, "h"}
+}
+
+// inputs and outputs for one chainMiddleware testcase.
+type chainMiddleware_TC struct {
+	mws []apiMiddleware
+	xdata string
+}
+
+// table of chainMiddleware testcases.
+var chainMiddleware_Tab = []chainMiddleware_TC {
+	{ []apiMiddleware{}, "h" },
+	{ []apiMiddleware{tagMiddleware("a")}, "ha" },
+	{ []apiMiddleware{tagMiddleware("a"), tagMiddleware("b")}, "hba" },
+}
+
+// run one testcase for function chainMiddleware.
+func chainMiddleware_Checker(cx *testContext, tc *chainMiddleware_TC) {
+	h := chainMiddleware(tagHandler, tc.mws...)
+	res := h(parseHandlerArg(http.MethodGet, "/abc"))
+	cx.assertEqual(tc.xdata, res.data, "data")
+}
+
+// the chainMiddleware test suite.  run all chainMiddleware testcases.
+func Test_chainMiddleware(t *testing.T) {
+	cx := newTestContext(t, "chainMiddleware_Tab")
+	for _, tc := range chainMiddleware_Tab {
+		chainMiddleware_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for global and per-API middleware in the wiring.
+
+func Test_wiringMiddleware(t *testing.T) {
+	cx := newTestContext(t)
+	tab := []apiDesc {
+		{ "/abc", http.MethodGet, tagHandler,
+			[]apiMiddleware{tagMiddleware("p")} },
+		{ "/xyz", http.MethodGet, tagHandler, nil },
+	}
+	ws := newApiWiring("", tab, tagMiddleware("g"))
+	harg := parseHandlerArg(http.MethodGet, "/abc")
+	res := callApiMethod(ws.pathsMap["/abc"], http.MethodGet, harg)
+	cx.assertEqual("hpg", res.data, "per-API data")
+	res = callApiMethod(ws.pathsMap["/xyz"], http.MethodGet, harg)
+	cx.assertEqual("hg", res.data, "global data")
+}
+
+// ----- unit tests for recoverMiddleware()
+
+// a dummy handler that panics.
+func panicHandler(harg *apiHandlerArg) apiHandlerRet {
+	var vals []interface{}
+	return apiHandlerRet{http.StatusOK, vals[1]}
+}
+
+// recoverChecker() calls the given handler thru a wiring
+// with the given middleware, and checks that the panic was
+// reported as a 500 ErrorResponse with a correlation id,
+// and counted.
+func recoverChecker(cx *testContext, handler apiHandler, mws ...apiMiddleware) {
+	ws := newApiWiring("",
+		[]apiDesc{{ "/abc", http.MethodGet, handler, nil }},
+		mws...)
+	r, _ := http.NewRequest(http.MethodGet, "/abc", strings.NewReader(""))
+	w := httptest.NewRecorder()
+	before := panicsRecovered()
+	ws.ServeHTTP(w, r)
+	if !cx.assertEqual(http.StatusInternalServerError, w.Code,
+			"returned code") {
+		return
+	}
+	erec := &ErrorResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), erec)
+	if !cx.assertErrorNil(err, "body unmarshal") {
+		return
+	}
+	cx.assertEqual(errCodeInternal, erec.ErrorCode, "errorCode")
+	cx.assertTrue(erec.CorrelationId != "", "correlationId s/b set")
+	cx.assertEqual(before + 1, panicsRecovered(), "panic count")
+}
+
+func Test_recoverMiddleware(t *testing.T) {
+	cx := newTestContext(t)
+	recoverChecker(cx, panicHandler, defaultMiddleware...)
+}
+
+// a dummy handler, returns data whose conversion panics.
+func panicDataHandler(harg *apiHandlerArg) apiHandlerRet {
+	return apiHandlerRet{http.StatusOK, panicMarshaler{}}
+}
+
+// panicMarshaler is a type whose json conversion panics.
+type panicMarshaler struct {}
+
+func (panicMarshaler) MarshalJSON() ([]byte, error) {
+	panic("MarshalJSON")
+}
+
+func Test_pathDispatchRecover(t *testing.T) {
+	cx := newTestContext(t)
+	// no middleware; pathDispatch itself must recover.
+	recoverChecker(cx, panicHandler)
+	cx.bump()
+	// panic outside the handler.
+	recoverChecker(cx, panicDataHandler, defaultMiddleware...)
+}
+
+// ----- unit tests for timeoutMiddleware()
+
+// slowQueryHandler runs a query that takes much longer than
+// the timeouts used in these tests.
+func slowQueryHandler(harg *apiHandlerArg) apiHandlerRet {
+	qstring := `WITH RECURSIVE c(x) AS
+		(SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 100000000)
+		SELECT count(*) FROM c`
+	_, err := runQuery(harg.db(), "", qstring, []interface{}{})
+	if err != nil {
+		return errorRet(badStat, err, "after runQuery")
+	}
+	return apiHandlerRet{http.StatusOK, nil}
+}
+
+// inputs and outputs for one timeoutMiddleware testcase.
+type timeoutMiddleware_TC struct {
+	path string
+	timeout time.Duration
+	adminTimeout time.Duration
+	cancel bool
+	xcode int
+	xerrCode string
+}
+
+// table of timeoutMiddleware testcases.
+var timeoutMiddleware_Tab = []timeoutMiddleware_TC {
+	{ "/abc", 20 * time.Millisecond, 0, false,
+		http.StatusGatewayTimeout, errCodeTimeout },
+	{ "/abc", 0, 0, true,
+		http.StatusServiceUnavailable, errCodeUnavailable },
+	{ "/db/_admin/dump", 0, 20 * time.Millisecond, false,
+		http.StatusGatewayTimeout, errCodeTimeout },
+}
+
+// run one testcase for function timeoutMiddleware.
+func timeoutMiddleware_Checker(cx *testContext, tc *timeoutMiddleware_TC) {
+	queryTimeout = tc.timeout
+	adminTimeout = tc.adminTimeout
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if tc.cancel {
+		// the client went away before the query was run.
+		cancel()
+	}
+	harg := parseHandlerArg(http.MethodGet, tc.path)
+	harg.req = harg.req.WithContext(ctx)
+	res := timeoutMiddleware(slowQueryHandler)(harg)
+	if !cx.assertEqual(tc.xcode, res.code, "returned code") {
+		return
+	}
+	erec, _ := res.data.(ErrorResponse)
+	cx.assertEqual(tc.xerrCode, erec.ErrorCode, "errorCode")
+}
+
+// the timeoutMiddleware test suite.  run all timeoutMiddleware testcases.
+func Test_timeoutMiddleware(t *testing.T) {
+	cx := newTestContext(t, "timeoutMiddleware_Tab")
+	saveTimeout := queryTimeout
+	saveAdmin := adminTimeout
+	defer func() {
+		queryTimeout = saveTimeout
+		adminTimeout = saveAdmin
+	}()
+	for _, tc := range timeoutMiddleware_Tab {
+		timeoutMiddleware_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for requestTimeout()
+
+type requestTimeout_TC struct {
+	path string
+	xadmin bool
+}
+
+var requestTimeout_Tab = []requestTimeout_TC {
+	{ "/db/_table/abc", false },
+	{ "/db/_admin/reconcile", false },
+	{ "/db/_admin/dump", true },
+	{ "/db/_admin/load", true },
+	{ "/db/_admin/backup", true },
+	{ "/db/_admin/restore/", true },
+	{ "/db/xyz/_admin/dump", true },
+	{ "/db/_table/_admin", false },
+	{ "/db/_table/dump", false },
+}
+
+func Test_requestTimeout(t *testing.T) {
+	cx := newTestContext(t, "requestTimeout_Tab")
+	saveTimeout := queryTimeout
+	saveAdmin := adminTimeout
+	defer func() {
+		queryTimeout = saveTimeout
+		adminTimeout = saveAdmin
+	}()
+	queryTimeout = time.Second
+	adminTimeout = time.Hour
+	for _, tc := range requestTimeout_Tab {
+		xtimeout := queryTimeout
+		if tc.xadmin {
+			xtimeout = adminTimeout
+		}
+		cx.assertEqual(xtimeout, requestTimeout(tc.path), tc.path)
+		cx.bump()	// increment testno.
+	}
+}
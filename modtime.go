@@ -0,0 +1,78 @@
+package apidCRUD
+
+// this module tracks modifications to tables, so that listings
+// can support conditional requests.  each table has a modification
+// counter, advanced on every change made thru the API, and the time
+// of its latest advance.  changes made outside the API, and changes
+// made before startup, are not seen; a table not changed since startup
+// is treated as modified at startup.  tables are told apart by
+// database, as a name may be used in more than one database.
+
+import (
+	"sync"
+	"time"
+)
+
+// tableMod is the modification state of one table.
+type tableMod struct {
+	count uint64
+	when time.Time
+}
+
+// tableKey identifies a table: the name of its database
+// (empty for the default database), and its own name.
+type tableKey struct {
+	db string
+	table string
+}
+
+// tableMods holds the modification state of all tables changed
+// since startup.  it must be accessed with tableModsLock held.
+var tableMods = map[tableKey]tableMod{}
+
+// tableModsLock guards tableMods.
+var tableModsLock sync.Mutex
+
+// startTime is the time the plugin was loaded.
+var startTime = time.Now()
+
+// noteTableChange() records a change to the named table
+// of the named database.
+func noteTableChange(dbName string, tabName string) {
+	tableModsLock.Lock()
+	defer tableModsLock.Unlock()
+	key := tableKey{dbName, tabName}
+	mod := tableMods[key]
+	tableMods[key] = tableMod{mod.count + 1, time.Now()}
+}
+
+// noteTableListChange() records the creation or deletion of the
+// named table, which changes both the table and the table of tables.
+func noteTableListChange(dbName string, tabName string) {
+	noteTableChange(dbName, tabName)
+	noteTableChange(dbName, tableOfTables)
+}
+
+// noteDbChange() records a change to every table of the named
+// database, as when its contents are replaced by a restore.
+// the change is kept under the empty table name.
+func noteDbChange(dbName string) {
+	noteTableChange(dbName, "")
+}
+
+// tableModState() returns the modification counter of the named table
+// of the named database, and the time it was last modified.
+// changes to the whole database count as changes to the table.
+func tableModState(dbName string, tabName string) (uint64, time.Time) {
+	tableModsLock.Lock()
+	defer tableModsLock.Unlock()
+	mod, ok := tableMods[tableKey{dbName, tabName}]
+	all, allOk := tableMods[tableKey{dbName, ""}]
+	if !ok && !allOk {
+		return 0, startTime
+	}
+	if all.when.After(mod.when) {
+		mod.when = all.when
+	}
+	return mod.count + all.count, mod.when
+}
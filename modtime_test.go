@@ -0,0 +1,40 @@
+package apidCRUD
+
+import (
+	"testing"
+)
+
+// ----- unit tests for noteTableChange() and tableModState()
+
+func Test_noteTableChange(t *testing.T) {
+	cx := newTestContext(t)
+	tabName := "modtime_test_table"
+
+	count, when := tableModState("", tabName)
+	cx.assertEqual(uint64(0), count, "initial count")
+	cx.bump()
+	cx.assertEqual(startTime, when, "initial time")
+	cx.bump()
+
+	noteTableChange("", tabName)
+	noteTableChange("", tabName)
+	count, when = tableModState("", tabName)
+	cx.assertEqual(uint64(2), count, "count after changes")
+	cx.bump()
+	cx.assertTrue(!when.Before(startTime), "time after changes")
+	cx.bump()
+
+	// the same table name in another database is another table.
+	count, _ = tableModState("other", tabName)
+	cx.assertEqual(uint64(0), count, "count in other database")
+
+	cx.bump()
+
+	// a change to the whole database is a change to each table.
+	noteDbChange("")
+	count, _ = tableModState("", tabName)
+	cx.assertEqual(uint64(3), count, "count after database change")
+	cx.bump()
+	count, _ = tableModState("", "modtime_test_other")
+	cx.assertEqual(uint64(1), count, "count of unchanged table")
+}
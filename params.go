@@ -2,6 +2,7 @@ package apidCRUD
 
 import (
 	"fmt"
+	"mime"
 	"strings"
 	"strconv"
 	"unicode"
@@ -21,6 +22,10 @@ const (
 	paramQuery = 0		// comes from query portion of the URL.
 	paramPathOnly = 1	// comes from the path portion of the URL.
 	paramPathOrQuery = 2	// may come from path or query.
+
+	// record formats we recognize in the format parameter.
+	formatKV = "kv"		// parallel Keys and Values arrays (default).
+	formatObject = "object"	// json object keyed by field name.
 )
 
 // the type of parameter validator function
@@ -29,18 +34,23 @@ type paramValidator func (value string) (string, error)
 // map from param name to validator function
 var validators = map[string]paramValidator {
 	"table_name": validate_table_name,
+	"db_name": validate_db_name,
 	"fields": validate_fields,
 	"id": validate_id,
 	"id_field": validate_id_field,
 	"ids": validate_ids,
 	"limit": validate_limit,
 	"offset": validate_offset,
+	"format": validate_format,
+	"refresh": validate_refresh,
+	"stream": validate_stream,
 }
 
 // paramType tells which parameters come from where.
 // by default, parameters not listed here are paramQuery.
 var paramType = map[string]int {
 	"table_name": paramPathOnly,
+	"db_name": paramPathOnly,
 	"id": paramPathOrQuery,
 }
 
@@ -73,28 +83,55 @@ func (harg *apiHandlerArg) getParam(name string) (string, error) {
 // fetchParams() gets the named parameters from the given Request.
 // the parameters may be in the path or in the query.
 // each parameter must have a validator function.
-// the call returns an error if a validator function fails on any parameter.
+// the call returns an error if a validator function fails on any parameter;
+// the error lists every parameter that failed.
 // the parameter values are returned as a map of string.
 func fetchParams(harg *apiHandlerArg, names ...string) (map[string]string, error) {
 	ret := map[string]string{}
+	fields := []FieldError{}
 
 	// fetch and validate each named param, storing values in ret[]
 	for _, name := range names {
 		val, err := harg.getParam(name)
 		if err != nil {
-			return ret, err
+			fields = append(fields,
+				FieldError{-1, name, ruleParam, err.Error()})
+			continue
 		}
+		harg.log().Debugf("... %s = %s", name, val)
 		ret[name] = val
 	}
 
+	if len(fields) > 0 {
+		return ret, fieldsError(badStat, fields)
+	}
 	return ret, nil
 }
 
+// recordFormat() returns the record format to use for the given request.
+// the format query parameter (already fetched into params) takes precedence;
+// otherwise the format parameter of the media type(s) in the named header
+// is used; otherwise the default is formatKV.
+func recordFormat(harg *apiHandlerArg,
+		params map[string]string,
+		hdrName string) (string, error) {
+	if params["format"] != "" {
+		return params["format"], nil
+	}
+	for _, mt := range strings.Split(harg.req.Header.Get(hdrName), ",") {
+		_, mparams, err := mime.ParseMediaType(mt)
+		if err != nil || mparams["format"] == "" {
+			continue
+		}
+		return validate_format(mparams["format"])
+	}
+	return formatKV, nil
+}
+
 // ----- param validator functions compatible with paramValidator type
 
 // validate_fields() is the validator for the "fields" parameter.
 func validate_fields(fields string) (string, error) {
-	log.Debugf("... fields = %s", fields)
 	if fields == "" {
 		return "*", nil
 	}
@@ -108,16 +145,24 @@ func validate_fields(fields string) (string, error) {
 
 // validate_table_name() is the validator for the "table_name" parameter.
 func validate_table_name(table_name string) (string, error) {
-	log.Debugf("... table_name = %s", table_name)
 	if table_name == "" || ! isValidIdent(table_name) {
 		return table_name, fmt.Errorf("invalid table name %s", table_name)
 	}
 	return table_name, nil
 }
 
+// validate_db_name() is the validator for the "db_name" parameter.
+// names starting with "_" are reserved for the APIs under /db.
+func validate_db_name(db_name string) (string, error) {
+	if db_name == "" || ! isValidIdent(db_name) ||
+			strings.HasPrefix(db_name, "_") {
+		return db_name, fmt.Errorf("invalid database name %s", db_name)
+	}
+	return db_name, nil
+}
+
 // validate_id_field() is the validator for the "id_field" parameter.
 func validate_id_field(id_field string) (string, error) {
-	log.Debugf("... id_field = %s", id_field)
 	if id_field == "" {
 		id_field = "id"
 	}
@@ -130,7 +175,6 @@ func validate_id_field(id_field string) (string, error) {
 // validate_id() validates the given string as an SQL id value.
 // it must be a valid nonempty numeric string.
 func validate_id(id string) (string, error) {
-	log.Debugf("... id = %s", id)
 	n, err := strconv.ParseInt(id, idTypeRadix, idTypeBits)
 	if err != nil {
 		return id, err
@@ -142,7 +186,6 @@ func validate_id(id string) (string, error) {
 // of SQL id values.  each item must be a valid numeric string.
 // the empty string is valid and means the empty list.
 func validate_ids(ids string) (string, error) {
-	log.Debugf("... ids = %s", ids)
 	if ids == "" {
 		// an empty list is valid.
 		return ids, nil
@@ -168,7 +211,6 @@ func validate_ids(ids string) (string, error) {
 // a negative number or a number greater than maxRecs, is valid
 // and means maxRecs.
 func validate_limit(s string) (string, error) {
-	log.Debugf("... limit = %s", s)
 	if s == "" {
 		s = "0"
 	}
@@ -190,7 +232,6 @@ func validate_limit(s string) (string, error) {
 // if the input string is valid, a string is returned, and the error is nil.
 // an invalid string will result in the error being non-nil.
 func validate_offset(s string) (string, error) {
-	log.Debugf("... offset = %s", s)
 	if s == "" {
 		s = "0"
 	}
@@ -201,8 +242,44 @@ func validate_offset(s string) (string, error) {
 	return idTypeToA(n), nil
 }
 
+// validate_format() checks the given string for validity as a record format.
+// the empty string is valid and means the format was not specified.
+func validate_format(s string) (string, error) {
+	switch s {
+	case "", formatKV, formatObject:
+		return s, nil
+	default:
+		return s, fmt.Errorf("invalid format %s", s)
+	}
+}
+
+// validate_refresh() checks the given string for validity as a boolean.
+// the empty string is valid and means false.
+func validate_refresh(s string) (string, error) {
+	return validateBool("refresh", s)
+}
+
+// validate_stream() checks the given string for validity as a boolean.
+// the empty string is valid and means false.
+func validate_stream(s string) (string, error) {
+	return validateBool("stream", s)
+}
+
 // ----- misc validation support functions
 
+// validateBool() checks the value of the named boolean parameter,
+// and returns it as "true" or "false".  the empty string means false.
+func validateBool(name string, s string) (string, error) {
+	if s == "" {
+		return "false", nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return s, fmt.Errorf("invalid %s %s", name, s)
+	}
+	return strconv.FormatBool(b), nil
+}
+
 // notIdentChar() returns true iff the given rune is not valid in an
 // SQL identifier.
 func notIdentChar(r rune) bool {
@@ -116,6 +116,20 @@ func Test_validate_table_name(t *testing.T) {
 	run_validator(cx, validate_table_name, validate_table_name_Tab)
 }
 
+// ----- unit tests for validate_db_name
+
+var validate_db_name_Tab = []validator_TC {
+	{ "", "", false },
+	{ "team1", "team1", true },
+	{ "_table", "_table", false },	// reserved
+	{ "a-2", "a-2", false },
+}
+
+func Test_validate_db_name(t *testing.T) {
+	cx := newTestContext(t, "validate_db_name_Tab")
+	run_validator(cx, validate_db_name, validate_db_name_Tab)
+}
+
 // ----- unit tests for validate_id
 
 var validate_id_Tab = []validator_TC {
@@ -213,6 +227,92 @@ func Test_validate_offset(t *testing.T) {
 	run_validator(cx, validate_offset, validate_offset_Tab)
 }
 
+// ----- unit tests for validate_format
+
+var validate_format_Tab = []validator_TC {
+	{ "", "", true },
+	{ "kv", "kv", true },
+	{ "object", "object", true },
+	{ "Object", "", false },
+	{ "xml", "", false },
+}
+
+func Test_validate_format(t *testing.T) {
+	cx := newTestContext(t, "validate_format_Tab")
+	run_validator(cx, validate_format, validate_format_Tab)
+}
+
+// ----- unit tests for validate_refresh
+
+var validate_refresh_Tab = []validator_TC {
+	{ "", "false", true },
+	{ "true", "true", true },
+	{ "1", "true", true },
+	{ "false", "false", true },
+	{ "yes", "", false },
+}
+
+func Test_validate_refresh(t *testing.T) {
+	cx := newTestContext(t, "validate_refresh_Tab")
+	run_validator(cx, validate_refresh, validate_refresh_Tab)
+}
+
+// ----- unit tests for validate_stream
+
+var validate_stream_Tab = []validator_TC {
+	{ "", "false", true },
+	{ "true", "true", true },
+	{ "0", "false", true },
+	{ "maybe", "", false },
+}
+
+func Test_validate_stream(t *testing.T) {
+	cx := newTestContext(t, "validate_stream_Tab")
+	run_validator(cx, validate_stream, validate_stream_Tab)
+}
+
+// ----- unit tests for recordFormat().
+
+// inputs and outputs for one recordFormat testcase.
+type recordFormat_TC struct {
+	param string
+	accept string
+	xres string
+	xsucc bool
+}
+
+// table of recordFormat testcases.
+var recordFormat_Tab = []recordFormat_TC {
+	{ "", "", "kv", true },
+	{ "object", "", "object", true },
+	{ "kv", "application/json; format=object", "kv", true },
+	{ "", "application/json; format=object", "object", true },
+	{ "", "text/plain, application/json; format=object", "object", true },
+	{ "", "application/json", "kv", true },
+	{ "", "application/json; format=bogus", "", false },
+}
+
+// run one testcase for function recordFormat.
+func recordFormat_Checker(cx *testContext, tc *recordFormat_TC) {
+	harg := parseHandlerArg(http.MethodGet, "/apid/db")
+	harg.req.Header.Set("Accept", tc.accept)
+	params := map[string]string{"format": tc.param}
+	res, err := recordFormat(harg, params, "Accept")
+	if !cx.assertEqual(tc.xsucc, err == nil, "success") || err != nil {
+		return
+	}
+	cx.assertEqual(tc.xres, res, "result")
+}
+
+// the recordFormat test suite.  run all recordFormat testcases.
+func Test_recordFormat(t *testing.T) {
+	cx := newTestContext(t, "recordFormat_Tab")
+	for _, tc := range recordFormat_Tab {
+		recordFormat_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
 // ---- unit tests for notIdentChar()
 
 type notIdentChar_TC struct {
@@ -0,0 +1,209 @@
+package apidCRUD
+
+// this module implements the alternative body formats accepted by
+// the record update APIs: JSON Merge Patch (RFC 7396) and
+// JSON Patch (RFC 6902, limited to the replace, remove and test ops).
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// mergePatchType is the media type of a JSON Merge Patch body.
+	mergePatchType = "application/merge-patch+json"
+
+	// jsonPatchType is the media type of a JSON Patch body.
+	jsonPatchType = "application/json-patch+json"
+)
+
+// jsonPatchOp is one operation of a JSON Patch document.
+type jsonPatchOp struct {
+	Op string	`json:"op"`
+	Path string	`json:"path"`
+	Value interface{}	`json:"value"`
+}
+
+// patchTest is a field value that must match before a patch is applied.
+type patchTest struct {
+	field string
+	value interface{}
+}
+
+// getBodyMergePatch() returns the record described by a JSON Merge Patch
+// body: a plain object mapping field names to their new values.
+// a null value sets the field to NULL.
+func getBodyMergePatch(harg *apiHandlerArg) (KVRecord, error) {
+	obj := map[string]interface{}{}
+	err := harg.decodeBody(&obj)
+	if err != nil {
+		return KVRecord{}, err
+	}
+	return objToRecord(obj), nil
+}
+
+// getBodyJSONPatch() returns the operations of a JSON Patch body.
+func getBodyJSONPatch(harg *apiHandlerArg) ([]jsonPatchOp, error) {
+	ops := []jsonPatchOp{}
+	err := harg.decodeBody(&ops)
+	return ops, err
+}
+
+// patchPathField() returns the field name addressed by a JSON Patch path.
+// only single-segment paths are supported, since a record is flat.
+func patchPathField(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") != 1 {
+		return "", fmt.Errorf("unsupported patch path %s", path)
+	}
+	field := strings.NewReplacer("~1", "/", "~0", "~").Replace(path[1:])
+	return field, nil
+}
+
+// convJSONPatch() converts a list of JSON Patch operations into the
+// record of field changes, and the list of tests that must pass first.
+func convJSONPatch(ops []jsonPatchOp) (KVRecord, []patchTest, error) {
+	rec := KVRecord{Keys: []string{}, Values: []interface{}{}}
+	tests := []patchTest{}
+	for i, op := range ops {
+		field, err := patchPathField(op.Path)
+		if err != nil {
+			return rec, tests, fmt.Errorf("patch op %d: %s", i, err)
+		}
+		switch op.Op {
+		case "replace":
+			rec.Keys = append(rec.Keys, field)
+			rec.Values = append(rec.Values, op.Value)
+		case "remove":
+			rec.Keys = append(rec.Keys, field)
+			rec.Values = append(rec.Values, nil)
+		case "test":
+			tests = append(tests, patchTest{field, op.Value})
+		default:
+			return rec, tests,
+				fmt.Errorf("patch op %d: unsupported op %s", i, op.Op)
+		}
+	}
+	return rec, tests, nil
+}
+
+// patchValueString() returns a json value in the string form that
+// Select() returns for database values.  a null value becomes the
+// empty string; use patchValueEqual() to compare with selected values.
+func patchValueString(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// patchValueEqual() returns true iff the value Select() returned
+// for a field equals the given json value.  null equals only null,
+// and numbers are compared numerically, so that 1 equals "1.0".
+func patchValueEqual(selected interface{}, val interface{}) bool {
+	if selected == nil || val == nil {
+		return selected == nil && val == nil
+	}
+	s, ok := selected.(string)
+	if !ok {
+		return false
+	}
+	if f, ok := val.(float64); ok {
+		sf, err := strconv.ParseFloat(s, 64)
+		return err == nil && sf == f
+	}
+	return s == patchValueString(val)
+}
+
+// checkPatchTests() fails unless each of the given tests holds
+// for every record selected by params.
+func checkPatchTests(st recordStore,
+	params map[string]string,
+	tests []patchTest) error {
+	if len(tests) == 0 {
+		return nil
+	}
+	fields := make([]string, len(tests))
+	for i, t := range tests {
+		fields[i] = t.field
+	}
+
+	q := newRecordQuery(params)
+	if q.ids == nil {
+		return fmt.Errorf("update must specify id or ids")
+	}
+	q.fields = fields
+	result, err := st.Select(q)
+	if err != nil {
+		return err
+	}
+	if len(result) == 0 {
+		return notFoundError(fmt.Errorf("no matching record"))
+	}
+	for _, rec := range result {
+		for i, t := range tests {
+			if !patchValueEqual(rec.Values[i], t.value) {
+				return conflictError(fmt.Errorf(
+					"patch test failed on field %s", t.field))
+			}
+		}
+	}
+	return nil
+}
+
+// jsonPatchCommon() applies a JSON Patch to the records selected by params.
+// the tests and the update are done in one transaction.
+// as for updateCommon(), patching a single record that doesn't exist
+// is a notFoundError.
+func jsonPatchCommon(harg *apiHandlerArg,
+	params map[string]string) apiHandlerRet {
+	ops, err := getBodyJSONPatch(harg)
+	if err != nil {
+		return errorRet(badStat, err, "after getBodyJSONPatch")
+	}
+	rec, tests, err := convJSONPatch(ops)
+	if err != nil {
+		return errorRet(badStat, err, "after convJSONPatch")
+	}
+	fields := recordFieldErrors(0, rec)
+	for _, t := range tests {
+		if !isValidIdent(t.field) {
+			fields = append(fields, FieldError{0, t.field,
+				ruleIdentifier, fmt.Sprintf("invalid key %s", t.field)})
+		}
+	}
+	if len(fields) > 0 {
+		return errorRet(badStat,
+			fieldsError(http.StatusUnprocessableEntity, fields), "")
+	}
+
+	var ra idType
+	err = harg.db().storage().Transact(func(tx recordStore) error {
+		err := checkPatchTests(tx, params, tests)
+		if err != nil || len(rec.Keys) == 0 {
+			return err
+		}
+		ra, err = updateRec(tx, params, rec)
+		if _, ok := params["id"]; ok && err == nil && ra == 0 {
+			err = notFoundError(fmt.Errorf("no matching record"))
+		}
+		return err
+	})
+	if err != nil {
+		return errorRet(badStat, err, "after updateRec")
+	}
+	return apiHandlerRet{http.StatusOK,
+		NumChangedResponse{int64(ra), "NumChangedResponse"}}
+}
@@ -0,0 +1,290 @@
+package apidCRUD
+
+import (
+	"testing"
+	"net/http"
+	"strings"
+)
+
+// ----- unit tests for patchPathField().
+
+// inputs and outputs for one patchPathField testcase.
+type patchPathField_TC struct {
+	path string
+	xres string
+	xsucc bool
+}
+
+// table of patchPathField testcases.
+var patchPathField_Tab = []patchPathField_TC {
+	{ "/name", "name", true },
+	{ "/a~1b", "a/b", true },
+	{ "/a~0b", "a~b", true },
+	{ "name", "", false },
+	{ "/a/b", "", false },
+	{ "", "", false },
+}
+
+// run one testcase for function patchPathField.
+func patchPathField_Checker(cx *testContext, tc *patchPathField_TC) {
+	res, err := patchPathField(tc.path)
+	if !cx.assertEqual(tc.xsucc, err == nil, "success") {
+		return
+	}
+	cx.assertEqual(tc.xres, res, "result")
+}
+
+// the patchPathField test suite.  run all patchPathField testcases.
+func Test_patchPathField(t *testing.T) {
+	cx := newTestContext(t, "patchPathField_Tab")
+	for _, tc := range patchPathField_Tab {
+		patchPathField_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for convJSONPatch().
+
+// inputs and outputs for one convJSONPatch testcase.
+type convJSONPatch_TC struct {
+	ops []jsonPatchOp
+	xkeys string
+	xtests string
+	xsucc bool
+}
+
+// table of convJSONPatch testcases.
+var convJSONPatch_Tab = []convJSONPatch_TC {
+	{ []jsonPatchOp{}, "", "", true },
+	{ []jsonPatchOp{{"replace", "/name", "x"}, {"remove", "/uri", nil}},
+		"name,uri", "", true },
+	{ []jsonPatchOp{{"test", "/name", "x"}, {"replace", "/name", "y"}},
+		"name", "name", true },
+	{ []jsonPatchOp{{"add", "/name", "x"}}, "", "", false },
+	{ []jsonPatchOp{{"move", "/name", "x"}}, "", "", false },
+	{ []jsonPatchOp{{"replace", "/a/b", "x"}}, "", "", false },
+}
+
+// run one testcase for function convJSONPatch.
+func convJSONPatch_Checker(cx *testContext, tc *convJSONPatch_TC) {
+	rec, tests, err := convJSONPatch(tc.ops)
+	if !cx.assertEqual(tc.xsucc, err == nil, "success") {
+		return
+	}
+	if err != nil {
+		return
+	}
+	cx.assertEqual(tc.xkeys, strings.Join(rec.Keys, ","), "keys")
+	cx.assertEqual(len(rec.Keys), len(rec.Values), "number of values")
+	tfields := make([]string, len(tests))
+	for i, t := range tests {
+		tfields[i] = t.field
+	}
+	cx.assertEqual(tc.xtests, strings.Join(tfields, ","), "tests")
+}
+
+// the convJSONPatch test suite.  run all convJSONPatch testcases.
+func Test_convJSONPatch(t *testing.T) {
+	cx := newTestContext(t, "convJSONPatch_Tab")
+	for _, tc := range convJSONPatch_Tab {
+		convJSONPatch_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for patchValueString().
+
+// inputs and outputs for one patchValueString testcase.
+type patchValueString_TC struct {
+	val interface{}
+	xres string
+}
+
+// table of patchValueString testcases.
+var patchValueString_Tab = []patchValueString_TC {
+	{ nil, "" },
+	{ "abc", "abc" },
+	{ float64(12), "12" },
+	{ float64(1.5), "1.5" },
+	{ true, "1" },
+	{ false, "0" },
+	{ []interface{}{}, "[]" },
+}
+
+// run one testcase for function patchValueString.
+func patchValueString_Checker(cx *testContext, tc *patchValueString_TC) {
+	cx.assertEqual(tc.xres, patchValueString(tc.val), "result")
+}
+
+// the patchValueString test suite.  run all patchValueString testcases.
+func Test_patchValueString(t *testing.T) {
+	cx := newTestContext(t, "patchValueString_Tab")
+	for _, tc := range patchValueString_Tab {
+		patchValueString_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for patchValueEqual().
+
+// inputs and outputs for one patchValueEqual testcase.
+type patchValueEqual_TC struct {
+	selected interface{}
+	val interface{}
+	xres bool
+}
+
+// table of patchValueEqual testcases.
+var patchValueEqual_Tab = []patchValueEqual_TC {
+	{ nil, nil, true },
+	{ nil, "", false },
+	{ "", nil, false },
+	{ "", "", true },
+	{ "abc", "abc", true },
+	{ "abc", "abd", false },
+	{ "1.0", float64(1), true },
+	{ "1", float64(1.0), true },
+	{ "1.5", float64(1.5), true },
+	{ "1.5", float64(2), false },
+	{ "x", float64(0), false },
+	{ "12", "12.0", false },
+	{ "1", true, true },
+	{ "0", false, true },
+	{ "1", false, false },
+}
+
+// run one testcase for function patchValueEqual.
+func patchValueEqual_Checker(cx *testContext, tc *patchValueEqual_TC) {
+	cx.assertEqual(tc.xres, patchValueEqual(tc.selected, tc.val), "result")
+}
+
+// the patchValueEqual test suite.  run all patchValueEqual testcases.
+func Test_patchValueEqual(t *testing.T) {
+	cx := newTestContext(t, "patchValueEqual_Tab")
+	for _, tc := range patchValueEqual_Tab {
+		patchValueEqual_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for updateDbRecordHandler() with patch bodies.
+
+// inputs and outputs for one api call with a given content type.
+type patchCall_TC struct {
+	title string
+	hf apiHandler
+	ctype string
+	argDesc string
+	xcode int
+}
+
+// table of patch testcases.  they must run in order.
+var patchCall_Tab = []patchCall_TC {
+	{"setup: create table xxxpatch",
+		createDbTableHandler, "",
+		`/test/db/_schema/xxxpatch|table_name=xxxpatch||`+users_schema,
+		http.StatusCreated},
+	{"setup: create records 1,2",
+		createDbRecordsHandler, "",
+		`/test/db/_table/xxxpatch|table_name=xxxpatch||{"records":[{"keys":["name","uri"],"values":["n1","u1"]},{"keys":["name","uri"],"values":["n2","u2"]}]}`,
+		http.StatusCreated},
+	{"merge patch record 1",
+		updateDbRecordHandler, mergePatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||{"name":"m1","uri":"v1"}`,
+		http.StatusOK},
+	{"merge patch with charset parameter",
+		updateDbRecordHandler, mergePatchType + "; charset=utf-8",
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||{"name":"m1"}`,
+		http.StatusOK},
+	{"merge patch with invalid key",
+		updateDbRecordHandler, mergePatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||{"bad key":"x"}`,
+		http.StatusUnprocessableEntity},
+	{"merge patch not an object",
+		updateDbRecordHandler, mergePatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||["x"]`,
+		http.StatusBadRequest},
+	{"json patch test and replace",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||[{"op":"test","path":"/name","value":"m1"},{"op":"replace","path":"/uri","value":"w1"}]`,
+		http.StatusOK},
+	{"json patch failing test",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||[{"op":"test","path":"/name","value":"zzz"},{"op":"replace","path":"/uri","value":"w9"}]`,
+		http.StatusConflict},
+	{"json patch test only",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||[{"op":"test","path":"/uri","value":"w1"}]`,
+		http.StatusOK},
+	{"json patch set empty name",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/2|table_name=xxxpatch&id=2||[{"op":"replace","path":"/name","value":""}]`,
+		http.StatusOK},
+	{"json patch test null against empty string",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/2|table_name=xxxpatch&id=2||[{"op":"test","path":"/name","value":null}]`,
+		http.StatusConflict},
+	{"json patch test empty string",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/2|table_name=xxxpatch&id=2||[{"op":"test","path":"/name","value":""}]`,
+		http.StatusOK},
+	{"json patch on multiple records",
+		updateDbRecordsHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch|table_name=xxxpatch|ids=1,2|[{"op":"replace","path":"/uri","value":"all"}]`,
+		http.StatusOK},
+	{"json patch test across multiple records",
+		updateDbRecordsHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch|table_name=xxxpatch|ids=1,2|[{"op":"test","path":"/uri","value":"all"}]`,
+		http.StatusOK},
+	{"json patch remove on not-null field",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||[{"op":"remove","path":"/uri"}]`,
+		http.StatusUnprocessableEntity},
+	{"json patch unsupported op",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||[{"op":"add","path":"/uri","value":"x"}]`,
+		http.StatusBadRequest},
+	{"json patch invalid key",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||[{"op":"test","path":"/bad key","value":"x"}]`,
+		http.StatusUnprocessableEntity},
+	{"json patch malformed body",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/1|table_name=xxxpatch&id=1||{}`,
+		http.StatusBadRequest},
+	{"json patch replace on missing record",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/9|table_name=xxxpatch&id=9||[{"op":"replace","path":"/uri","value":"x"}]`,
+		http.StatusNotFound},
+	{"merge patch on missing record",
+		updateDbRecordHandler, mergePatchType,
+		`/test/db/_table/xxxpatch/9|table_name=xxxpatch&id=9||{"uri":"x"}`,
+		http.StatusNotFound},
+	{"json patch test on missing record",
+		updateDbRecordHandler, jsonPatchType,
+		`/test/db/_table/xxxpatch/9|table_name=xxxpatch&id=9||[{"op":"test","path":"/uri","value":"x"}]`,
+		http.StatusNotFound},
+	{"teardown: delete table xxxpatch",
+		deleteDbTableHandler, "",
+		`/test/db/_schema/xxxpatch|table_name=xxxpatch`,
+		http.StatusOK},
+}
+
+// run one testcase for a handler called with a given content type.
+func patchCall_Checker(cx *testContext, tc *patchCall_TC) {
+	harg := parseHandlerArg(http.MethodPatch, tc.argDesc)
+	if tc.ctype != "" {
+		harg.req.Header.Set("Content-Type", tc.ctype)
+	}
+	res := tc.hf(harg)
+	cx.assertEqual(tc.xcode, res.code, tc.title)
+}
+
+// the patch test suite.  run all patchCall testcases.
+func Test_updateCommon_patch(t *testing.T) {
+	cx := newTestContext(t, "patchCall_Tab")
+	for _, tc := range patchCall_Tab {
+		patchCall_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
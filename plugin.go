@@ -1,7 +1,10 @@
 package apidCRUD
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 	"net/http"
 	"github.com/apid/apid-core"
 )
@@ -36,17 +39,25 @@ func initPlugin(services apid.Services) (apid.PluginData, error) {
 // then returns apidCRUD's pluginData.
 //	reads in the plugin-specific configuration data.
 //	sets the log variable.
-//	sets the db variable.
+//	sets the db variable, and the dbs registry.
 //	registers the API handlers.
 func realInitPlugin(gsi getStringer,
 		fmi forModuler,
 		hfi handleFuncer) (apid.PluginData, error) {
-	initConfig(gsi)
+	if err := initConfig(gsi); err != nil {
+		return pluginData, err
+	}
 	log = fmi.ForModule(pluginData.Name)	// NOTE: non-local var
 	registerHandlers(hfi, apiTable)
 	log.Infof("in apidCRUD realInitPlugin")
 
-	var err error
+	dbNames, err := parseDatabases(databases)
+	if err != nil {
+		return pluginData, err
+	}
+	dbs = newDbRegistry(dbNames)		// NOTE: non-local var
+	log.Infof("named databases: %s", strings.Join(dbs.names(), ","))
+
 	db, err = initDB(dbName)		// NOTE: non-local var
 
 	return pluginData, err
@@ -54,56 +65,135 @@ func realInitPlugin(gsi getStringer,
 
 // registerHandlers() register all our handlers with the given service.
 func registerHandlers(service handleFuncer, tab []apiDesc) {
-	ws := newApiWiring(basePath, tab)
+	ws := newApiWiring(basePath, tab, defaultMiddleware...)
 	maps := ws.GetMaps()
-	for path, vmap := range maps {
-		addPath(service, path, vmap)
+	for path := range maps {
+		addPath(service, path, ws)
 	}
 }
 
 // addPath() registers the given path with the given service,
-// so that it will be handled indirectly by pathDispatch().
-// when an API call is made on this path, the vmap argument from
-// this context will be suppllied, along with the w and r arguments
-// passed in by the service framework.
-func addPath(service handleFuncer, path string, vmap verbMap) {
-	service.HandleFunc(path,
-		func(w http.ResponseWriter, r *http.Request) {
-			pathDispatch(vmap, w, mkApiHandlerArg(r, getPathParams(r)))
-		})
-}
-
-// getPathParams() returns a map of path params from the given http request.
-func getPathParams(req *http.Request) map[string]string {
-	return apid.API().Vars(req)
+// so that it will be handled by the wiring's own router.
+// the service is only used to get requests for this path to us;
+// the wiring extracts the path params itself.
+func addPath(service handleFuncer, path string, ws *apiWiring) {
+	service.HandleFunc(path, ws.ServeHTTP)
 }
 
 // ----- configuration related functions
 
-// getStringer is an interface that supports GetString().
+// getStringer is an interface that supports GetString() and IsSet().
 // narrowed from apid.ConfigService.
 type getStringer interface {
 	GetString(vname string) string
+	IsSet(vname string) bool
 }
 
 // confGet() returns the config value of the named string,
-// or if there is no configured value, the given default value.
+// or if the variable is not set, the given default value.
+// a variable set to the empty string has that value, so that
+// a default such as corsHeaders can be configured away.
 func confGet(gsi getStringer, vname string, defval string) string {
-	ret := gsi.GetString(vname)
-	if ret == "" {
+	if !gsi.IsSet(vname) {
+		return defval
+	}
+	return gsi.GetString(vname)
+}
+
+// confParser reads typed config variables with confGet().
+// it keeps the first error, so that a run of reads can be
+// checked once at the end.  a variable with an invalid value,
+// including one set to the empty string, keeps its default.
+type confParser struct {
+	gsi getStringer
+	err error
+}
+
+// fail() records the error for an invalid config value.
+func (cp *confParser) fail(vname string, val string) {
+	if cp.err == nil {
+		cp.err = fmt.Errorf("config %s: invalid value %q", vname, val)
+	}
+}
+
+// getInt() returns the value of the named int config variable.
+func (cp *confParser) getInt(vname string, defval int) int {
+	s := confGet(cp.gsi, vname, strconv.Itoa(defval))
+	ret, err := strconv.Atoi(s)
+	if err != nil {
+		cp.fail(vname, s)
+		return defval
+	}
+	return ret
+}
+
+// getBool() returns the value of the named bool config variable.
+func (cp *confParser) getBool(vname string, defval bool) bool {
+	s := confGet(cp.gsi, vname, strconv.FormatBool(defval))
+	ret, err := strconv.ParseBool(s)
+	if err != nil {
+		cp.fail(vname, s)
+		return defval
+	}
+	return ret
+}
+
+// getDuration() returns the value of the named duration config variable.
+func (cp *confParser) getDuration(vname string,
+		defval time.Duration) time.Duration {
+	s := confGet(cp.gsi, vname, defval.String())
+	ret, err := time.ParseDuration(s)
+	if err != nil {
+		cp.fail(vname, s)
 		return defval
 	}
 	return ret
 }
 
 // initConfig() sets up some global configuration parameters for this plugin.
-func initConfig(gsi getStringer) {
-	aMaxRecs := strconv.Itoa(maxRecs)
+// it fails if a numeric, bool or duration variable has an invalid value.
+func initConfig(gsi getStringer) error {
+	cp := &confParser{gsi: gsi}
 
 	// these are all global assignments!
 	dbDriver = confGet(gsi, "apidCRUD_db_driver", dbDriver)
 	dbName = confGet(gsi, "apidCRUD_db_name", dbName)
+	databases = confGet(gsi, "apidCRUD_databases", databases)
+	backupDir = confGet(gsi, "apidCRUD_backup_dir", backupDir)
 	basePath = confGet(gsi, "apidCRUD_base_path", basePath)
-	maxRecs, _ = strconv.Atoi(			// nolint
-		confGet(gsi, "apidCRUD_max_recs", aMaxRecs))
+	maxRecs = cp.getInt("apidCRUD_max_recs", maxRecs)
+
+	corsOrigins = confGet(gsi, "apidCRUD_cors_origins", corsOrigins)
+	corsMethods = confGet(gsi, "apidCRUD_cors_methods", corsMethods)
+	corsHeaders = confGet(gsi, "apidCRUD_cors_headers", corsHeaders)
+	corsCredentials = cp.getBool("apidCRUD_cors_credentials",
+		corsCredentials)
+	corsMaxAge = confGet(gsi, "apidCRUD_cors_max_age", corsMaxAge)
+
+	compressMinSize = cp.getInt("apidCRUD_compress_min_size",
+		compressMinSize)
+
+	maxBodySize = cp.getInt("apidCRUD_max_body_size", maxBodySize)
+	strictJSON = cp.getBool("apidCRUD_strict_json", strictJSON)
+	queryTimeout = cp.getDuration("apidCRUD_query_timeout", queryTimeout)
+	adminTimeout = cp.getDuration("apidCRUD_admin_timeout", adminTimeout)
+
+	dbMaxOpenConns = cp.getInt("apidCRUD_db_max_open_conns",
+		dbMaxOpenConns)
+	dbMaxIdleConns = cp.getInt("apidCRUD_db_max_idle_conns",
+		dbMaxIdleConns)
+	dbConnMaxLifetime = cp.getDuration("apidCRUD_db_conn_max_lifetime",
+		dbConnMaxLifetime)
+
+	sqliteJournalMode = confGet(gsi, "apidCRUD_sqlite_journal_mode",
+		sqliteJournalMode)
+	sqliteSynchronous = confGet(gsi, "apidCRUD_sqlite_synchronous",
+		sqliteSynchronous)
+	sqliteBusyTimeout = cp.getDuration("apidCRUD_sqlite_busy_timeout",
+		sqliteBusyTimeout)
+	sqliteForeignKeys = cp.getBool("apidCRUD_sqlite_foreign_keys",
+		sqliteForeignKeys)
+	sqliteCacheSize = confGet(gsi, "apidCRUD_sqlite_cache_size",
+		sqliteCacheSize)
+	return cp.err
 }
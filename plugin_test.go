@@ -2,9 +2,11 @@ package apidCRUD
 
 import (
 	"testing"
+	"fmt"
 	"strings"
 	"net/http"
 	"net/http/httptest"
+	"time"
 	"github.com/apid/apid-core"
 )
 
@@ -19,6 +21,12 @@ func Test_initDB(t *testing.T) {
 	cx.assertTrue(x.handle != nil, "handle should not be nil")
 }
 
+func Test_initDBBadName(t *testing.T) {
+	cx := newTestContext(t)
+	_, err := initDB("/nonexistent/dir/unit-test.db")
+	cx.assertTrue(err != nil, "error ret")
+}
+
 // ----- unit tests for registerHandlers() and addPath()
 
 type mockApiService struct {
@@ -96,6 +104,7 @@ var utConfData = map[string]string {
 	"apidCRUD_max_recs": "7",
 	"apidCRUD_db_driver": "sqlite3",
 	"apidCRUD_db_name": "unit-test.db",
+	"apidCRUD_cors_origins": "https://admin.example.com, https://ops.example.com",
 }
 
 // ----- unit tests for confGet()
@@ -109,6 +118,7 @@ type confGet_TC struct {
 var confGet_Tab = []confGet_TC {
 	{"apidCRUD_db_name", "garbage", "unit-test.db"}, // this key is present
 	{"not-there", "no", "no"},		// this key is not present
+	{"empty", "no", ""},		// this key is present, set to ""
 }
 
 // mockGetStringer is compatible with the interface expected by confGet().
@@ -120,6 +130,11 @@ func (gs mockGetStringer) GetString(name string) string {
 	return gs.data[name]
 }
 
+func (gs mockGetStringer) IsSet(name string) bool {
+	_, ok := gs.data[name]
+	return ok
+}
+
 func confGet_Checker(cx *testContext, gs getStringer, tc *confGet_TC) {
 	res := confGet(gs, tc.name, tc.defval)
 	cx.assertEqual(tc.xval, res, "result")
@@ -127,7 +142,11 @@ func confGet_Checker(cx *testContext, gs getStringer, tc *confGet_TC) {
 
 func Test_confGet(t *testing.T) {
 	cx := newTestContext(t, "confGet_Tab")
-	gs := mockGetStringer{utConfData}
+	data := map[string]string{"empty": ""}
+	for k, v := range utConfData {
+		data[k] = v
+	}
+	gs := mockGetStringer{data}
 	for _, tc := range confGet_Tab {
 		confGet_Checker(cx, gs, &tc)
 		cx.bump()
@@ -135,7 +154,84 @@ func Test_confGet(t *testing.T) {
 }
 
 func utInitConfig() {
-	// this just proves it can be called without crashing
 	gs := mockGetStringer{utConfData}
-	initConfig(gs)
+	if err := initConfig(gs); err != nil {
+		panic(fmt.Sprintf("utInitConfig: %s", err))
+	}
+}
+
+// ----- unit tests for initConfig()
+
+// inputs and outputs for one initConfig testcase.
+// the config is utConfData with one variable changed.
+type initConfig_TC struct {
+	name string
+	val string
+	xsucc bool
+}
+
+// table of initConfig testcases.
+var initConfig_Tab = []initConfig_TC {
+	{ "apidCRUD_max_recs", "12", true },
+	{ "apidCRUD_max_recs", "many", false },
+	{ "apidCRUD_strict_json", "maybe", false },
+	{ "apidCRUD_query_timeout", "10", false },
+	{ "apidCRUD_admin_timeout", "10m", true },
+	{ "apidCRUD_admin_timeout", "later", false },
+	{ "apidCRUD_sqlite_busy_timeout", "2s", true },
+	{ "apidCRUD_sqlite_busy_timeout", "soon", false },
+	{ "apidCRUD_db_conn_max_lifetime", "1h", true },
+	{ "apidCRUD_max_recs", "", false },
+}
+
+// run one testcase for function initConfig.
+func initConfig_Checker(cx *testContext, tc *initConfig_TC) {
+	data := map[string]string{tc.name: tc.val}
+	for k, v := range utConfData {
+		if k != tc.name {
+			data[k] = v
+		}
+	}
+	err := initConfig(mockGetStringer{data})
+	cx.assertEqual(tc.xsucc, err == nil, "succ")
+	if err != nil {
+		cx.assertTrue(strings.Contains(err.Error(), tc.name),
+			"error names the variable")
+	}
+}
+
+// the initConfig test suite.  run all initConfig testcases.
+func Test_initConfig(t *testing.T) {
+	cx := newTestContext(t, "initConfig_Tab")
+	// variables not in utConfData keep what the testcases set,
+	// so they are restored explicitly.
+	defer func(bt, ml, at time.Duration) {
+		sqliteBusyTimeout, dbConnMaxLifetime, adminTimeout = bt, ml, at
+		utInitConfig()
+	}(sqliteBusyTimeout, dbConnMaxLifetime, adminTimeout)
+	for _, tc := range initConfig_Tab {
+		initConfig_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// a string variable set to the empty string has that value,
+// rather than its default.
+func Test_initConfig_empty(t *testing.T) {
+	cx := newTestContext(t)
+	defer func(jm, ch string) {
+		sqliteJournalMode, corsHeaders = jm, ch
+		utInitConfig()
+	}(sqliteJournalMode, corsHeaders)
+	data := map[string]string{
+		"apidCRUD_sqlite_journal_mode": "",
+		"apidCRUD_cors_headers": "",
+	}
+	for k, v := range utConfData {
+		data[k] = v
+	}
+	err := initConfig(mockGetStringer{data})
+	cx.assertErrorNil(err, "initConfig")
+	cx.assertEqual("", sqliteJournalMode, "sqliteJournalMode")
+	cx.assertEqual("", corsHeaders, "corsHeaders")
 }
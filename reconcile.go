@@ -0,0 +1,221 @@
+package apidCRUD
+
+// this module reconciles the table of tables with the tables that
+// actually exist in the database.  tables created outside the API
+// are unmanaged; they can be imported into the catalog, with schemas
+// inferred from sqlite.  catalog entries whose tables were dropped
+// outside the API are orphans; they are reported but left alone.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// getDbReconcileHandler handles GET requests on /db/_admin/reconcile .
+// it reports the differences without changing anything.
+func getDbReconcileHandler(harg *apiHandlerArg) apiHandlerRet {
+	res, err := reconcileCatalog(harg.db(), false)
+	if err != nil {
+		return errorRet(badStat, err, "after reconcileCatalog")
+	}
+	return apiHandlerRet{http.StatusOK, res}
+}
+
+// runDbReconcileHandler handles POST requests on /db/_admin/reconcile .
+// it imports the unmanaged tables, and reports the differences.
+func runDbReconcileHandler(harg *apiHandlerArg) apiHandlerRet {
+	res, err := reconcileCatalog(harg.db(), true)
+	if err != nil {
+		return errorRet(badStat, err, "after reconcileCatalog")
+	}
+	return apiHandlerRet{http.StatusOK, res}
+}
+
+// startupReconcile() imports any unmanaged tables at startup,
+// and logs the differences.  failure is logged but not fatal.
+func startupReconcile(db dbType) {
+	res, err := reconcileCatalog(db, true)
+	if err != nil {
+		db.log().Warnf("catalog reconcile: %s", err)
+		return
+	}
+	logReconcile(db, res)
+}
+
+// logReconcile() logs the interesting parts of a reconcile result.
+func logReconcile(db dbType, res ReconcileResponse) {
+	lg := db.log()
+	if len(res.Imported) > 0 {
+		lg.Infof("catalog reconcile: imported %s",
+			strings.Join(res.Imported, ","))
+	}
+	if len(res.Orphans) > 0 {
+		lg.Warnf("catalog reconcile: no such tables %s",
+			strings.Join(res.Orphans, ","))
+	}
+	for _, d := range res.Mismatched {
+		lg.Warnf("catalog reconcile: table %s differs from its schema: %+v",
+			d.Table, d)
+	}
+}
+
+// reconcileCatalog() compares the catalog with the actual tables.
+// if apply is true, the unmanaged tables are imported into the catalog.
+func reconcileCatalog(db dbType, apply bool) (ReconcileResponse, error) {
+	ret := ReconcileResponse{
+		Unmanaged: []string{},
+		Imported: []string{},
+		Orphans: []string{},
+		Mismatched: []TableDiff{},
+		Kind: "ReconcileResponse",
+	}
+	if err := db.sqlOnly("catalog reconcile"); err != nil {
+		return ret, err
+	}
+	tables, err := listDbTables(db)
+	if err != nil {
+		return ret, err
+	}
+	catalog, err := listCatalog(db)
+	if err != nil {
+		return ret, err
+	}
+
+	exists := listToMap(tables)
+	imports := []*xCmd{}
+	for _, name := range tables {
+		actual, err := inferSchema(db, name)
+		if err != nil {
+			return ret, err
+		}
+		schema, ok := catalog[name]
+		if !ok {
+			ret.Unmanaged = append(ret.Unmanaged, name)
+			jschema, _ := json.Marshal(actual)
+			// tolerate a table that was imported meanwhile.
+			d := db.dialect()
+			imports = append(imports, newXCmd(mkInsertString(d,
+				tableOfTables, []string{"name", "schema"},
+				d.upsertClause("name", nil)), name, string(jschema)))
+			continue
+		}
+		if d, ok := schemaDiff(name, schema, actual); !ok {
+			ret.Mismatched = append(ret.Mismatched, d)
+		}
+	}
+	for name := range catalog {
+		if exists[name] == 0 {
+			ret.Orphans = append(ret.Orphans, name)
+		}
+	}
+	sort.Strings(ret.Orphans)
+
+	if apply && len(imports) > 0 {
+		if err = execN(db, imports...); err != nil {
+			return ret, err
+		}
+		ret.Imported = ret.Unmanaged
+		for _, name := range ret.Imported {
+			noteTableChange(db.name, name)
+		}
+		noteTableChange(db.name, tableOfTables)
+	}
+	return ret, nil
+}
+
+// listDbTables() returns the names of the tables in the database,
+// other than sqlite's own tables and the catalog's.
+func listDbTables(db dbType) ([]string, error) {
+	rows, err := db.handle.QueryContext(db.context(),
+		`select name from sqlite_master
+		where type = 'table' and name not like 'sqlite\_%' escape '\'
+		and name not in (?, ?) order by name`,
+		tableOfTables, catalogMetaTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+	ret := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		ret = append(ret, name)
+	}
+	return ret, rows.Err()
+}
+
+// listCatalog() returns the schemas in the table of tables,
+// keyed by table name.
+func listCatalog(db dbType) (map[string]string, error) {
+	rows, err := db.handle.QueryContext(db.context(),
+		fmt.Sprintf("select name, schema from %s",
+			db.dialect().quote(tableOfTables)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+	ret := map[string]string{}
+	for rows.Next() {
+		var name, schema string
+		if err = rows.Scan(&name, &schema); err != nil {
+			return nil, err
+		}
+		ret[name] = schema
+	}
+	return ret, rows.Err()
+}
+
+// inferSchema() returns the schema of the named table, as sqlite has it.
+// an integer primary key is given the is_primary_key property,
+// as in tables created by createDbTable.
+func inferSchema(db dbType, tabName string) (TableSchema, error) {
+	ret := TableSchema{Fields: []FieldSchema{}}
+	cols, err := tableColumns(db, tabName)
+	if err != nil {
+		return ret, err
+	}
+	for _, col := range cols {
+		field := FieldSchema{Name: col.Name, Properties: []string{}}
+		if col.PrimaryKey && strings.EqualFold(col.Type, "integer") {
+			field.Properties = append(field.Properties, "is_primary_key")
+		}
+		ret.Fields = append(ret.Fields, field)
+	}
+	return ret, nil
+}
+
+// schemaDiff() compares the field names of a catalog schema
+// with those of the actual table.  it returns false and
+// the differences if they don't match.
+func schemaDiff(tabName string,
+		schema string,
+		actual TableSchema) (TableDiff, bool) {
+	ret := TableDiff{Table: tabName}
+	var sch TableSchema
+	if err := json.Unmarshal([]byte(schema), &sch); err != nil {
+		ret.Message = fmt.Sprintf("bad schema in catalog: %s", err)
+		return ret, false
+	}
+	want := map[string]int{}
+	for _, f := range sch.Fields {
+		want[f.Name] = 1
+	}
+	have := map[string]int{}
+	for _, f := range actual.Fields {
+		have[f.Name] = 1
+		if want[f.Name] == 0 {
+			ret.Extra = append(ret.Extra, f.Name)
+		}
+	}
+	for _, f := range sch.Fields {
+		if have[f.Name] == 0 {
+			ret.Missing = append(ret.Missing, f.Name)
+		}
+	}
+	return ret, len(ret.Missing) == 0 && len(ret.Extra) == 0
+}
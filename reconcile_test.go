@@ -0,0 +1,135 @@
+package apidCRUD
+
+import (
+	"testing"
+	"net/http"
+	"strings"
+)
+
+// ----- unit tests for reconcileCatalog()
+
+// mkReconcileDb() returns a database with a managed table "kept",
+// an unmanaged table "outside", an orphan catalog entry "gone",
+// and a managed table "changed" that gained a field outside the API.
+func mkReconcileDb() (dbType, func()) {
+	return mkTempDb(tempDbOpts{
+		catalog: true,
+		tables: []string{"kept", "changed"},
+		setup: []string{
+			`create table outside (id integer primary key, name text)`,
+			`insert into _tables_ (name, schema) values ("gone", "{}")`,
+			`alter table changed add column extra text`,
+		},
+	})
+}
+
+// the reconcileCatalog test suite.
+func Test_reconcileCatalog(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkReconcileDb()
+	defer cleanup()
+
+	// report only.
+	res, err := reconcileCatalog(tdb, false)
+	cx.assertErrorNil(err, "reconcileCatalog")
+	cx.assertEqual("outside", strings.Join(res.Unmanaged, ","), "unmanaged")
+	cx.assertEqual("", strings.Join(res.Imported, ","), "imported")
+	cx.assertEqual("gone", strings.Join(res.Orphans, ","), "orphans")
+	if cx.assertEqual(1, len(res.Mismatched), "mismatched") {
+		d := res.Mismatched[0]
+		cx.assertEqual("changed", d.Table, "mismatched table")
+		cx.assertEqual("extra", strings.Join(d.Extra, ","), "extra")
+		cx.assertEqual(0, len(d.Missing), "missing")
+	}
+	cx.bump()
+
+	// import.
+	res, err = reconcileCatalog(tdb, true)
+	cx.assertErrorNil(err, "reconcileCatalog")
+	cx.assertEqual("outside", strings.Join(res.Imported, ","), "imported")
+	cx.bump()
+
+	// nothing left to import; the imported schema matches.
+	res, err = reconcileCatalog(tdb, false)
+	cx.assertErrorNil(err, "reconcileCatalog")
+	cx.assertEqual(0, len(res.Unmanaged), "unmanaged")
+	cx.assertEqual(1, len(res.Mismatched), "mismatched")
+}
+
+// ----- unit tests for inferSchema()
+
+func Test_inferSchema(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{setup: []string{
+		`create table "odd ""name""" (id integer primary key, n text)`,
+	}})
+	defer cleanup()
+	sch, err := inferSchema(tdb, `odd "name"`)
+	cx.assertErrorNil(err, "inferSchema")
+	if !cx.assertEqual(2, len(sch.Fields), "number of fields") {
+		return
+	}
+	cx.assertEqual("id", sch.Fields[0].Name, "field 0")
+	cx.assertEqual("is_primary_key",
+		strings.Join(sch.Fields[0].Properties, ","), "field 0 properties")
+	cx.assertEqual(0, len(sch.Fields[1].Properties), "field 1 properties")
+}
+
+// ----- unit tests for schemaDiff()
+
+// inputs and outputs for one schemaDiff testcase.
+type schemaDiff_TC struct {
+	schema string
+	fields []string
+	xok bool
+	xmissing string
+	xextra string
+}
+
+// table of schemaDiff testcases.
+var schemaDiff_Tab = []schemaDiff_TC {
+	{ `{"fields":[{"name":"a"},{"name":"b"}]}`, []string{"a", "b"},
+		true, "", "" },
+	{ `{"Fields":[{"Name":"b"},{"Name":"a"}]}`, []string{"a", "b"},
+		true, "", "" },
+	{ `{"fields":[{"name":"a"},{"name":"b"}]}`, []string{"a", "c"},
+		false, "b", "c" },
+	{ `{"fields":[]}`, []string{"a"},
+		false, "", "a" },
+	{ `{"fields":[{"name":"a"}]}`, []string{},
+		false, "a", "" },
+	{ `not json`, []string{"a"},
+		false, "", "" },
+}
+
+// run one testcase for function schemaDiff.
+func schemaDiff_Checker(cx *testContext, tc *schemaDiff_TC) {
+	actual := TableSchema{}
+	for _, f := range tc.fields {
+		actual.Fields = append(actual.Fields, FieldSchema{Name: f})
+	}
+	d, ok := schemaDiff("t", tc.schema, actual)
+	cx.assertEqual(tc.xok, ok, "ok")
+	cx.assertEqual(tc.xmissing, strings.Join(d.Missing, ","), "missing")
+	cx.assertEqual(tc.xextra, strings.Join(d.Extra, ","), "extra")
+}
+
+// the schemaDiff test suite.  run all schemaDiff testcases.
+func Test_schemaDiff(t *testing.T) {
+	cx := newTestContext(t, "schemaDiff_Tab")
+	for _, tc := range schemaDiff_Tab {
+		schemaDiff_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for getDbReconcileHandler()
+
+func Test_getDbReconcileHandler(t *testing.T) {
+	cx := newTestContext(t)
+	res := getDbReconcileHandler(parseHandlerArg(http.MethodGet,
+		"/db/_admin/reconcile"))
+	cx.assertEqual(http.StatusOK, res.code, "returned code")
+	_, ok := res.data.(ReconcileResponse)
+	cx.assertEqual(true, ok, "response type")
+}
@@ -1,5 +1,9 @@
 package apidCRUD
 
+import (
+	"encoding/json"
+)
+
 // ----- types for parameter record and response structures
 
 // field tags are used to change the case of JSON keys
@@ -12,10 +16,27 @@ type NumChangedResponse struct {
 }
 
 // ErrorResponse is the response data for API errors.
+// Code is the http status; ErrorCode is a machine-readable error class.
+// Fields optionally lists every offending field, for validation errors.
 type ErrorResponse struct {
 	Code int	`json:"code"`
+	ErrorCode string	`json:"errorCode"`
 	Message string	`json:"message"`
 	Kind string	`json:"kind"`
+	Fields []FieldError	`json:"fields,omitempty"`
+	CorrelationId string	`json:"correlationId,omitempty"`
+	RequestId string	`json:"requestId,omitempty"`
+	dmsg string	// debug message, logged with the request; not sent.
+}
+
+// FieldError describes one offending field in a request.
+// Record is the index of the record in the request body,
+// or -1 if the field is a request parameter.
+type FieldError struct {
+	Record int	`json:"record"`
+	Field string	`json:"field"`
+	Rule string	`json:"rule"`
+	Message string	`json:"message"`
 }
 
 // KVRecord represents record data in requests, used in multiple APIs.
@@ -29,6 +50,12 @@ type BodyRecord struct {
 	Records []KVRecord
 }
 
+// ObjBodyRecord is the object-format alternative to BodyRecord,
+// where each record is a json object keyed by field name.
+type ObjBodyRecord struct {
+	Records []map[string]interface{}
+}
+
 // KVResponse represents data records returned from an API call.
 type KVResponse struct {
 	Keys []string	`json:"keys"`
@@ -43,6 +70,13 @@ type RecordsResponse struct {
 	Kind string	`json:"kind"`
 }
 
+// ObjRecordsResponse is the object-format alternative to RecordsResponse,
+// where each record is a json object keyed by field name.
+type ObjRecordsResponse struct {
+	Records []map[string]interface{} `json:"records"`
+	Kind string	`json:"kind"`
+}
+
 // IdsResponse is the type returned by createDbRecords .
 type IdsResponse struct {
 	Ids []int64	`json:"ids"`
@@ -67,16 +101,192 @@ type TableSchema struct {
 	Fields []FieldSchema
 }
 
-// SchemaResponse is the response format for table creation.
+// SchemaResponse is the response format for the describeDbTable API.
+// Definition is the schema given when the table was created,
+// or null if it is not valid json.  the other fields describe the
+// table as it is in the database; Exists is false if it is not.
 type SchemaResponse struct {
-	Schema string	`json:"schema"`
+	Name string	`json:"name"`
+	Definition json.RawMessage	`json:"definition"`
+	Exists bool	`json:"exists"`
+	Columns []ColumnInfo	`json:"columns"`
+	Indexes []IndexInfo	`json:"indexes"`
+	ForeignKeys []ForeignKeyInfo	`json:"foreignKeys"`
+	RowCount int64	`json:"rowCount"`
 	Kind string	`json:"kind"`
 	Self string	`json:"self"`
 }
 
+// ColumnInfo describes one column of a table.
+// Default is the SQL text of the default value, or null if none.
+type ColumnInfo struct {
+	Name string	`json:"name"`
+	Type string	`json:"type"`
+	Nullable bool	`json:"nullable"`
+	Default *string	`json:"default"`
+	PrimaryKey bool	`json:"primaryKey"`
+}
+
+// IndexInfo describes one index on a table.
+type IndexInfo struct {
+	Name string	`json:"name"`
+	Unique bool	`json:"unique"`
+	Columns []string	`json:"columns"`
+}
+
+// ForeignKeyInfo describes one foreign key constraint on a table.
+// Columns of the table reference the same number of Table's References.
+type ForeignKeyInfo struct {
+	Columns []string	`json:"columns"`
+	Table string	`json:"table"`
+	References []string	`json:"references"`
+	OnUpdate string	`json:"onUpdate"`
+	OnDelete string	`json:"onDelete"`
+}
+
 // ServiceResponse is the response format for the describeService API.
 type ServiceResponse struct {
 	Description string `json:"resource"`
 	Kind string	`json:"kind"`
 	Self string	`json:"self"`
 }
+
+// BatchOperation is one create/update/delete/get operation in a batch.
+// Id and the items of Record.Values may be an object of the form
+// {"$ref": N}, which stands for the id created by operation N
+// earlier in the same batch.
+type BatchOperation struct {
+	Op string
+	Table string
+	Id interface{}
+	IdField string
+	Fields string
+	Record KVRecord
+}
+
+// BatchRequest is the body data for the runDbBatch API.
+type BatchRequest struct {
+	Operations []BatchOperation
+}
+
+// BatchResult is the result of one operation in a batch.
+type BatchResult struct {
+	Op string	`json:"op"`
+	Ids []int64	`json:"ids,omitempty"`
+	NumChanged int64	`json:"numChanged"`
+	Records []*KVResponse	`json:"records,omitempty"`
+	Kind string	`json:"kind"`
+}
+
+// BatchResponse is the response data for the runDbBatch API.
+type BatchResponse struct {
+	Results []BatchResult	`json:"results"`
+	Kind string	`json:"kind"`
+}
+
+// HealthResponse is the type returned by getDbHealth.
+type HealthResponse struct {
+	Status string	`json:"status"`
+	Kind string	`json:"kind"`
+}
+
+// ReadyCheck is the result of one readiness check.
+type ReadyCheck struct {
+	Name string	`json:"name"`
+	Ok bool	`json:"ok"`
+	Message string	`json:"message,omitempty"`
+}
+
+// ReadyResponse is the type returned by getDbReady.
+type ReadyResponse struct {
+	Status string	`json:"status"`
+	Checks []ReadyCheck	`json:"checks"`
+	Kind string	`json:"kind"`
+}
+
+// TableDiff describes how a table differs from its schema in the catalog.
+// Missing fields are in the catalog schema but not the table;
+// Extra fields are in the table but not the catalog schema.
+type TableDiff struct {
+	Table string	`json:"table"`
+	Missing []string	`json:"missing,omitempty"`
+	Extra []string	`json:"extra,omitempty"`
+	Message string	`json:"message,omitempty"`
+}
+
+// BackupResponse describes a database snapshot.
+// it is the response data for runDbBackup and runDbRestore.
+type BackupResponse struct {
+	Name string	`json:"name"`
+	Size int64	`json:"size"`
+	Time string	`json:"time"`
+	Kind string	`json:"kind"`
+}
+
+// BackupsResponse is the type returned by getDbBackups.
+type BackupsResponse struct {
+	Backups []BackupResponse	`json:"backups"`
+	Kind string	`json:"kind"`
+	Self string	`json:"self"`
+}
+
+// RestoreRequest is the request body of runDbRestore.
+type RestoreRequest struct {
+	Name string	`json:"name"`
+}
+
+// DumpRecord is one record of a dump.
+type DumpRecord struct {
+	Keys []string	`json:"keys"`
+	Values []interface{}	`json:"values"`
+}
+
+// DumpTable is one table of a dump: its schema, as in the table
+// of tables, and all its records.
+type DumpTable struct {
+	Name string	`json:"name"`
+	Schema TableSchema	`json:"schema"`
+	Records []DumpRecord	`json:"records"`
+}
+
+// DumpResponse is a dump of a database.  it is the response data
+// for getDbDump, and the request body of runDbLoad.
+type DumpResponse struct {
+	Version int	`json:"version"`
+	Tables []DumpTable	`json:"tables"`
+	Kind string	`json:"kind"`
+}
+
+// DumpLine is one line of a dump in NDJSON: the header, with Kind
+// and Version; a table, with Table and Schema; a record of the
+// table, with Table, Keys and Values; or the trailer, with Kind
+// "DumpEnd" and the numbers of Tables and Records in the dump.
+type DumpLine struct {
+	Kind string	`json:"kind,omitempty"`
+	Version int	`json:"version,omitempty"`
+	Table string	`json:"table,omitempty"`
+	Schema *TableSchema	`json:"schema,omitempty"`
+	Keys []string	`json:"keys,omitempty"`
+	Values []interface{}	`json:"values,omitempty"`
+	Tables int	`json:"tables,omitempty"`
+	Records int64	`json:"records,omitempty"`
+}
+
+// LoadResponse is the response data for runDbLoad.
+type LoadResponse struct {
+	Tables []string	`json:"tables"`
+	NumRecords int64	`json:"numRecords"`
+	Kind string	`json:"kind"`
+}
+
+// ReconcileResponse is the response data for the reconcile APIs.
+// Unmanaged tables exist but are not in the catalog;
+// Imported lists those that were added to it.
+// Orphans are in the catalog but do not exist.
+type ReconcileResponse struct {
+	Unmanaged []string	`json:"unmanaged"`
+	Imported []string	`json:"imported"`
+	Orphans []string	`json:"orphans"`
+	Mismatched []TableDiff	`json:"mismatched"`
+	Kind string	`json:"kind"`
+}
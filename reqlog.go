@@ -0,0 +1,117 @@
+package apidCRUD
+
+// this module implements request ids and access logging.
+// every API call gets a request id, taken from the client's
+// X-Request-ID header if it supplied a usable one, or generated.
+// the id is returned in the X-Request-ID response header and in
+// ErrorResponse, and is attached to every log line emitted while
+// handling the request.
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/apid/apid-core"
+)
+
+// requestIdHeader is the header that carries the request id.
+const requestIdHeader = "X-Request-ID"
+
+// maxRequestIdLen is the max length of a client-supplied request id.
+const maxRequestIdLen = 128
+
+// ctxKey is the type of keys of values we store in a request context.
+type ctxKey int
+
+// requestIdKey is the context key of the request id.
+const requestIdKey ctxKey = 0
+
+// validRequestId() returns true iff the given client-supplied
+// request id is safe to adopt: not too long, and printable ascii
+// without spaces.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestId() returns the given request, with a request id
+// stored in its context.
+func withRequestId(req *http.Request) *http.Request {
+	id := req.Header.Get(requestIdHeader)
+	if !validRequestId(id) {
+		id = newRandomId()
+	}
+	return req.WithContext(context.WithValue(req.Context(), requestIdKey, id))
+}
+
+// requestId() returns the request id stored in the given context,
+// or the empty string if there is none.
+func requestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey).(string)
+	return id
+}
+
+// ctxLog() returns the logger to use for work done on behalf of
+// the request whose context is given.  its lines carry the request id.
+func ctxLog(ctx context.Context) apid.LogService {
+	id := requestId(ctx)
+	if id == "" {
+		return log
+	}
+	return log.WithField("request_id", id)
+}
+
+// accessWriter is an http.ResponseWriter that remembers what
+// is needed for the access log.
+type accessWriter struct {
+	http.ResponseWriter
+	code int
+	rows int
+}
+
+// WriteHeader() records the status code, and passes it on.
+func (aw *accessWriter) WriteHeader(code int) {
+	aw.code = code
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+// resultRows() returns the number of rows returned or affected,
+// as reported by the given apiHandlerRet data.
+func resultRows(data interface{}) int {
+	switch data := data.(type) {
+	case RecordsResponse:
+		return len(data.Records)
+	case ObjRecordsResponse:
+		return len(data.Records)
+	case IdsResponse:
+		return len(data.Ids)
+	case NumChangedResponse:
+		return int(data.NumChanged)
+	case BatchResponse:
+		return len(data.Results)
+	}
+	return 0
+}
+
+// logAccess() emits the access log line for a finished request.
+func logAccess(req *http.Request,
+		table string,
+		aw *accessWriter,
+		duration time.Duration) {
+	ctxLog(req.Context()).
+		WithField("method", req.Method).
+		WithField("path", req.URL.Path).
+		WithField("table", table).
+		WithField("status", aw.code).
+		WithField("duration_ms", duration.Seconds() * 1000).
+		WithField("rows", aw.rows).
+		Infof("access")
+}
@@ -0,0 +1,143 @@
+package apidCRUD
+
+import (
+	"testing"
+	"strings"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+)
+
+// ----- unit tests for validRequestId()
+
+// inputs and outputs for one validRequestId testcase.
+type validRequestId_TC struct {
+	id string
+	xres bool
+}
+
+// table of validRequestId testcases.
+var validRequestId_Tab = []validRequestId_TC {
+	{ "", false },
+	{ "abc-123", true },
+	{ "a.b:c_d/e", true },
+	{ "has space", false },
+	{ "tab\there", false },
+	{ "café", false },
+	{ strings.Repeat("x", maxRequestIdLen), true },
+	{ strings.Repeat("x", maxRequestIdLen+1), false },
+}
+
+// run one testcase for function validRequestId.
+func validRequestId_Checker(cx *testContext, tc *validRequestId_TC) {
+	cx.assertEqual(tc.xres, validRequestId(tc.id), "result")
+}
+
+// the validRequestId test suite.  run all validRequestId testcases.
+func Test_validRequestId(t *testing.T) {
+	cx := newTestContext(t, "validRequestId_Tab")
+	for _, tc := range validRequestId_Tab {
+		validRequestId_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for request ids thru ServeHTTP().
+
+// inputs and outputs for one request-id testcase.
+type requestIdServe_TC struct {
+	path string
+	reqId string
+	xcode int
+	xsame bool	// true iff the given id s/b adopted.
+}
+
+// table of request-id testcases.
+var requestIdServe_Tab = []requestIdServe_TC {
+	{ "/abc", "client-id-1", abcGetRet, true },
+	{ "/abc", "", abcGetRet, false },
+	{ "/abc", "bad id", abcGetRet, false },
+	{ "/nosuch", "client-id-2", http.StatusNotFound, true },
+	{ "/xyz", "client-id-3", http.StatusMethodNotAllowed, true },
+}
+
+// run one testcase for request ids.
+func requestIdServe_Checker(cx *testContext, ws *apiWiring, tc *requestIdServe_TC) {
+	r, _ := http.NewRequest(http.MethodGet, tc.path, strings.NewReader(""))
+	if tc.reqId != "" {
+		r.Header.Set(requestIdHeader, tc.reqId)
+	}
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	if !cx.assertEqual(tc.xcode, w.Code, "returned code") {
+		return
+	}
+	id := w.Header().Get(requestIdHeader)
+	if tc.xsame {
+		cx.assertEqual(tc.reqId, id, "request id")
+	} else {
+		cx.assertTrue(validRequestId(id) && id != tc.reqId,
+			"request id s/b generated")
+	}
+	if tc.xcode < badStat {
+		return
+	}
+	erec := &ErrorResponse{}
+	_ = json.Unmarshal(w.Body.Bytes(), erec)
+	cx.assertEqual(id, erec.RequestId, "ErrorResponse requestId")
+}
+
+// the request-id test suite.  run all requestIdServe testcases.
+func Test_requestIdServe(t *testing.T) {
+	cx := newTestContext(t, "requestIdServe_Tab")
+	ws := newApiWiring("", fakeApiTable, defaultMiddleware...)
+	for _, tc := range requestIdServe_Tab {
+		requestIdServe_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for resultRows()
+
+// inputs and outputs for one resultRows testcase.
+type resultRows_TC struct {
+	data interface{}
+	xres int
+}
+
+// table of resultRows testcases.
+var resultRows_Tab = []resultRows_TC {
+	{ "abc", 0 },
+	{ erdata, 0 },
+	{ RecordsResponse{Records: []*KVResponse{nil, nil}}, 2 },
+	{ ObjRecordsResponse{Records: []map[string]interface{}{nil}}, 1 },
+	{ IdsResponse{Ids: []int64{1, 2, 3}}, 3 },
+	{ NumChangedResponse{NumChanged: 4}, 4 },
+	{ BatchResponse{Results: []BatchResult{{}}}, 1 },
+}
+
+// run one testcase for function resultRows.
+func resultRows_Checker(cx *testContext, tc *resultRows_TC) {
+	cx.assertEqual(tc.xres, resultRows(tc.data), "result")
+}
+
+// the resultRows test suite.  run all resultRows testcases.
+func Test_resultRows(t *testing.T) {
+	cx := newTestContext(t, "resultRows_Tab")
+	for _, tc := range resultRows_Tab {
+		resultRows_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for accessWriter
+
+func Test_accessWriter(t *testing.T) {
+	cx := newTestContext(t)
+	w := httptest.NewRecorder()
+	aw := &accessWriter{w, http.StatusOK, 0}
+	aw.WriteHeader(http.StatusCreated)
+	cx.assertEqual(http.StatusCreated, aw.code, "recorded code")
+	cx.bump()
+	cx.assertEqual(http.StatusCreated, w.Code, "passed-on code")
+}
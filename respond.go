@@ -0,0 +1,169 @@
+package apidCRUD
+
+// this module deals with the encoding of API responses:
+// the Content-Type header, compression negotiated by Accept-Encoding,
+// and conditional requests based on ETag and Last-Modified.
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// media types of response bodies.
+const (
+	jsonType = "application/json"
+	textType = "text/plain; charset=utf-8"
+)
+
+// supported content codings, in order of preference.
+var contentCodings = []string{"gzip", "deflate"}
+
+// responseContentType() returns the Content-Type for the given
+// apiHandlerRet data.  data that convData() passes thru unchanged
+// is text; anything else is converted to json.
+func responseContentType(data interface{}) string {
+	switch data.(type) {
+	case []byte, string:
+		return textType
+	default:
+		return jsonType
+	}
+}
+
+// codingQuality() returns the quality value given to the named coding
+// in an Accept-Encoding header, or 0 if it is not acceptable.
+func codingQuality(acceptEnc string, coding string) float64 {
+	ret := 0.0
+	for _, item := range strings.Split(acceptEnc, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.TrimSpace(parts[0])
+		if name != coding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, _ = strconv.ParseFloat(p[2:], 64)
+			}
+		}
+		if name == coding {
+			// an explicit entry overrides the wildcard.
+			return q
+		}
+		ret = q
+	}
+	return ret
+}
+
+// negotiateCoding() returns the content coding to use for a response,
+// given the request's Accept-Encoding header.
+// the empty string means no compression.
+func negotiateCoding(acceptEnc string) string {
+	best, bestq := "", 0.0
+	for _, coding := range contentCodings {
+		q := codingQuality(acceptEnc, coding)
+		if q > bestq {
+			best, bestq = coding, q
+		}
+	}
+	return best
+}
+
+// compressData() returns data compressed with the given coding.
+func compressData(coding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch coding {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	default:
+		zw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressResponse() compresses a successful response body of at least
+// compressMinSize bytes, if the client accepts a supported coding.
+// the response headers are updated to match.
+// the returned data is what should be written as the body.
+func compressResponse(hdr http.Header,
+		req *http.Request,
+		code int,
+		rawdata []byte) []byte {
+	if code < 200 || code >= 300 || len(rawdata) < compressMinSize {
+		return rawdata
+	}
+	hdr.Add("Vary", "Accept-Encoding")
+	coding := negotiateCoding(req.Header.Get("Accept-Encoding"))
+	if coding == "" {
+		return rawdata
+	}
+	zdata, err := compressData(coding, rawdata)
+	if err != nil {
+		ctxLog(req.Context()).Errorf("compressResponse %s: %s",
+			coding, err)
+		return rawdata
+	}
+	hdr.Set("Content-Encoding", coding)
+	return zdata
+}
+
+// checkModified() sets the ETag and Last-Modified response headers
+// from the given modification counter and time, and returns true iff
+// the request shows the client already has the current version.
+// if the request has If-None-Match, it is compared with the ETag,
+// which changes with every modification; otherwise If-Modified-Since
+// is compared with Last-Modified.  http dates are in whole seconds,
+// so a modification later in the same second is seen only by ETag.
+func checkModified(harg *apiHandlerArg, count uint64,
+		modTime time.Time) bool {
+	etag := modETag(count)
+	lastMod := modTime.Truncate(time.Second)
+	harg.header.Set("ETag", etag)
+	harg.header.Set("Last-Modified", lastMod.UTC().Format(http.TimeFormat))
+	if inm := harg.req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	ims := harg.req.Header.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastMod.After(since)
+}
+
+// modETag() returns the entity tag for the given modification counter.
+// counters restart with the plugin, so the tag includes its start time.
+func modETag(count uint64) string {
+	return fmt.Sprintf(`"%x-%d"`, startTime.UnixNano(), count)
+}
+
+// etagMatch() returns true iff the given If-None-Match header
+// names the given entity tag, or is "*".  as If-None-Match requires,
+// a weak tag matches a strong one with the same value.
+func etagMatch(inm string, etag string) bool {
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
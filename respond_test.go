@@ -0,0 +1,280 @@
+package apidCRUD
+
+import (
+	"testing"
+	"bytes"
+	"strings"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// ----- unit tests for negotiateCoding()
+
+// inputs and outputs for one negotiateCoding testcase.
+type negotiateCoding_TC struct {
+	acceptEnc string
+	xres string
+}
+
+// table of negotiateCoding testcases.
+var negotiateCoding_Tab = []negotiateCoding_TC {
+	{ "", "" },
+	{ "identity", "" },
+	{ "gzip", "gzip" },
+	{ "deflate", "deflate" },
+	{ "deflate, gzip", "gzip" },
+	{ "gzip;q=0.5, deflate", "deflate" },
+	{ "gzip;q=0, deflate;q=0", "" },
+	{ "*", "gzip" },
+	{ "*;q=0.1, deflate;q=0.2", "deflate" },
+	{ "br", "" },
+}
+
+// run one testcase for function negotiateCoding.
+func negotiateCoding_Checker(cx *testContext, tc *negotiateCoding_TC) {
+	cx.assertEqual(tc.xres, negotiateCoding(tc.acceptEnc), "coding")
+}
+
+// the negotiateCoding test suite.  run all negotiateCoding testcases.
+func Test_negotiateCoding(t *testing.T) {
+	cx := newTestContext(t, "negotiateCoding_Tab")
+	for _, tc := range negotiateCoding_Tab {
+		negotiateCoding_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for responseContentType()
+
+func Test_responseContentType(t *testing.T) {
+	cx := newTestContext(t)
+	cx.assertEqual(textType, responseContentType("abc"), "string")
+	cx.bump()
+	cx.assertEqual(textType, responseContentType([]byte("abc")), "bytes")
+	cx.bump()
+	cx.assertEqual(jsonType, responseContentType(erdata), "struct")
+}
+
+// ----- unit tests for compressResponse()
+
+// inputs and outputs for one compressResponse testcase.
+type compressResponse_TC struct {
+	acceptEnc string
+	code int
+	size int
+	xcoding string
+}
+
+// table of compressResponse testcases.
+var compressResponse_Tab = []compressResponse_TC {
+	{ "gzip", http.StatusOK, 2048, "gzip" },
+	{ "deflate", http.StatusOK, 2048, "deflate" },
+	{ "", http.StatusOK, 2048, "" },
+	{ "gzip", http.StatusOK, 10, "" },
+	{ "gzip", http.StatusNotFound, 2048, "" },
+}
+
+// run one testcase for function compressResponse.
+func compressResponse_Checker(cx *testContext, tc *compressResponse_TC) {
+	req, _ := http.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("Accept-Encoding", tc.acceptEnc)
+	hdr := http.Header{}
+	rawdata := []byte(strings.Repeat("x", tc.size))
+	data := compressResponse(hdr, req, tc.code, rawdata)
+	if !cx.assertEqual(tc.xcoding, hdr.Get("Content-Encoding"),
+			"Content-Encoding") {
+		return
+	}
+	if tc.xcoding != "gzip" {
+		return
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if !cx.assertErrorNil(err, "gzip.NewReader") {
+		return
+	}
+	unz, _ := ioutil.ReadAll(zr)
+	cx.assertEqualObj(rawdata, unz, "uncompressed data")
+}
+
+// the compressResponse test suite.  run all compressResponse testcases.
+func Test_compressResponse(t *testing.T) {
+	cx := newTestContext(t, "compressResponse_Tab")
+	for _, tc := range compressResponse_Tab {
+		compressResponse_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for checkModified()
+
+// inputs and outputs for one checkModified testcase.
+type checkModified_TC struct {
+	ims string
+	inm string
+	xres bool
+}
+
+// the modification state used by checkModified testcases.
+var cmCount = uint64(3)
+var cmModTime = time.Date(2017, 6, 1, 12, 0, 0, 500, time.UTC)
+
+// table of checkModified testcases.
+var checkModified_Tab = []checkModified_TC {
+	{ "", "", false },
+	{ "garbage", "", false },
+	{ "Thu, 01 Jun 2017 12:00:00 GMT", "", true },
+	{ "Thu, 01 Jun 2017 12:00:01 GMT", "", true },
+	{ "Thu, 01 Jun 2017 13:00:00 GMT", "", true },
+	{ "Thu, 01 Jun 2017 11:59:59 GMT", "", false },
+	{ "", modETag(3), true },
+	{ "", "W/" + modETag(3), true },
+	{ "", `"x", ` + modETag(3), true },
+	{ "", "*", true },
+	{ "", modETag(2), false },
+	{ "Thu, 01 Jun 2017 13:00:00 GMT", modETag(2), false },
+}
+
+// run one testcase for function checkModified.
+func checkModified_Checker(cx *testContext, tc *checkModified_TC) {
+	harg := parseHandlerArg(http.MethodGet, "/abc")
+	if tc.ims != "" {
+		harg.req.Header.Set("If-Modified-Since", tc.ims)
+	}
+	if tc.inm != "" {
+		harg.req.Header.Set("If-None-Match", tc.inm)
+	}
+	res := checkModified(harg, cmCount, cmModTime)
+	cx.assertEqual(tc.xres, res, "result")
+	cx.assertEqual("Thu, 01 Jun 2017 12:00:00 GMT",
+		harg.header.Get("Last-Modified"), "Last-Modified")
+	cx.assertEqual(modETag(cmCount), harg.header.Get("ETag"), "ETag")
+}
+
+// the checkModified test suite.  run all checkModified testcases.
+func Test_checkModified(t *testing.T) {
+	cx := newTestContext(t, "checkModified_Tab")
+	for _, tc := range checkModified_Tab {
+		checkModified_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for response headers written by pathDispatch().
+
+// a dummy handler that returns a large json value.
+func bigGetHandler(harg *apiHandlerArg) apiHandlerRet {
+	return apiHandlerRet{http.StatusOK, []string{strings.Repeat("x", 4096)}}
+}
+
+func Test_pathDispatchEncoding(t *testing.T) {
+	cx := newTestContext(t)
+	ws := newApiWiring("",
+		[]apiDesc{{ "/big", http.MethodGet, bigGetHandler, nil }})
+	r, _ := http.NewRequest(http.MethodGet, "/big", strings.NewReader(""))
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	cx.assertEqual(jsonType, w.Header().Get("Content-Type"), "Content-Type")
+	cx.bump()
+	cx.assertEqual("gzip", w.Header().Get("Content-Encoding"),
+		"Content-Encoding")
+	cx.bump()
+	cx.assertTrue(w.Body.Len() < 4096, "body s/b compressed")
+}
+
+// ----- unit tests for conditional requests on table listings.
+
+// inputs and outputs for one conditional-listing testcase.
+type conditionalListing_TC struct {
+	handler apiHandler
+	descStr string
+	ims string
+	xcode int
+}
+
+// table of conditional-listing testcases.
+// the table listing is checked before and after xxxcond is created.
+var conditionalListing_Tab = []conditionalListing_TC {
+	{ getDbTablesHandler, "/test/db/_table",
+		"Mon, 01 Jan 2001 00:00:00 GMT", http.StatusOK },
+	{ getDbTablesHandler, "/test/db/_table",
+		"Fri, 01 Jan 2100 00:00:00 GMT", http.StatusNotModified },
+	{ getDbRecordsHandler, "/test/db/_table/xxxcond|table_name=xxxcond|ids=1",
+		"", http.StatusOK },
+	{ getDbRecordsHandler, "/test/db/_table/xxxcond|table_name=xxxcond|ids=1",
+		"Fri, 01 Jan 2100 00:00:00 GMT", http.StatusNotModified },
+	{ getDbRecordsHandler, "/test/db/_table/xxxcond|table_name=xxxcond|ids=1",
+		"Mon, 01 Jan 2001 00:00:00 GMT", http.StatusOK },
+	{ getDbRecordsHandler, "/test/db/_table/nosuch|table_name=nosuch|ids=1",
+		"Fri, 01 Jan 2100 00:00:00 GMT", http.StatusNotFound },
+}
+
+// run one testcase for a conditional listing.
+func conditionalListing_Checker(cx *testContext, tc *conditionalListing_TC) {
+	harg := parseHandlerArg(http.MethodGet, tc.descStr)
+	if tc.ims != "" {
+		harg.req.Header.Set("If-Modified-Since", tc.ims)
+	}
+	res := tc.handler(harg)
+	if !cx.assertEqual(tc.xcode, res.code, "returned code") ||
+			res.code >= http.StatusBadRequest {
+		return
+	}
+	cx.assertTrue(harg.header.Get("Last-Modified") != "",
+		"Last-Modified s/b set")
+	cx.assertTrue(harg.header.Get("ETag") != "", "ETag s/b set")
+}
+
+// the conditional-listing test suite.
+func Test_conditionalListing(t *testing.T) {
+	cx := newTestContext(t, "conditionalListing_Tab")
+	setup := []apiCall_TC {
+		{"setup: create table xxxcond",
+			createDbTableHandler,
+			http.MethodPost,
+			`/test/db/_schema/xxxcond|table_name=xxxcond||`+users_schema,
+			http.StatusCreated, noCheck},
+		{"setup: create db record 1",
+			createDbRecordsHandler,
+			http.MethodPost,
+			`/test/db/_table/xxxcond|table_name=xxxcond||{"records":[{"keys":["name","uri"],"values":["name-a","uri-a"]}]}`,
+			http.StatusCreated, noCheck},
+	}
+	apiCalls_Runner(t, "conditionalListing setup", setup)
+	for _, tc := range conditionalListing_Tab {
+		conditionalListing_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+	_ = deleteTable(db, "xxxcond")
+}
+
+// a client sending back the validators it was given is answered
+// Not Modified, until the table changes again.  a change in the same
+// second is seen by the ETag, though not by Last-Modified.
+func Test_conditionalListing_revalidate(t *testing.T) {
+	cx := newTestContext(t)
+	noteTableChange("", "xxxsame")
+	count, modTime := tableModState("", "xxxsame")
+	harg := parseHandlerArg(http.MethodGet, "/test/db/_table")
+	checkModified(harg, count, modTime)
+	lastMod := harg.header.Get("Last-Modified")
+	etag := harg.header.Get("ETag")
+
+	harg = parseHandlerArg(http.MethodGet, "/test/db/_table")
+	harg.req.Header.Set("If-Modified-Since", lastMod)
+	cx.assertEqual(true, checkModified(harg, count, modTime),
+		"Last-Modified sent back")
+	cx.bump()
+	harg.req.Header.Set("If-None-Match", etag)
+	cx.assertEqual(true, checkModified(harg, count, modTime),
+		"ETag sent back")
+	cx.bump()
+
+	noteTableChange("", "xxxsame")
+	count, modTime = tableModState("", "xxxsame")
+	cx.assertEqual(false, checkModified(harg, count, modTime),
+		"ETag after change")
+}
@@ -0,0 +1,94 @@
+package apidCRUD
+
+// this module implements the path-pattern matching used by apiWiring
+// to route an incoming request path to its verbMap, and to extract
+// the path parameters, without help from the host server.
+
+import (
+	"sort"
+	"strings"
+)
+
+// routeSeg is one segment of a path pattern.
+// it is either literal text, or a parameter written as {name}.
+type routeSeg struct {
+	text string
+	isParam bool
+}
+
+// route is one compiled path pattern, and the verbMap it routes to.
+type route struct {
+	segs []routeSeg
+	vmap verbMap
+}
+
+// splitPath() returns the segments of a path.
+// leading and trailing slashes are ignored, so "/a/b/" and "/a/b"
+// are equivalent.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+// parsePattern() compiles a path pattern such as
+// "/db/_table/{table_name}/{id}" into its segments.
+func parsePattern(pattern string) []routeSeg {
+	parts := splitPath(pattern)
+	ret := make([]routeSeg, len(parts))
+	for i, p := range parts {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			ret[i] = routeSeg{p[1 : len(p)-1], true}
+		} else {
+			ret[i] = routeSeg{p, false}
+		}
+	}
+	return ret
+}
+
+// matchRoute() checks whether the given path segments match the route.
+// if so, the values of the route's parameters are returned.
+// a parameter never matches an empty segment.
+func matchRoute(rt *route, parts []string) (map[string]string, bool) {
+	if len(parts) != len(rt.segs) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, seg := range rt.segs {
+		switch {
+		case seg.isParam && parts[i] != "":
+			params[seg.text] = parts[i]
+		case !seg.isParam && parts[i] == seg.text:
+			// literal matched
+		default:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// routeBefore() returns true iff route a should be tried before route b.
+// routes are ordered by their number of segments, which can't both
+// match a path, then at the first segment where they differ in kind,
+// a literal segment takes precedence over a parameter.
+// this is a total order on the kinds of segments, as sorting needs.
+func routeBefore(a *route, b *route) bool {
+	if len(a.segs) != len(b.segs) {
+		return len(a.segs) < len(b.segs)
+	}
+	for i := range a.segs {
+		if a.segs[i].isParam != b.segs[i].isParam {
+			return !a.segs[i].isParam
+		}
+	}
+	return false
+}
+
+// sortRoutes() orders the given routes so that the first match wins.
+func sortRoutes(routes []*route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routeBefore(routes[i], routes[j])
+	})
+}
@@ -0,0 +1,258 @@
+package apidCRUD
+
+// this module describes tables, combining the schema stored in the
+// table of tables with what sqlite says about the table itself.
+// descriptions are cached until the table is next changed thru the API;
+// changes made outside the API are seen only on a refresh.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// schemaCacheEntry is a cached table description.  it is valid while
+// the table's modification counter (see tableModState()) is unchanged.
+type schemaCacheEntry struct {
+	count uint64
+	desc SchemaResponse
+}
+
+// schemaCache holds the cached table descriptions, by table.
+// it must be accessed with schemaCacheLock held.
+var schemaCache = map[tableKey]schemaCacheEntry{}
+
+// schemaCacheLock guards schemaCache.
+var schemaCacheLock sync.Mutex
+
+// cachedDescription() returns the description of the named table
+// of the given database from the cache, if there is a valid one.
+func cachedDescription(db dbType, tabName string) (SchemaResponse, bool) {
+	count, _ := tableModState(db.name, tabName)
+	schemaCacheLock.Lock()
+	defer schemaCacheLock.Unlock()
+	ent, ok := schemaCache[tableKey{db.name, tabName}]
+	if !ok || ent.count != count {
+		return SchemaResponse{}, false
+	}
+	return ent.desc, true
+}
+
+// cacheDescription() saves the description of the named table
+// of the given database, as of the given modification counter.
+func cacheDescription(db dbType,
+	tabName string,
+	count uint64,
+	desc SchemaResponse) {
+	schemaCacheLock.Lock()
+	defer schemaCacheLock.Unlock()
+	schemaCache[tableKey{db.name, tabName}] = schemaCacheEntry{count, desc}
+}
+
+// describeTable() returns the description of the named table.
+// unless refresh is true, a cached description may be returned.
+// it returns a notFoundError if the table neither exists
+// nor is in the table of tables.
+func describeTable(db dbType, tabName string, refresh bool) (SchemaResponse, error) {
+	if err := db.sqlOnly("table introspection"); err != nil {
+		return SchemaResponse{}, err
+	}
+	if !refresh {
+		if desc, ok := cachedDescription(db, tabName); ok {
+			return desc, nil
+		}
+	}
+	// note the counter first, so a change made meanwhile
+	// invalidates what we cache.
+	count, _ := tableModState(db.name, tabName)
+	desc, err := introspectTable(db, tabName)
+	if err == nil {
+		cacheDescription(db, tabName, count, desc)
+	}
+	return desc, err
+}
+
+// introspectTable() builds the description of the named table.
+func introspectTable(db dbType, tabName string) (SchemaResponse, error) {
+	ret := SchemaResponse{
+		Name: tabName,
+		Columns: []ColumnInfo{},
+		Indexes: []IndexInfo{},
+		ForeignKeys: []ForeignKeyInfo{},
+		Kind: "SchemaResponse",
+	}
+	schema, inCatalog, err := catalogSchema(db, tabName)
+	if err != nil {
+		return ret, err
+	}
+	if json.Valid([]byte(schema)) {
+		ret.Definition = json.RawMessage(schema)
+	}
+	ret.Exists, err = tableExists(db, tabName)
+	if err != nil {
+		return ret, err
+	}
+	if !ret.Exists {
+		if !inCatalog {
+			return ret, notFoundError(
+				fmt.Errorf("no such table %s", tabName))
+		}
+		return ret, nil
+	}
+
+	if ret.Columns, err = tableColumns(db, tabName); err != nil {
+		return ret, err
+	}
+	if ret.Indexes, err = tableIndexes(db, tabName); err != nil {
+		return ret, err
+	}
+	if ret.ForeignKeys, err = tableForeignKeys(db, tabName); err != nil {
+		return ret, err
+	}
+	err = db.handle.QueryRowContext(db.context(),
+		fmt.Sprintf("select count(*) from %s", db.dialect().quote(tabName))).
+		Scan(&ret.RowCount)
+	return ret, err
+}
+
+// catalogSchema() returns the schema of the named table
+// stored in the table of tables, and whether there is one.
+func catalogSchema(db dbType, tabName string) (string, bool, error) {
+	var schema string
+	err := db.handle.QueryRowContext(db.context(),
+		fmt.Sprintf("select schema from %s where name = ?",
+			db.dialect().quote(tableOfTables)),
+		tabName).Scan(&schema)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return schema, err == nil, err
+}
+
+// tableExists() returns true iff the named table exists in the database.
+func tableExists(db dbType, tabName string) (bool, error) {
+	var n int
+	err := db.handle.QueryRowContext(db.context(),
+		"select count(*) from sqlite_master where type = 'table' and name = ?",
+		tabName).Scan(&n)
+	return n > 0, err
+}
+
+// tableColumns() returns the columns of the named table, in order.
+func tableColumns(db dbType, tabName string) ([]ColumnInfo, error) {
+	rows, err := db.handle.QueryContext(db.context(),
+		`select name, type, "notnull", dflt_value, pk
+		from pragma_table_info(?) order by cid`, tabName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+	ret := []ColumnInfo{}
+	for rows.Next() {
+		var col ColumnInfo
+		var notnull, pk int
+		var dflt sql.NullString
+		err = rows.Scan(&col.Name, &col.Type, &notnull, &dflt, &pk)
+		if err != nil {
+			return nil, err
+		}
+		col.Nullable = notnull == 0
+		col.PrimaryKey = pk > 0
+		if dflt.Valid {
+			col.Default = &dflt.String
+		}
+		ret = append(ret, col)
+	}
+	return ret, rows.Err()
+}
+
+// tableIndexes() returns the indexes on the named table,
+// including those sqlite creates for unique constraints.
+func tableIndexes(db dbType, tabName string) ([]IndexInfo, error) {
+	rows, err := db.handle.QueryContext(db.context(),
+		`select name, "unique" from pragma_index_list(?) order by name`,
+		tabName)
+	if err != nil {
+		return nil, err
+	}
+	ret := []IndexInfo{}
+	for rows.Next() {
+		var idx IndexInfo
+		if err = rows.Scan(&idx.Name, &idx.Unique); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		ret = append(ret, idx)
+	}
+	// finish with rows before querying again, in case the
+	// database allows only one connection.
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		ret[i].Columns, err = indexColumns(db, ret[i].Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// indexColumns() returns the names of the columns of the named index.
+func indexColumns(db dbType, idxName string) ([]string, error) {
+	rows, err := db.handle.QueryContext(db.context(),
+		"select name from pragma_index_info(?) order by seqno", idxName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+	ret := []string{}
+	for rows.Next() {
+		var name sql.NullString	// null for an expression.
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		ret = append(ret, name.String)
+	}
+	return ret, rows.Err()
+}
+
+// tableForeignKeys() returns the foreign key constraints
+// on the named table.
+func tableForeignKeys(db dbType, tabName string) ([]ForeignKeyInfo, error) {
+	rows, err := db.handle.QueryContext(db.context(),
+		`select id, "table", "from", "to", on_update, on_delete
+		from pragma_foreign_key_list(?) order by id, seq`, tabName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+	ret := []ForeignKeyInfo{}
+	lastId := -1
+	for rows.Next() {
+		var id int
+		var table, from, onUpdate, onDelete string
+		var to sql.NullString	// null for the parent's primary key.
+		err = rows.Scan(&id, &table, &from, &to, &onUpdate, &onDelete)
+		if err != nil {
+			return nil, err
+		}
+		// a constraint on several columns has a row for each.
+		if id != lastId {
+			ret = append(ret, ForeignKeyInfo{
+				Columns: []string{},
+				Table: table,
+				References: []string{},
+				OnUpdate: onUpdate,
+				OnDelete: onDelete,
+			})
+			lastId = id
+		}
+		fk := &ret[len(ret)-1]
+		fk.Columns = append(fk.Columns, from)
+		fk.References = append(fk.References, to.String)
+	}
+	return ret, rows.Err()
+}
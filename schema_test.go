@@ -0,0 +1,107 @@
+package apidCRUD
+
+import (
+	"testing"
+	"encoding/json"
+	"strings"
+)
+
+// ----- unit tests for introspectTable()
+
+// the introspectTable test suite.
+func Test_introspectTable(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{})
+	defer cleanup()
+	cx.assertErrorNil(migrateCatalog(tdb), "migrateCatalog")
+	cmds := []string{
+		`create table owners (id integer primary key, name text)`,
+		`create table pets (id integer primary key,
+			name text not null default 'rex',
+			owner integer references owners(id) on delete cascade,
+			tag text unique)`,
+		`create index pets_name on pets (name, owner)`,
+		`insert into pets (name) values ("a"), ("b")`,
+		`insert into _tables_ (name, schema) values ("pets", '{"fields":[]}')`,
+	}
+	for _, cmd := range cmds {
+		_, err := tdb.handle.Exec(cmd)
+		cx.assertErrorNil(err, cmd)
+	}
+
+	desc, err := introspectTable(tdb, "pets")
+	if !cx.assertErrorNil(err, "introspectTable") {
+		return
+	}
+	cx.assertEqual(`{"fields":[]}`, string(desc.Definition), "definition")
+	cx.assertEqual(true, desc.Exists, "exists")
+	cx.assertEqual(int64(2), desc.RowCount, "rowCount")
+	if cx.assertEqual(4, len(desc.Columns), "number of columns") {
+		cx.assertEqual(true, desc.Columns[0].PrimaryKey, "id primaryKey")
+		name := desc.Columns[1]
+		cx.assertEqual("text", strings.ToLower(name.Type), "name type")
+		cx.assertEqual(false, name.Nullable, "name nullable")
+		if cx.assertTrue(name.Default != nil, "name default") {
+			cx.assertEqual("'rex'", *name.Default, "name default")
+		}
+		cx.assertEqual(true, desc.Columns[2].Nullable, "owner nullable")
+		cx.assertTrue(desc.Columns[2].Default == nil, "owner default")
+	}
+	if cx.assertEqual(2, len(desc.Indexes), "number of indexes") {
+		idx := desc.Indexes[0]
+		cx.assertEqual("pets_name", idx.Name, "index name")
+		cx.assertEqual(false, idx.Unique, "index unique")
+		cx.assertEqual("name,owner", strings.Join(idx.Columns, ","),
+			"index columns")
+		cx.assertEqual(true, desc.Indexes[1].Unique, "tag index unique")
+	}
+	if cx.assertEqual(1, len(desc.ForeignKeys), "number of foreign keys") {
+		fk := desc.ForeignKeys[0]
+		cx.assertEqual("owner", strings.Join(fk.Columns, ","), "fk columns")
+		cx.assertEqual("owners", fk.Table, "fk table")
+		cx.assertEqual("id", strings.Join(fk.References, ","), "fk references")
+		cx.assertEqual("CASCADE", fk.OnDelete, "fk onDelete")
+	}
+
+	// a table not in the catalog has no definition.
+	desc, err = introspectTable(tdb, "owners")
+	cx.assertErrorNil(err, "introspectTable")
+	jdesc, _ := json.Marshal(desc)
+	cx.assertTrue(strings.Contains(string(jdesc), `"definition":null`),
+		"null definition")
+
+	// a table that is nowhere.
+	_, err = introspectTable(tdb, "bogus")
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(404, code, "bogus table")
+}
+
+// ----- unit tests for describeTable()
+
+// the describeTable test suite.  a change made outside the API is
+// seen only on refresh, or after the table is changed thru the API.
+func Test_describeTable(t *testing.T) {
+	cx := newTestContext(t)
+	tdb, cleanup := mkTempDb(tempDbOpts{})
+	defer cleanup()
+	cx.assertErrorNil(migrateCatalog(tdb), "migrateCatalog")
+	tabName := "describe_cache_test"
+	_, err := tdb.handle.Exec("create table " + tabName + " (a text)")
+	cx.assertErrorNil(err, "create table")
+
+	ncols := func(refresh bool) int {
+		desc, err := describeTable(tdb, tabName, refresh)
+		cx.assertErrorNil(err, "describeTable")
+		return len(desc.Columns)
+	}
+	cx.assertEqual(1, ncols(false), "first")
+	_, err = tdb.handle.Exec("alter table " + tabName + " add column b text")
+	cx.assertErrorNil(err, "alter table")
+	cx.assertEqual(1, ncols(false), "cached")
+	cx.assertEqual(2, ncols(true), "refreshed")
+
+	_, err = tdb.handle.Exec("alter table " + tabName + " add column c text")
+	cx.assertErrorNil(err, "alter table")
+	noteTableChange("", tabName)
+	cx.assertEqual(3, ncols(false), "after change")
+}
@@ -0,0 +1,259 @@
+package apidCRUD
+
+// this module defines the interface between the handlers and the
+// database.  the handlers describe what they want in terms of tables,
+// records and transactions; a storage backend turns that into whatever
+// its database needs.  the backend is chosen by apidCRUD_db_driver.
+//
+// the default backend is sqlite (see store_sqlite.go).  the memory
+// backend (see store_memory.go) keeps everything in memory, and is
+// meant for tests.
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// recordQuery selects the records of a table that an operation applies to.
+type recordQuery struct {
+	table string
+	idField string	// the field that ids are matched against.
+	ids []int64	// the ids of the selected records; nil selects all.
+	fields []string	// the fields to retrieve; nil retrieves all.
+	limit int	// the max number of records to retrieve; 0 is no limit.
+	offset int	// the number of matching records to skip.
+	self string	// prefix of the self property of retrieved records.
+	keyField string	// orders the records, and ends their self; "" is id.
+}
+
+// key() returns the field that orders the selected records.
+func (q recordQuery) key() string {
+	if q.keyField == "" {
+		return "id"
+	}
+	return q.keyField
+}
+
+// recordStore is the set of record operations, and of reads of the
+// table of tables.  they may run directly on the database, or within
+// a transaction.
+type recordStore interface {
+	// ListTables() returns the names of the tables in the table of tables.
+	ListTables() ([]string, error)
+
+	// TableSchema() returns the schema of a table, as given when it
+	// was created.  it returns a notFoundError if the table is not
+	// in the table of tables.
+	TableSchema(tabName string) (TableSchema, error)
+
+	// CreateTable() creates a table with the given schema,
+	// and adds it to the table of tables.
+	CreateTable(tabName string, sch TableSchema) error
+
+	// Insert() creates a record, returning its id.
+	Insert(tabName string, rec KVRecord) (idType, error)
+
+	// Select() returns the selected records.  the id is not one
+	// of the returned fields, unless requested, but it is the
+	// last part of each record's self property.
+	Select(q recordQuery) ([]*KVResponse, error)
+
+	// Update() changes the given fields of the selected records,
+	// returning the number of records changed.
+	Update(q recordQuery, rec KVRecord) (idType, error)
+
+	// Delete() deletes the selected records,
+	// returning the number of records deleted.
+	Delete(q recordQuery) (idType, error)
+}
+
+// storage is the interface to a database.
+type storage interface {
+	recordStore
+
+	// Ping() checks that the database can be reached.
+	Ping() error
+
+	// DropTable() deletes a table,
+	// and removes it from the table of tables.
+	DropTable(tabName string) error
+
+	// Transact() calls the given function with a recordStore whose
+	// operations are done as a single transaction.  the transaction
+	// is committed if the function returns nil, otherwise it is
+	// rolled back and the function's error is returned.
+	Transact(txFunc func(tx recordStore) error) error
+
+	// withContext() returns a copy of the storage whose operations
+	// run in the given context.
+	withContext(ctx context.Context) storage
+}
+
+// storageDriver opens the named database.
+type storageDriver func(dbName string) (dbType, error)
+
+// storageDrivers maps each supported value of apidCRUD_db_driver
+// to the function that opens a database with that backend.
+var storageDrivers = map[string]storageDriver{
+	"sqlite3": openSqliteDB,
+	"memory": openMemoryDB,
+}
+
+// storage() returns the database's storage backend,
+// whose operations run in the wrapper's context.
+// a wrapper with no backend of its own is a sqlite database.
+// the changes made thru the backend are tracked.
+func (d dbType) storage() storage {
+	if d.store == nil {
+		return trackedStorage{sqliteStorage{d}, d.name}
+	}
+	return trackedStorage{d.store.withContext(d.context()), d.name}
+}
+
+// ----- change tracking
+
+// trackedRecords is a recordStore that records the changes
+// made thru it (see noteTableChange()) against the tables
+// of the named database.
+type trackedRecords struct {
+	recordStore
+	dbName string
+}
+
+// trackedStorage is a storage whose changes are tracked,
+// as for trackedRecords.
+type trackedStorage struct {
+	storage
+	dbName string
+}
+
+// CreateTable() creates a table, noting the change to the table list.
+func (r trackedRecords) CreateTable(tabName string, sch TableSchema) error {
+	err := r.recordStore.CreateTable(tabName, sch)
+	if err == nil {
+		noteTableListChange(r.dbName, tabName)
+	}
+	return err
+}
+
+// Insert() creates a record, noting the change to its table.
+func (r trackedRecords) Insert(tabName string, rec KVRecord) (idType, error) {
+	id, err := r.recordStore.Insert(tabName, rec)
+	if err == nil {
+		noteTableChange(r.dbName, tabName)
+	}
+	return id, err
+}
+
+// Update() changes the selected records, noting the change to their table.
+func (r trackedRecords) Update(q recordQuery, rec KVRecord) (idType, error) {
+	nc, err := r.recordStore.Update(q, rec)
+	if err == nil {
+		noteTableChange(r.dbName, q.table)
+	}
+	return nc, err
+}
+
+// Delete() deletes the selected records, noting the change to their table.
+func (r trackedRecords) Delete(q recordQuery) (idType, error) {
+	nc, err := r.recordStore.Delete(q)
+	if err == nil {
+		noteTableChange(r.dbName, q.table)
+	}
+	return nc, err
+}
+
+// records() returns the storage's record operations, tracked.
+func (s trackedStorage) records() trackedRecords {
+	return trackedRecords{s.storage, s.dbName}
+}
+
+// Insert() creates a record, noting the change to its table.
+func (s trackedStorage) Insert(tabName string, rec KVRecord) (idType, error) {
+	return s.records().Insert(tabName, rec)
+}
+
+// Update() changes the selected records, noting the change to their table.
+func (s trackedStorage) Update(q recordQuery, rec KVRecord) (idType, error) {
+	return s.records().Update(q, rec)
+}
+
+// Delete() deletes the selected records, noting the change to their table.
+func (s trackedStorage) Delete(q recordQuery) (idType, error) {
+	return s.records().Delete(q)
+}
+
+// CreateTable() creates a table, noting the change to the table list.
+func (s trackedStorage) CreateTable(tabName string, sch TableSchema) error {
+	return s.records().CreateTable(tabName, sch)
+}
+
+// DropTable() deletes a table, noting the change to the table list.
+func (s trackedStorage) DropTable(tabName string) error {
+	err := s.storage.DropTable(tabName)
+	if err == nil {
+		noteTableListChange(s.dbName, tabName)
+	}
+	return err
+}
+
+// Transact() calls the given function within a transaction,
+// with a recordStore whose changes are tracked.
+func (s trackedStorage) Transact(txFunc func(tx recordStore) error) error {
+	return s.storage.Transact(func(tx recordStore) error {
+		return txFunc(trackedRecords{tx, s.dbName})
+	})
+}
+
+// withContext() returns a copy of the storage whose operations
+// run in the given context.
+func (s trackedStorage) withContext(ctx context.Context) storage {
+	return trackedStorage{s.storage.withContext(ctx), s.dbName}
+}
+
+// isSQL() returns true iff the database is reached thru database/sql,
+// which is needed for features beyond the storage interface,
+// such as introspection.
+func (d dbType) isSQL() bool {
+	return d.store == nil
+}
+
+// sqlOnly() returns an error if the database is not reached
+// thru database/sql.  what names the feature needing it.
+func (d dbType) sqlOnly(what string) error {
+	if d.isSQL() {
+		return nil
+	}
+	return notImplementedError(fmt.Errorf(
+		"%s is not supported by the %s driver", what, dbDriver))
+}
+
+// newRecordQuery() returns the recordQuery described by the given
+// API parameters, which have already been validated.
+// the params examined include table_name, id_field, id or ids,
+// fields, limit and offset.  if id is specified, that is used;
+// otherwise ids.  if neither is specified, all records are selected.
+func newRecordQuery(params map[string]string) recordQuery {
+	q := recordQuery{
+		table: params["table_name"],
+		idField: params["id_field"],
+	}
+	if q.idField == "" {
+		q.idField = "id"
+	}
+	if id, ok := params["id"]; ok {
+		q.ids = []int64{aToIdType(id)}
+	} else if ids := params["ids"]; ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			q.ids = append(q.ids, aToIdType(id))
+		}
+	}
+	if fields := params["fields"]; fields != "" && fields != "*" {
+		q.fields = strings.Split(fields, ",")
+	}
+	q.limit, _ = strconv.Atoi(params["limit"])
+	q.offset, _ = strconv.Atoi(params["offset"])
+	return q
+}
@@ -0,0 +1,418 @@
+package apidCRUD
+
+import (
+	"testing"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ----- conformance tests for the storage backends
+
+// the same operations are run on each backend,
+// and must give the same results.
+
+// storageOp_TC is one step of the storage conformance test.
+// xcode is the expected status of the error, or 0 for success.
+type storageOp_TC struct {
+	title string
+	op func(st storage) (string, error)
+	xres string
+	xcode int
+}
+
+// confSchema is the schema of the table used in the conformance test.
+var confSchema = TableSchema{Fields: []FieldSchema{
+	{Name: "id", Properties: []string{"is_primary_key"}},
+	{Name: "name"},
+	{Name: "uri"},
+}}
+
+// confRec() returns a record with the given keys and values.
+func confRec(keys string, values ...interface{}) KVRecord {
+	return KVRecord{Keys: mySplit(keys, ","), Values: values}
+}
+
+// confQuery() returns a query on the conformance test table,
+// described by a string of params as for fakeParams().
+func confQuery(paramstr string) recordQuery {
+	q := newRecordQuery(fakeParams("table_name=conf&" + paramstr))
+	q.self = "self"
+	return q
+}
+
+// confSelect() returns a storage operation that selects records,
+// with the result formatted as "k=v,...;..." .
+func confSelect(paramstr string) func(st storage) (string, error) {
+	return func(st storage) (string, error) {
+		recs, err := st.Select(confQuery(paramstr))
+		res := make([]string, len(recs))
+		for i, rec := range recs {
+			kvs := make([]string, len(rec.Keys))
+			for j, k := range rec.Keys {
+				kvs[j] = fmt.Sprintf("%s=%v", k, rec.Values[j])
+			}
+			res[i] = strings.Join(kvs, ",")
+		}
+		return strings.Join(res, ";"), err
+	}
+}
+
+// confResult() formats the result of a storage operation.
+func confResult(n idType, err error) (string, error) {
+	return idTypeToA(int64(n)), err
+}
+
+// storageOp_Tab is the storage conformance test.  the steps run in order.
+var storageOp_Tab = []storageOp_TC {
+	{"create table",
+		func(st storage) (string, error) {
+			return "", st.CreateTable("conf", confSchema)
+		}, "", 0},
+	{"create existing table",
+		func(st storage) (string, error) {
+			return "", st.CreateTable("conf", confSchema)
+		}, "", 409},
+	{"list tables",
+		func(st storage) (string, error) {
+			names, err := st.ListTables()
+			return strings.Join(names, ","), err
+		}, "conf", 0},
+	{"table schema",
+		func(st storage) (string, error) {
+			sch, err := st.TableSchema("conf")
+			js, _ := json.Marshal(sch)
+			return string(js), err
+		}, `{"Fields":[{"Name":"id","Properties":["is_primary_key"]},{"Name":"name","Properties":null},{"Name":"uri","Properties":null}]}`, 0},
+	{"missing table schema",
+		func(st storage) (string, error) {
+			_, err := st.TableSchema("nosuch")
+			return "", err
+		}, "", 404},
+	{"table schema in a transaction",
+		func(st storage) (string, error) {
+			var res string
+			err := st.Transact(func(tx recordStore) error {
+				names, err := tx.ListTables()
+				if err != nil {
+					return err
+				}
+				sch, err := tx.TableSchema(names[0])
+				res = fmt.Sprintf("%s:%d", names[0], len(sch.Fields))
+				return err
+			})
+			return res, err
+		}, "conf:3", 0},
+	{"missing table schema in a transaction",
+		func(st storage) (string, error) {
+			return "", st.Transact(func(tx recordStore) error {
+				_, err := tx.TableSchema("nosuch")
+				return err
+			})
+		}, "", 404},
+	{"insert record 1",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf", confRec("name,uri", "a", "b")))
+		}, "1", 0},
+	{"insert record 2",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf", confRec("uri,name", 2.5, "c")))
+		}, "2", 0},
+	{"insert record with given id",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf",
+				confRec("id,name,uri", 7.0, "e", "f")))
+		}, "7", 0},
+	{"insert record with existing id",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf",
+				confRec("id,name,uri", 7.0, "e", "f")))
+		}, "-1", 409},
+	{"insert record missing field",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf", confRec("name", "x")))
+		}, "-1", 422},
+	{"insert record null field",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf", confRec("name,uri", "x", nil)))
+		}, "-1", 422},
+	{"insert record bogus field",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("conf", confRec("name,bogus", "x", "y")))
+		}, "-1", 422},
+	{"insert record bogus table",
+		func(st storage) (string, error) {
+			return confResult(st.Insert("bogus", confRec("name", "x")))
+		}, "-1", 404},
+	{"select all",
+		confSelect(""),
+		"id=1,name=a,uri=b;id=2,name=c,uri=2.5;id=7,name=e,uri=f", 0},
+	{"select by id",
+		confSelect("id=2&fields=name"),
+		"name=c", 0},
+	{"select by ids",
+		confSelect("ids=7,1&fields=uri,name"),
+		"uri=b,name=a;uri=f,name=e", 0},
+	{"select by other field",
+		confSelect("id_field=uri&id=2&fields=name"),
+		"", 0},
+	{"select with limit and offset",
+		confSelect("fields=name&limit=1&offset=1"),
+		"name=c", 0},
+	{"select past the end",
+		confSelect("fields=name&offset=5"),
+		"", 0},
+	{"select bogus field",
+		confSelect("fields=bogus"),
+		"", 422},
+	{"update record",
+		func(st storage) (string, error) {
+			return confResult(st.Update(confQuery("id=1"),
+				confRec("name", "x")))
+		}, "1", 0},
+	{"update missing record",
+		func(st storage) (string, error) {
+			return confResult(st.Update(confQuery("id=9"),
+				confRec("name", "x")))
+		}, "0", 0},
+	{"update to null",
+		func(st storage) (string, error) {
+			return confResult(st.Update(confQuery("id=1"),
+				confRec("name", nil)))
+		}, "-1", 422},
+	{"failed transaction",
+		func(st storage) (string, error) {
+			return "", st.Transact(func(tx recordStore) error {
+				_, err := tx.Update(confQuery("ids=1,2"),
+					confRec("name", "y"))
+				if err != nil {
+					return err
+				}
+				_, err = tx.Insert("conf", confRec("bogus", "z"))
+				return err
+			})
+		}, "", 422},
+	{"check rollback",
+		confSelect("fields=name"),
+		"name=x;name=c;name=e", 0},
+	{"transaction",
+		func(st storage) (string, error) {
+			return "", st.Transact(func(tx recordStore) error {
+				_, err := tx.Delete(confQuery("id=7"))
+				return err
+			})
+		}, "", 0},
+	{"delete records",
+		func(st storage) (string, error) {
+			return confResult(st.Delete(confQuery("ids=1,2,7")))
+		}, "2", 0},
+	{"check deletions",
+		confSelect(""),
+		"", 0},
+	{"drop table",
+		func(st storage) (string, error) {
+			return "", st.DropTable("conf")
+		}, "", 0},
+	{"drop missing table",
+		func(st storage) (string, error) {
+			return "", st.DropTable("conf")
+		}, "", 404},
+}
+
+// run one step of the storage conformance test.
+func storageOp_Checker(cx *testContext, st storage, tc *storageOp_TC) {
+	res, err := tc.op(st)
+	code := 0
+	if err != nil {
+		code, _ = classifyError(badStat, err)
+	}
+	if !cx.assertEqual(tc.xcode, code, tc.title + " status") {
+		cx.Errorf("error = %v", err)
+	}
+	if err == nil {
+		cx.assertEqual(tc.xres, res, tc.title)
+	}
+}
+
+// storageOp_Runner() runs the storage conformance test on a backend.
+func storageOp_Runner(t *testing.T, tabName string, st storage) {
+	cx := newTestContext(t, tabName)
+	for _, tc := range storageOp_Tab {
+		storageOp_Checker(cx, st, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+func Test_sqliteStorage(t *testing.T) {
+	tdb, cleanup := mkTempDb(tempDbOpts{})
+	defer cleanup()
+	if err := migrateCatalog(tdb); err != nil {
+		t.Fatalf("migrateCatalog: %s", err)
+	}
+	storageOp_Runner(t, "storageOp_Tab(sqlite)", tdb.storage())
+}
+
+func Test_memStorage(t *testing.T) {
+	mdb, _ := openMemoryDB("test")
+	storageOp_Runner(t, "storageOp_Tab(memory)", mdb.storage())
+}
+
+// ----- unit tests for initDB() driver selection
+
+func Test_initDB_drivers(t *testing.T) {
+	cx := newTestContext(t)
+	defer func(saved string) { dbDriver = saved }(dbDriver)
+
+	dbDriver = "memory"
+	mdb, err := initDB("test")
+	cx.assertErrorNil(err, "memory driver")
+	cx.assertTrue(!mdb.isSQL(), "memory driver is not SQL")
+	cx.assertErrorNil(mdb.storage().Ping(), "memory ping")
+	_, err = describeTable(mdb, "x", true)
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(501, code, "describeTable on memory")
+
+	dbDriver = "bogus"
+	_, err = initDB("test")
+	cx.assertTrue(err != nil, "bogus driver")
+}
+
+// ----- unit tests for sqlitePragmas()
+
+// inputs and outputs for one sqlitePragmas testcase.
+type sqlitePragmas_TC struct {
+	journalMode string
+	cacheSize string
+	xres string
+	xsucc bool
+}
+
+// table of sqlitePragmas testcases.
+var sqlitePragmas_Tab = []sqlitePragmas_TC {
+	{ "WAL", "",
+		"pragma busy_timeout = 5000;pragma journal_mode = WAL;pragma synchronous = NORMAL;pragma foreign_keys = true",
+		true },
+	{ "", "-4000",
+		"pragma busy_timeout = 5000;pragma synchronous = NORMAL;pragma foreign_keys = true;pragma cache_size = -4000",
+		true },
+	{ "WAL; drop table x", "", "", false },
+}
+
+// run one testcase for function sqlitePragmas.
+func sqlitePragmas_Checker(cx *testContext, tc *sqlitePragmas_TC) {
+	defer func(jm, cs string) {
+		sqliteJournalMode, sqliteCacheSize = jm, cs
+	}(sqliteJournalMode, sqliteCacheSize)
+	sqliteJournalMode = tc.journalMode
+	sqliteCacheSize = tc.cacheSize
+	res, err := sqlitePragmas()
+	if !cx.assertEqual(tc.xsucc, err == nil, "succ") || err != nil {
+		return
+	}
+	cx.assertEqual(tc.xres, strings.Join(res, ";"), "result")
+}
+
+// the sqlitePragmas test suite.  run all sqlitePragmas testcases.
+func Test_sqlitePragmas(t *testing.T) {
+	cx := newTestContext(t, "sqlitePragmas_Tab")
+	for _, tc := range sqlitePragmas_Tab {
+		sqlitePragmas_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// check that the configured pool limits and pragmas
+// are applied to the opened database.
+func Test_openSqliteDB_config(t *testing.T) {
+	cx := newTestContext(t)
+	defer func(n int) { dbMaxOpenConns = n }(dbMaxOpenConns)
+	dbMaxOpenConns = 3
+	f, _ := ioutil.TempFile("", "pragma-test-*.db")
+	_ = f.Close()
+	defer os.Remove(f.Name()) // nolint
+	defer os.Remove(f.Name() + "-wal") // nolint
+	defer os.Remove(f.Name() + "-shm") // nolint
+
+	odb, err := openSqliteDB(f.Name())
+	if !cx.assertErrorNil(err, "openSqliteDB") {
+		return
+	}
+	defer odb.handle.Close() // nolint
+	cx.assertEqual(3, odb.handle.Stats().MaxOpenConnections,
+		"max open conns")
+
+	// each connection in the pool has the pragmas, so two
+	// connections are held open at once.
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := odb.handle.Conn(ctx)
+		if !cx.assertErrorNil(err, "Conn") {
+			return
+		}
+		defer conn.Close() // nolint
+		for _, tc := range [][2]string{
+			{"journal_mode", "wal"},
+			{"synchronous", "1"},
+			{"busy_timeout", "5000"},
+			{"foreign_keys", "1"},
+		} {
+			var val string
+			err = conn.QueryRowContext(ctx, "pragma " + tc[0]).Scan(&val)
+			cx.assertErrorNil(err, tc[0])
+			cx.assertEqual(tc[1], val, fmt.Sprintf("%s on conn %d", tc[0], i))
+		}
+	}
+	cx.assertEqual(2, odb.handle.Stats().OpenConnections, "open conns")
+}
+
+func Test_openSqliteDB_badPragma(t *testing.T) {
+	cx := newTestContext(t)
+	defer func(s string) { sqliteSynchronous = s }(sqliteSynchronous)
+	sqliteSynchronous = "NORMAL; drop table x"
+	_, err := openSqliteDB(ut_DBNAME)
+	cx.assertTrue(err != nil, "bad pragma value")
+}
+
+// ----- unit tests for newRecordQuery()
+
+// inputs and outputs for one newRecordQuery testcase.
+type newRecordQuery_TC struct {
+	paramstr string
+	xids string
+	xallIds bool
+	xfields string
+	xallFields bool
+}
+
+// table of newRecordQuery testcases.
+var newRecordQuery_Tab = []newRecordQuery_TC {
+	{ "id=5&ids=1,2", "5", false, "", true },
+	{ "ids=1,2&fields=*", "1,2", false, "", true },
+	{ "ids=&fields=a,b", "", true, "a,b", false },
+}
+
+// run one testcase for function newRecordQuery.
+func newRecordQuery_Checker(cx *testContext, tc *newRecordQuery_TC) {
+	q := newRecordQuery(fakeParams(tc.paramstr))
+	ids := make([]string, len(q.ids))
+	for i, id := range q.ids {
+		ids[i] = idTypeToA(id)
+	}
+	cx.assertEqual(tc.xids, strings.Join(ids, ","), "ids")
+	cx.assertEqual(tc.xallIds, q.ids == nil, "all ids")
+	cx.assertEqual(tc.xfields, strings.Join(q.fields, ","), "fields")
+	cx.assertEqual(tc.xallFields, q.fields == nil, "all fields")
+	cx.assertEqual("id", q.idField, "idField")
+}
+
+// the newRecordQuery test suite.  run all newRecordQuery testcases.
+func Test_newRecordQuery(t *testing.T) {
+	cx := newTestContext(t, "newRecordQuery_Tab")
+	for _, tc := range newRecordQuery_Tab {
+		newRecordQuery_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
@@ -0,0 +1,528 @@
+package apidCRUD
+
+// this module implements the memory storage backend, which keeps its
+// tables in memory, and is meant for tests.  it follows the sqlite
+// backend closely enough that the APIs behave the same: values are
+// kept as strings, as in a column of text affinity; fields other than
+// the primary key may not be null; and errors carry the same statuses.
+// a transaction holds the database lock throughout, and is rolled back
+// by restoring a copy of the tables made when it began.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// memTable is one table of a memory database.
+type memTable struct {
+	name string
+	fields []FieldSchema
+	pk string	// the primary key field, or "" if there is none.
+	rows map[int64]map[string]interface{}	// by id; the pk isn't stored.
+	nextId int64
+}
+
+// memDB is a memory database.
+// its tables must be accessed with lock held.
+type memDB struct {
+	lock sync.Mutex
+	tables map[string]*memTable
+	names []string	// table names, in order of creation.
+}
+
+// memStorage is the storage backend for a memory database.
+type memStorage struct {
+	mem *memDB
+	ctx context.Context
+}
+
+// memRecords implements the record operations on a memory database,
+// whose lock is held by the caller.
+type memRecords struct {
+	mem *memDB
+}
+
+// openMemoryDB() returns a new, empty memory database.
+// the name is only logged; memory databases are not shared.
+func openMemoryDB(dbName string) (dbType, error) {
+	log.Infof("database %s is in memory", dbName)
+	mem := &memDB{tables: map[string]*memTable{}}
+	return dbType{store: memStorage{mem, nil}}, nil
+}
+
+// ----- methods of memStorage
+
+// withContext() returns a copy of the storage whose operations
+// run in the given context.
+func (s memStorage) withContext(ctx context.Context) storage {
+	return memStorage{s.mem, ctx}
+}
+
+// lock() locks the database, unless the storage's context has ended.
+// if it returns nil, the caller must unlock the database.
+func (s memStorage) lock() error {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	s.mem.lock.Lock()
+	return nil
+}
+
+// Ping() checks that the database can be reached, which it always can.
+func (s memStorage) Ping() error {
+	return nil
+}
+
+// ListTables() returns the names of the tables, in order of creation.
+func (s memStorage) ListTables() ([]string, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.ListTables()
+}
+
+// TableSchema() returns the schema of a table.
+func (s memStorage) TableSchema(tabName string) (TableSchema, error) {
+	if err := s.lock(); err != nil {
+		return TableSchema{}, err
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.TableSchema(tabName)
+}
+
+// CreateTable() creates a table with the given schema.
+func (s memStorage) CreateTable(tabName string, sch TableSchema) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.CreateTable(tabName, sch)
+}
+
+// DropTable() deletes a table.
+func (s memStorage) DropTable(tabName string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mem.lock.Unlock()
+	if s.mem.tables[tabName] == nil {
+		return noSuchTable(tabName)
+	}
+	delete(s.mem.tables, tabName)
+	for i, name := range s.mem.names {
+		if name == tabName {
+			s.mem.names = append(s.mem.names[:i], s.mem.names[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Insert() creates a record.
+func (s memStorage) Insert(tabName string, rec KVRecord) (idType, error) {
+	if err := s.lock(); err != nil {
+		return dbErrorRet(err)
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.Insert(tabName, rec)
+}
+
+// Select() returns the selected records.
+func (s memStorage) Select(q recordQuery) ([]*KVResponse, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.Select(q)
+}
+
+// Update() changes the selected records.
+func (s memStorage) Update(q recordQuery, rec KVRecord) (idType, error) {
+	if err := s.lock(); err != nil {
+		return dbErrorRet(err)
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.Update(q, rec)
+}
+
+// Delete() deletes the selected records.
+func (s memStorage) Delete(q recordQuery) (idType, error) {
+	if err := s.lock(); err != nil {
+		return dbErrorRet(err)
+	}
+	defer s.mem.lock.Unlock()
+	return memRecords{s.mem}.Delete(q)
+}
+
+// Transact() calls the given function with the database locked.
+// if the function fails, the tables are restored as they were.
+func (s memStorage) Transact(txFunc func(tx recordStore) error) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mem.lock.Unlock()
+	saved := s.mem.copyTables()
+	savedNames := append([]string{}, s.mem.names...)
+	err := txFunc(memRecords{s.mem})
+	if err != nil {
+		s.mem.tables = saved
+		s.mem.names = savedNames
+		noteRollback()
+	}
+	return err
+}
+
+// copyTables() returns a copy of the database's tables.
+func (m *memDB) copyTables() map[string]*memTable {
+	ret := make(map[string]*memTable, len(m.tables))
+	for name, tab := range m.tables {
+		cp := *tab
+		cp.rows = make(map[int64]map[string]interface{}, len(tab.rows))
+		for id, row := range tab.rows {
+			cprow := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				cprow[k] = v
+			}
+			cp.rows[id] = cprow
+		}
+		ret[name] = &cp
+	}
+	return ret
+}
+
+// ----- methods of memRecords
+
+// ListTables() returns the names of the tables, in order of creation.
+func (r memRecords) ListTables() ([]string, error) {
+	return append([]string{}, r.mem.names...), nil
+}
+
+// TableSchema() returns the schema of a table.
+func (r memRecords) TableSchema(tabName string) (TableSchema, error) {
+	tab, err := r.table(tabName)
+	if err != nil {
+		return TableSchema{}, err
+	}
+	return TableSchema{Fields: append([]FieldSchema{}, tab.fields...)}, nil
+}
+
+// CreateTable() creates a table with the given schema.
+func (r memRecords) CreateTable(tabName string, sch TableSchema) error {
+	tab := &memTable{
+		name: tabName,
+		fields: sch.Fields,
+		rows: map[int64]map[string]interface{}{},
+		nextId: 1,
+	}
+	if len(sch.Fields) == 0 {
+		return fmt.Errorf("table %s has no fields", tabName)
+	}
+	seen := map[string]bool{}
+	for _, field := range sch.Fields {
+		if seen[field.Name] {
+			return fmt.Errorf("duplicate column name: %s", field.Name)
+		}
+		seen[field.Name] = true
+		if listToMap(field.Properties)["is_primary_key"] == 0 {
+			continue
+		}
+		if tab.pk != "" {
+			return fmt.Errorf("table %s has more than one primary key",
+				tabName)
+		}
+		tab.pk = field.Name
+	}
+
+	if r.mem.tables[tabName] != nil {
+		return conflictError(fmt.Errorf("table %s already exists", tabName))
+	}
+	r.mem.tables[tabName] = tab
+	r.mem.names = append(r.mem.names, tabName)
+	return nil
+}
+
+// table() returns the named table.
+func (r memRecords) table(tabName string) (*memTable, error) {
+	tab := r.mem.tables[tabName]
+	if tab == nil {
+		return nil, noSuchTable(tabName)
+	}
+	return tab, nil
+}
+
+// Insert() creates a record.  the id is the given value of the primary
+// key field, if any; otherwise it is one more than the largest yet.
+func (r memRecords) Insert(tabName string, rec KVRecord) (idType, error) {
+	tab, err := r.table(tabName)
+	if err != nil {
+		return dbErrorRet(err)
+	}
+	row := map[string]interface{}{}
+	id := tab.nextId
+	for i, k := range rec.Keys {
+		if err = tab.checkField(k); err != nil {
+			return dbErrorRet(err)
+		}
+		if k != tab.pk {
+			row[k] = memValue(rec.Values[i])
+			continue
+		}
+		if id, err = tab.idValue(rec.Values[i]); err != nil {
+			return dbErrorRet(err)
+		}
+		if tab.rows[id] != nil {
+			return dbErrorRet(tab.uniqueError())
+		}
+	}
+	if err = tab.checkNotNull(row, true); err != nil {
+		return dbErrorRet(err)
+	}
+	tab.rows[id] = row
+	if id >= tab.nextId {
+		tab.nextId = id + 1
+	}
+	return idType(id), nil
+}
+
+// Select() returns the selected records, in order of id, which is
+// the primary key's value, or the rowid if there is none.
+func (r memRecords) Select(q recordQuery) ([]*KVResponse, error) {
+	tab, err := r.table(q.table)
+	if err != nil {
+		return nil, err
+	}
+	keys := q.fields
+	if keys == nil {
+		keys = tab.fieldNames()
+	}
+	checked := keys
+	if q.key() != "rowid" {
+		checked = append([]string{q.key()}, keys...)
+	}
+	for _, k := range checked {
+		if err = tab.checkField(k); err != nil {
+			return nil, err
+		}
+	}
+	ids, err := tab.selectIds(q)
+	if err != nil {
+		return nil, err
+	}
+	if q.offset >= len(ids) {
+		ids = nil
+	} else if q.offset > 0 {
+		ids = ids[q.offset:]
+	}
+	if q.limit > 0 && q.limit < len(ids) {
+		ids = ids[:q.limit]
+	}
+	if len(ids) > maxRecs { // safety check
+		ids = ids[:maxRecs]
+	}
+
+	ret := make([]*KVResponse, len(ids))
+	for i, id := range ids {
+		values := make([]interface{}, len(keys))
+		for j, k := range keys {
+			values[j] = tab.fieldValue(id, k)
+		}
+		ret[i] = &KVResponse{
+			Keys: keys,
+			Values: values,
+			Kind: "KVResponse",
+			Self: fmt.Sprintf("%s/%s", q.self, tab.fieldString(id, q.key())),
+		}
+	}
+	return ret, nil
+}
+
+// Update() changes the given fields of the selected records.
+func (r memRecords) Update(q recordQuery, rec KVRecord) (idType, error) {
+	tab, err := r.table(q.table)
+	if err != nil {
+		return dbErrorRet(err)
+	}
+	for _, k := range rec.Keys {
+		if err = tab.checkField(k); err != nil {
+			return dbErrorRet(err)
+		}
+	}
+	ids, err := tab.selectIds(q)
+	if err != nil {
+		return dbErrorRet(err)
+	}
+	// the pk, if changed, is the same for every record.
+	newId := int64(-1)
+	for i, k := range rec.Keys {
+		if k != tab.pk {
+			continue
+		}
+		if newId, err = tab.idValue(rec.Values[i]); err != nil {
+			return dbErrorRet(err)
+		}
+		if len(ids) > 1 || (len(ids) == 1 && ids[0] != newId &&
+				tab.rows[newId] != nil) {
+			return dbErrorRet(tab.uniqueError())
+		}
+	}
+
+	// check every change before making any, as sqlite would.
+	rows := make([]map[string]interface{}, len(ids))
+	for n, id := range ids {
+		row := map[string]interface{}{}
+		for k, v := range tab.rows[id] {
+			row[k] = v
+		}
+		for i, k := range rec.Keys {
+			if k != tab.pk {
+				row[k] = memValue(rec.Values[i])
+			}
+		}
+		if err = tab.checkNotNull(row, false); err != nil {
+			return dbErrorRet(err)
+		}
+		rows[n] = row
+	}
+	for n, id := range ids {
+		if newId >= 0 {
+			delete(tab.rows, id)
+			id = newId
+			if id >= tab.nextId {
+				tab.nextId = id + 1
+			}
+		}
+		tab.rows[id] = rows[n]
+	}
+	return idType(len(ids)), nil
+}
+
+// Delete() deletes the selected records.
+func (r memRecords) Delete(q recordQuery) (idType, error) {
+	tab, err := r.table(q.table)
+	if err != nil {
+		return dbErrorRet(err)
+	}
+	ids, err := tab.selectIds(q)
+	if err != nil {
+		return dbErrorRet(err)
+	}
+	for _, id := range ids {
+		delete(tab.rows, id)
+	}
+	return idType(len(ids)), nil
+}
+
+// ----- methods of memTable
+
+// fieldNames() returns the names of the table's fields, in order.
+func (tab *memTable) fieldNames() []string {
+	ret := make([]string, len(tab.fields))
+	for i, field := range tab.fields {
+		ret[i] = field.Name
+	}
+	return ret
+}
+
+// checkField() returns an error unless the table has the named field.
+func (tab *memTable) checkField(name string) error {
+	for _, field := range tab.fields {
+		if field.Name == name {
+			return nil
+		}
+	}
+	return validationError(fmt.Errorf("table %s has no column named %s",
+		tab.name, name))
+}
+
+// checkNotNull() returns an error if any field other than the
+// primary key is null in the given row.  on insert, a missing
+// field is null.
+func (tab *memTable) checkNotNull(row map[string]interface{},
+		insert bool) error {
+	for _, field := range tab.fields {
+		if field.Name == tab.pk {
+			continue
+		}
+		val, ok := row[field.Name]
+		if (ok || insert) && val == nil {
+			return validationError(fmt.Errorf(
+				"NOT NULL constraint failed: %s.%s",
+				tab.name, field.Name))
+		}
+	}
+	return nil
+}
+
+// uniqueError() returns the error for a duplicate primary key.
+func (tab *memTable) uniqueError() error {
+	return conflictError(fmt.Errorf("UNIQUE constraint failed: %s.%s",
+		tab.name, tab.pk))
+}
+
+// idValue() converts the given value of the primary key to an id.
+func (tab *memTable) idValue(val interface{}) (int64, error) {
+	id, err := strconv.ParseInt(patchValueString(val), 10, 64)
+	if err != nil || val == nil {
+		return 0, validationError(fmt.Errorf("datatype mismatch"))
+	}
+	return id, nil
+}
+
+// fieldString() returns the value of the named field of the given
+// record, in the string form that Select() returns.  the value of
+// the primary key, or of rowid, is the record's id.
+func (tab *memTable) fieldString(id int64, name string) string {
+	if name == tab.pk || name == "rowid" {
+		return strconv.FormatInt(id, 10)
+	}
+	s, _ := tab.rows[id][name].(string)
+	return s
+}
+
+// fieldValue() returns the value of the named field of the given
+// record, as Select() returns it: a string, or nil for null.
+func (tab *memTable) fieldValue(id int64, name string) interface{} {
+	if name != tab.pk && tab.rows[id][name] == nil {
+		return nil
+	}
+	return tab.fieldString(id, name)
+}
+
+// selectIds() returns the ids of the records selected by the query,
+// in order.
+func (tab *memTable) selectIds(q recordQuery) ([]int64, error) {
+	if q.ids != nil {
+		if err := tab.checkField(q.idField); err != nil {
+			return nil, err
+		}
+	}
+	want := map[string]bool{}
+	for _, id := range q.ids {
+		want[strconv.FormatInt(id, 10)] = true
+	}
+	ret := []int64{}
+	for id := range tab.rows {
+		if q.ids == nil || want[tab.fieldString(id, q.idField)] {
+			ret = append(ret, id)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret, nil
+}
+
+// memValue() returns the given value as it is kept in a memory table.
+func memValue(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	return patchValueString(val)
+}
+
+// noSuchTable() returns the error for a missing table.
+func noSuchTable(tabName string) error {
+	return notFoundError(fmt.Errorf("no such table: %s", tabName))
+}
@@ -0,0 +1,737 @@
+package apidCRUD
+
+// this module implements the sqlite storage backend.
+// it is where the SQL for the storage operations is written,
+// in terms of the SQL dialect of the database (see dialect.go).
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apid/apid-core"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ----- types used internally
+
+// type xResult represents the info of Result returned from sql.Exec().
+type xResult struct {
+	lastInsertId idType
+	rowsAffected idType
+}
+
+// type xCmd holds the arguments to SQL Exec()
+type xCmd struct {
+	cmd  string
+	args []interface{}
+}
+
+// sqlRunner is the subset of methods shared by *sql.DB and *sql.Tx,
+// so that the same query code can run inside or outside a transaction.
+type sqlRunner interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// sqliteStorage is the storage backend for a sqlite database.
+type sqliteStorage struct {
+	db dbType
+}
+
+// sqliteRecords implements the record operations on a sqlite
+// database or transaction.
+type sqliteRecords struct {
+	dbh sqlRunner
+	dialect sqlDialect
+}
+
+// openSqliteDB() opens the named sqlite database.
+// the database is pinged, so that a bad database name is
+// reported at startup rather than on the first request.
+// then the internal catalog is created or upgraded as needed,
+// and reconciled with the tables in the database.
+func openSqliteDB(dbName string) (dbType, error) {
+	ret, err := openSqliteHandle(dbName)
+	if err == nil {
+		err = migrateCatalog(ret)
+	}
+	if err != nil {
+		return ret, fmt.Errorf("database %s: %s", dbName, err)
+	}
+	startupReconcile(ret)
+	return ret, nil
+}
+
+// openSqliteHandle() opens the named sqlite database, with the
+// configured pragmas and connection pool, and pings it.
+// unlike openSqliteDB(), it leaves the catalog as it is.
+func openSqliteHandle(dbName string) (dbType, error) {
+	if _, err := sqlitePragmas(); err != nil {
+		return dbType{}, err
+	}
+	h, err := sql.Open(sqliteDriverName, dbName)
+	if err != nil {
+		return dbType{handle: h}, err
+	}
+	h.SetMaxOpenConns(dbMaxOpenConns)
+	h.SetMaxIdleConns(dbMaxIdleConns)
+	h.SetConnMaxLifetime(dbConnMaxLifetime)
+	return dbType{handle: h}, h.Ping()
+}
+
+// sqliteDriverName is the name under which the sqlite driver is
+// registered with setSqlitePragmas() as its connect hook (see init.go).
+const sqliteDriverName = "apidCRUD_sqlite3"
+
+// sqlitePragmaValue matches the pragma values that may be configured:
+// a name or a number.
+var sqlitePragmaValue = regexp.MustCompile(`^-?[A-Za-z0-9_]+$`)
+
+// sqlitePragmas() returns the statements that set the configured
+// pragmas.  busy_timeout is set first, so that changing the
+// journal mode waits for other connections.
+func sqlitePragmas() ([]string, error) {
+	pragmas := [][2]string{
+		{"busy_timeout",
+			strconv.FormatInt(int64(sqliteBusyTimeout/time.Millisecond), 10)},
+		{"journal_mode", sqliteJournalMode},
+		{"synchronous", sqliteSynchronous},
+		{"foreign_keys", strconv.FormatBool(sqliteForeignKeys)},
+		{"cache_size", sqliteCacheSize},
+	}
+	ret := []string{}
+	for _, p := range pragmas {
+		if p[1] == "" {
+			continue	// sqlite's default.
+		}
+		if !sqlitePragmaValue.MatchString(p[1]) {
+			return nil, fmt.Errorf("invalid value %q for pragma %s",
+				p[1], p[0])
+		}
+		ret = append(ret, fmt.Sprintf("pragma %s = %s", p[0], p[1]))
+	}
+	return ret, nil
+}
+
+// setSqlitePragmas() sets the configured pragmas on a new sqlite
+// connection, so that every connection in the pool has them.
+// it is the connect hook of the driver named sqliteDriverName.
+// a pragma that would write a database opened read-only, such as
+// journal_mode, is skipped; the database keeps its own setting.
+func setSqlitePragmas(conn *sqlite3.SQLiteConn) error {
+	stmts, err := sqlitePragmas()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		_, err = conn.Exec(stmt, nil)
+		if serr, ok := err.(sqlite3.Error); ok &&
+				serr.Code == sqlite3.ErrReadonly {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", stmt, err)
+		}
+	}
+	return nil
+}
+
+// ----- methods of sqliteStorage
+
+// withContext() returns a copy of the storage whose operations
+// run in the given context.
+func (s sqliteStorage) withContext(ctx context.Context) storage {
+	return sqliteStorage{s.db.withContext(ctx)}
+}
+
+// records() returns the record operations on the database itself.
+func (s sqliteStorage) records() sqliteRecords {
+	return sqliteRecords{s.db.runner(), s.db.dialect()}
+}
+
+// Ping() checks that the database can be reached.
+func (s sqliteStorage) Ping() error {
+	if s.db.handle == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return s.db.handle.PingContext(s.db.context())
+}
+
+// ListTables() returns the names of the tables in the table of tables.
+func (s sqliteStorage) ListTables() ([]string, error) {
+	return s.records().ListTables()
+}
+
+// TableSchema() returns the schema of a table from the table of tables.
+func (s sqliteStorage) TableSchema(tabName string) (TableSchema, error) {
+	return s.records().TableSchema(tabName)
+}
+
+// CreateTable() creates a table, and adds it to the table of tables,
+// in one transaction.
+func (s sqliteStorage) CreateTable(tabName string, sch TableSchema) error {
+	return s.Transact(func(tx recordStore) error {
+		return tx.CreateTable(tabName, sch)
+	})
+}
+
+// DropTable() deletes a table, and removes it from the table of tables.
+func (s sqliteStorage) DropTable(tabName string) error {
+	d := s.db.dialect()
+
+	// x1 deletes the actual table requested in the API.
+	x1 := newXCmd(fmt.Sprintf("DROP TABLE %s", d.quote(tabName)))
+
+	// x2 deletes the table's entry in our internal table of tables.
+	x2 := newXCmd(fmt.Sprintf("DELETE FROM %s WHERE %s = %s",
+		d.quote(tableOfTables), d.quote("name"), d.placeholder(1)),
+		tabName)
+	return execN(s.db, x1, x2)
+}
+
+// Insert() creates a record on the database.
+func (s sqliteStorage) Insert(tabName string, rec KVRecord) (idType, error) {
+	return s.records().Insert(tabName, rec)
+}
+
+// Select() returns the selected records from the database.
+func (s sqliteStorage) Select(q recordQuery) ([]*KVResponse, error) {
+	return s.records().Select(q)
+}
+
+// Update() changes the selected records on the database.
+func (s sqliteStorage) Update(q recordQuery, rec KVRecord) (idType, error) {
+	return s.records().Update(q, rec)
+}
+
+// Delete() deletes the selected records from the database.
+func (s sqliteStorage) Delete(q recordQuery) (idType, error) {
+	return s.records().Delete(q)
+}
+
+// Transact() calls the given function within a transaction.
+func (s sqliteStorage) Transact(txFunc func(tx recordStore) error) error {
+	return execTx(s.db, func(tx sqlRunner) error {
+		return txFunc(sqliteRecords{tx, s.db.dialect()})
+	})
+}
+
+// ----- methods of sqliteRecords
+
+// CreateTable() creates a table, and adds it to the table of tables.
+// the caller should run it within a transaction, so that the two
+// are done together.
+func (r sqliteRecords) CreateTable(tabName string, sch TableSchema) error {
+	jschema, _ := json.Marshal(sch) // schema as json
+
+	// x1 creates the actual table requested in the API.
+	x1 := newXCmd(mkCreateString(r.dialect, tabName, sch))
+
+	// x2 updates our internal table of tables.
+	x2 := newXCmd(mkInsertString(r.dialect, tableOfTables,
+		[]string{"name", "schema"}), tabName, jschema)
+	for _, xCmd := range []*xCmd{x1, x2} {
+		if _, err := r.dbh.Exec(xCmd.cmd, xCmd.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTables() returns the names of the tables in the table of tables.
+func (r sqliteRecords) ListTables() ([]string, error) {
+	// the tableOfTables table is our convention, not maintained by sqlite.
+	qstring, idlist := mkSelectString(r.dialect, recordQuery{
+		table: tableOfTables,
+		fields: []string{"name"},
+	})
+	result, err := runQueryOn(r.dbh, "", qstring, idlist)
+	if err != nil {
+		return nil, err
+	}
+	return convTableNames(result)
+}
+
+// TableSchema() returns the schema of a table from the table of tables.
+func (r sqliteRecords) TableSchema(tabName string) (TableSchema, error) {
+	var sch TableSchema
+	rows, err := r.dbh.Query(fmt.Sprintf("select schema from %s where name = %s",
+		r.dialect.quote(tableOfTables), r.dialect.placeholder(1)), tabName)
+	if err != nil {
+		return sch, err
+	}
+	defer rows.Close() // nolint
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return sch, err
+		}
+		return sch, noSuchTable(tabName)
+	}
+	var jschema string
+	if err = rows.Scan(&jschema); err != nil {
+		return sch, err
+	}
+	err = json.Unmarshal([]byte(jschema), &sch)
+	if err != nil {
+		return sch, fmt.Errorf("table %s: bad schema in %s: %s",
+			tabName, tableOfTables, err)
+	}
+	return sch, nil
+}
+
+// Insert() inserts a record whose data is specified by the
+// given keys and values.  it returns the id of the inserted record,
+// from the insert's result row if the dialect returns one.
+func (r sqliteRecords) Insert(tabName string, rec KVRecord) (idType, error) {
+	returning := r.dialect.returning("id")
+	qstring := mkInsertString(r.dialect, tabName, rec.Keys, returning)
+	if returning != "" {
+		return queryIdOn(r.dbh, qstring, rec.Values)
+	}
+	exres, err := runExecOn(r.dbh, qstring, rec.Values)
+	return exres.lastInsertId, err
+}
+
+// Select() does a select query for the selected records.
+func (r sqliteRecords) Select(q recordQuery) ([]*KVResponse, error) {
+	qstring, idlist := mkSelectString(r.dialect, q)
+	return runQueryOn(r.dbh, q.self, qstring, idlist)
+}
+
+// Update() updates certain fields of the selected records.
+// it returns the number of records changed.
+func (r sqliteRecords) Update(q recordQuery, rec KVRecord) (idType, error) {
+	qstring, idlist := mkUpdateString(r.dialect, q, rec.Keys)
+	values := append(append([]interface{}{}, rec.Values...), idlist...)
+	exres, err := runExecOn(r.dbh, qstring, values)
+	return exres.rowsAffected, err
+}
+
+// Delete() deletes the selected records.
+// it returns the number of records deleted.
+func (r sqliteRecords) Delete(q recordQuery) (idType, error) {
+	qstring, idlist := mkDeleteString(r.dialect, q)
+	exres, err := runExecOn(r.dbh, qstring, idlist)
+	return exres.rowsAffected, err
+}
+
+// ----- SQL support functions
+
+// mkSQLRow() returns a list of interface{} of the given length,
+// each element is actually a pointer to sql.RawBytes .
+// each starts out empty but not nil, so that after Scan(),
+// only a NULL value is nil.
+func mkSQLRow(N int) []interface{} {
+	ret := make([]interface{}, N)
+	for i := 0; i < N; i++ {
+		rb := sql.RawBytes{}
+		ret[i] = &rb
+	}
+	return ret
+}
+
+// queryErrorRet() passes thru the ret and err args,
+// while logging dmsg with the given logger.
+func queryErrorRet(lg apid.LogService,
+	ret []*KVResponse,
+	err error,
+	dmsg string) ([]*KVResponse, error) {
+	if dmsg != "" {
+		lg.Debugf("queryErrorRet [%s], %s", err, dmsg)
+	}
+	return ret, err
+}
+
+// runQuery() does a select query using the given query string.
+// the return value is a list of the retrieved records.
+func runQuery(db dbType,
+	self string,
+	qstring string,
+	ivals []interface{}) ([]*KVResponse, error) {
+	return runQueryOn(db.runner(), self, qstring, ivals)
+}
+
+// runQueryOn() is like runQuery(), but runs the query on the given
+// sqlRunner, which may be a transaction.
+func runQueryOn(dbh sqlRunner,
+	self string,
+	qstring string,
+	ivals []interface{}) ([]*KVResponse, error) {
+	lg := runnerLog(dbh)
+	lg.Debugf("query = %s", qstring)
+	lg.Debugf("ivals = %s", ivals)
+
+	ret := make([]*KVResponse, 0, 1)
+
+	rows, err := dbh.Query(qstring, ivals...)
+	if err != nil {
+		return queryErrorRet(lg, ret, err, "failure after Query")
+	}
+
+	// ensure rows gets closed at end
+	defer rows.Close() // nolint
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return queryErrorRet(lg, ret, err, "failure after Columns")
+	}
+	lg.Debugf("cols = %s", cols)
+
+	for rows.Next() {
+		rec, err := queryRow(self, rows, cols)
+		if err != nil {
+			return queryErrorRet(lg, ret, err, "failure after queryRow")
+		}
+		ret = append(ret, rec)
+		if len(ret) >= maxRecs { // safety check
+			break
+		}
+	}
+
+	return ret, rows.Err()
+}
+
+// queryRow() handles one iteration of runQuery's row loop.
+func queryRow(self string,
+	rows *sql.Rows,
+	cols []string) (*KVResponse, error) {
+
+	ret := &KVResponse{}
+	ret.Kind = "KVResponse"
+
+	vals := mkSQLRow(len(cols))
+	err := rows.Scan(vals...)
+	if err != nil {
+		return ret, err
+	}
+
+	err = convValues(vals)
+	if err != nil {
+		return ret, err
+	}
+
+	// note that the query string was modified to ensure
+	// that the id field would be the first column.
+	// the following fields are those from the request.
+
+	// get the record id for use in the self property.
+	id, ok := vals[0].(string)
+	if !ok {
+		return ret, fmt.Errorf("id type conversion error")
+	}
+	ret.Self = fmt.Sprintf("%s/%s", self, id)
+
+	ret.Keys = cols[1:]
+	ret.Values = vals[1:]
+	return ret, nil
+}
+
+// convValues() converts masked *sql.RawBytes to masked strings,
+// or to nil for NULL values.  the slice is changed in-place.
+func convValues(vals []interface{}) error {
+	N := len(vals)
+	for i := 0; i < N; i++ {
+		v := vals[i]
+		rbp, ok := v.(*sql.RawBytes)
+		if !ok {
+			return fmt.Errorf("SQL conversion error")
+		}
+		if *rbp == nil {
+			vals[i] = nil
+			continue
+		}
+		vals[i] = string(*rbp)
+	}
+	return nil
+}
+
+// convTableNames() converts the return format from runQuery()
+// into a simple list of names.
+func convTableNames(result []*KVResponse) ([]string, error) {
+	// convert from query format to simple list of names
+	ret := make([]string, len(result))
+	for i, row := range result {
+		str, ok := (*row).Values[0].(string)
+		if !ok {
+			return ret, fmt.Errorf("table name conversion error")
+		}
+		ret[i] = str
+	}
+	return ret, nil
+}
+
+// idTypesToInterface() convert a list of strings to
+// a list of database id's (of idType) disguised as interface{}.
+func idTypesToInterface(vals []string) []interface{} {
+	ret := make([]interface{}, len(vals))
+	for i, v := range vals {
+		ret[i] = interface{}(aToIdType(v))
+	}
+	return ret
+}
+
+// nstring() returns a string with n comma-separated copies of
+// the given string s.
+func nstring(s string, n int) string {
+	ret := make([]string, n)
+	for i := 0; i < n; i++ {
+		ret[i] = s
+	}
+	return strings.Join(ret, ",")
+}
+
+// getExecResult() constructs an xResult from the given
+// res argument, presumably obtained from calling sql.Exec.
+// the results are logged with the given logger.
+func getExecResult(lg apid.LogService, res sql.Result) xResult {
+	// fmt.Debugf("result=%s", res)
+	lastid, _ := res.LastInsertId()
+	lg.Debugf("lastid = %d", lastid)
+
+	nrecs, _ := res.RowsAffected()
+	lg.Debugf("rowsaffected = %d", nrecs)
+
+	return xResult{idType(lastid), idType(nrecs)}
+}
+
+// joinClauses() joins the nonempty clauses of a statement.
+func joinClauses(clauses ...string) string {
+	ret := make([]string, 0, len(clauses))
+	for _, c := range clauses {
+		if c != "" {
+			ret = append(ret, c)
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+// mkNameList() returns the comma-separated list of the given
+// names, quoted as identifiers.
+func mkNameList(d sqlDialect, names []string) string {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = d.quote(name)
+	}
+	return strings.Join(ret, ",")
+}
+
+// mkPlaceholders() returns the comma-separated list of the
+// placeholders for n arguments, the first being argument first.
+func mkPlaceholders(d sqlDialect, first int, n int) string {
+	ret := make([]string, n)
+	for i := 0; i < n; i++ {
+		ret[i] = d.placeholder(first + i)
+	}
+	return strings.Join(ret, ",")
+}
+
+// mkIdClause() returns the WHERE clause implied by the given query,
+// that can be plugged in to a query string (for use with Prepare),
+// and list of data items (for use with Exec).
+// first is the argument number of the first id.
+// if the query selects all records, the WHERE clause is empty.
+func mkIdClause(d sqlDialect, q recordQuery, first int) (string, []interface{}) { // nolint
+	idlist := make([]interface{}, len(q.ids))
+	for i, id := range q.ids {
+		idlist[i] = id
+	}
+	switch len(q.ids) {
+	case 0:
+		if q.ids != nil {
+			// nothing matches.
+			return "WHERE 1 = 0", idlist
+		}
+		// no ids implies everything matches.
+		// if this is bad, caller should check.
+		return "", idlist
+	case 1:
+		return fmt.Sprintf("WHERE %s = %s", // nolint
+			d.quote(q.idField), d.placeholder(first)), idlist
+	default:
+		placestr := mkPlaceholders(d, first, len(idlist))
+		return fmt.Sprintf("WHERE %s IN (%s)", // nolint
+			d.quote(q.idField), placestr), idlist
+	}
+}
+
+// mkSelectString() returns the selection query for the given query.
+// insert an extra key field (normally id) at the start of the list
+// of fields, to ensure that the key is one of the retrieved fields.
+// the records are ordered by key, so that limit and offset
+// page thru them consistently.
+func mkSelectString(d sqlDialect, q recordQuery) (string, []interface{}) {
+	idclause, idlist := mkIdClause(d, q, 1)
+
+	fields := "*"
+	if q.fields != nil {
+		fields = mkNameList(d, q.fields)
+	}
+	qstring := joinClauses(
+		fmt.Sprintf("SELECT %s,%s FROM %s", // nolint
+			d.quote(q.key()), fields, d.quote(q.table)),
+		idclause,
+		fmt.Sprintf("ORDER BY %s", d.quote(q.key())),
+		d.limitClause(q.limit, q.offset))
+
+	return qstring, idlist
+}
+
+// mkInsertString() returns the statement inserting a record with
+// the given keys into the named table.  any clauses given, such as
+// an upsert or returning clause, are added at the end.
+func mkInsertString(d sqlDialect,
+	tabName string,
+	keys []string,
+	clauses ...string) string {
+	return joinClauses(append([]string{
+		fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", // nolint
+			d.quote(tabName),
+			mkNameList(d, keys),
+			mkPlaceholders(d, 1, len(keys)))},
+		clauses...)...)
+}
+
+// mkUpdateString() returns the statement setting the given keys
+// of the records selected by the query, and the list of ids,
+// whose arguments follow those of the keys.
+func mkUpdateString(d sqlDialect,
+	q recordQuery,
+	keys []string) (string, []interface{}) {
+	sets := make([]string, len(keys))
+	for i, k := range keys {
+		sets[i] = fmt.Sprintf("%s = %s", d.quote(k), d.placeholder(i+1))
+	}
+	idclause, idlist := mkIdClause(d, q, len(keys)+1)
+	qstring := joinClauses(
+		fmt.Sprintf("UPDATE %s SET %s", // nolint
+			d.quote(q.table), strings.Join(sets, ", ")),
+		idclause)
+	return qstring, idlist
+}
+
+// mkDeleteString() returns the statement deleting the records
+// selected by the query, and the list of ids.
+func mkDeleteString(d sqlDialect, q recordQuery) (string, []interface{}) {
+	idclause, idlist := mkIdClause(d, q, 1)
+	qstring := joinClauses(
+		fmt.Sprintf("DELETE FROM %s", d.quote(q.table)), // nolint
+		idclause)
+	return qstring, idlist
+}
+
+// mkCreateString() returns the statement creating the named table
+// with the given schema.
+func mkCreateString(d sqlDialect, tabName string, sch TableSchema) string {
+	return fmt.Sprintf("CREATE TABLE %s (%s)",
+		d.quote(tabName), mkSchemaClause(d, sch))
+}
+
+// mkSchemaClause() constructs the SQL schema string
+// for the given list of fields.
+func mkSchemaClause(d sqlDialect, sch TableSchema) string {
+	var guts bytes.Buffer
+	sep := ""
+	for _, field := range sch.Fields {
+		guts.WriteString(sep)
+		guts.WriteString(d.quote(field.Name))
+		guts.WriteString(" ")
+		// more properties should be added
+		guts.WriteString(d.columnType(field))
+		sep = ", "
+	}
+	return guts.String()
+}
+
+// runExec() is common code for database APIs that do
+// Exec followed by getting the exec results.
+func runExec(db dbType,
+	query string,
+	values []interface{}) (xResult, error) {
+	return runExecOn(db.runner(), query, values)
+}
+
+// runExecOn() is like runExec(), but runs on the given sqlRunner.
+func runExecOn(dbh sqlRunner,
+	query string,
+	values []interface{}) (xResult, error) {
+	lg := runnerLog(dbh)
+	lg.Debugf("query = %s", query)
+	// the statement is prepared implicitly, so that the exec
+	// runs in the sqlRunner's context.
+	result, err := dbh.Exec(query, values...)
+	if err != nil {
+		return xResult{}, err
+	}
+	return getExecResult(lg, result), nil
+}
+
+// queryIdOn() runs the given insert statement, which returns the
+// id of the inserted record as its result row, on the given sqlRunner.
+func queryIdOn(dbh sqlRunner,
+	query string,
+	values []interface{}) (idType, error) {
+	lg := runnerLog(dbh)
+	lg.Debugf("query = %s", query)
+	rows, err := dbh.Query(query, values...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close() // nolint
+
+	var id idType
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = fmt.Errorf("no id returned by insert")
+		}
+		return 0, err
+	}
+	if err = rows.Scan(&id); err != nil {
+		return 0, err
+	}
+	lg.Debugf("lastid = %d", id)
+	return id, rows.Close()
+}
+
+// newXCmd() constructs an xCmd object from the given string and arguments.
+func newXCmd(cmd string, args ...interface{}) *xCmd {
+	return &xCmd{cmd, args}
+}
+
+// execN() runs multiple execs as a transaction.
+func execN(db dbType, cmdList ...*xCmd) error {
+	return execTx(db, func(tx sqlRunner) error {
+		for i, xCmd := range cmdList {
+			db.log().Debugf("cmd%d = %s", i, xCmd)
+			_, err := tx.Exec(xCmd.cmd, xCmd.args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// execTx() calls the given function within a transaction.
+// the transaction is committed if the function returns nil,
+// otherwise it is rolled back and the function's error is returned.
+func execTx(db dbType, txFunc func(tx sqlRunner) error) error {
+	tx, err := db.handle.BeginTx(db.context(), nil)
+	if err != nil {
+		return err
+	}
+	err = txFunc(ctxRunner{db.context(), tx})
+	if err != nil {
+		_ = tx.Rollback()
+		noteRollback()
+		return err
+	}
+	return tx.Commit()
+}
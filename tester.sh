@@ -133,6 +133,67 @@ uri2=$(get_rec_uri 6)
 [[ "$uri1" != "$uri2" ]]
 AssertOK "update did not change uri = $uri1"
 
+TestHeader "creating 2 records in one batch (batchtest.sh)"
+nc=$(Logrun "$TESTS_DIR/batchtest.sh" batch | grep -c "")
+[[ "$nc" == 2 ]]
+AssertOK "batchtest.sh expected 2, got $nc"
+
+TestHeader "checking readiness (readytest.sh)"
+out=$(Logrun "$TESTS_DIR/readytest.sh")
+[[ "$out" == ready ]]
+AssertOK "readiness expected ready, got $out"
+
+TestHeader "reading metrics (metrics.sh)"
+out=$(Logrun "$TESTS_DIR/metrics.sh")
+xstat=$?
+[[ $xstat == 0 && "$out" == *apidcrud_requests_total* ]]
+AssertOK "metrics"
+
+TestHeader "importing a table created outside the API (reconcile.sh)"
+sqlite3 "$DBFILE" "create table outside (id integer primary key, name text);"
+out=$(Logrun "$TESTS_DIR/reconcile.sh")
+[[ "$out" == outside ]]
+AssertOK "reconcile expected outside, got $out"
+
+TestHeader "checking the catalog is reconciled (reconcile.sh -n)"
+out=$(Logrun "$TESTS_DIR/reconcile.sh" -n)
+[[ "$out" == "" ]]
+AssertOK "reconcile expected nothing, got $out"
+Logrun "$TESTS_DIR/deltabtest.sh" outside > /dev/null
+
+TestHeader "creating a table in a named database (dbtabtest.sh)"
+out=$(Logrun "$TESTS_DIR/dbtabtest.sh" scratch inscratch)
+[[ "$out" == inscratch ]]
+AssertOK "dbtabtest.sh expected inscratch, got $out"
+
+TestHeader "checking the default database is unchanged (tabtest.sh)"
+out=$(list_tables | grep -c '^inscratch$')
+[[ "$out" == 0 ]]
+AssertOK "inscratch found in the default database"
+
+TestHeader "taking a snapshot of the default database (backup.sh)"
+snap=$(Logrun "$TESTS_DIR/backup.sh" _default)
+[[ "$snap" == _default-*.db ]]
+AssertOK "backup.sh expected a snapshot name, got $snap"
+
+TestHeader "restoring the snapshot (backup.sh)"
+out=$(Logrun "$TESTS_DIR/backup.sh" _default "$snap")
+[[ "$out" == "$snap" ]]
+AssertOK "backup.sh expected $snap, got $out"
+out=$(list_tables | grep -c '^users$')
+[[ "$out" == 1 ]]
+AssertOK "users not found after restore"
+
+TestHeader "dumping the default database (dumptest.sh)"
+out=$(Logrun "$TESTS_DIR/dumptest.sh" _default | grep -c '^users$')
+[[ "$out" == 1 ]]
+AssertOK "users not found in dump"
+
+TestHeader "loading a dump into a named database (dumptest.sh -l)"
+out=$(Logrun "$TESTS_DIR/dumptest.sh" -l scratch loaded)
+[[ "$out" == 1 ]]
+AssertOK "dumptest.sh -l expected 1, got $out"
+
 TestHeader "try writing a small file and reading it back (rwftest.sh)"
 "$TESTS_DIR/rwftest.sh" cmd/apidCRUD/main.go > /dev/null 2>&1
 AssertOK file comparison
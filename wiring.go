@@ -7,12 +7,18 @@ package apidCRUD
 // function deals with a single verb on a given path).
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"net/http"
 	"encoding/json"
 	"io"
+	"mime"
 	"sort"
+	"strconv"
+	"time"
+
+	"github.com/apid/apid-core"
 )
 
 // apiHandlerRet is the return type from an apiHandler function.
@@ -22,10 +28,13 @@ type apiHandlerRet struct {
 }
 
 // apiHandlerArg is the type of the parameter to an apiHandler function.
+// header holds response headers set by the handler.
 type apiHandlerArg struct {
 	req *http.Request
 	pathParams map[string]string
 	err error
+	header http.Header
+	w http.ResponseWriter	// nil when a handler is called directly.
 }
 
 // apiHandler is the type an API handler function.
@@ -38,41 +47,102 @@ type verbMap struct {
 }
 
 // type apiDesc describes the wiring for one API.
+// middleware, if any, applies to this API only,
+// inside of the wiring's global middleware.
 type apiDesc struct {
 	path string
 	verb string
 	handler apiHandler
+	middleware []apiMiddleware
 }
 
 // type apiWiring is the state needed to dispatch an incoming API call.
+// pathsMap is keyed by path pattern; routes holds the same patterns,
+// compiled and ordered for matching request paths.
+// middleware is applied to every API added to the wiring.
 type apiWiring struct {
 	pathsMap map[string]verbMap
+	routes []*route
+	middleware []apiMiddleware
 }
 
 // newApiWiring returns an API configuration, after adding the APIs
 // from the given table.  basePath is prefixed to the paths
-// specified in the table items.
-func newApiWiring(basePath string, tab []apiDesc) (*apiWiring) {  // nolint
+// specified in the table items.  the given middleware, if any,
+// wraps every handler, outermost first.
+func newApiWiring(basePath string,
+		tab []apiDesc,
+		mws ...apiMiddleware) (*apiWiring) {  // nolint
 	pm := make(map[string]verbMap)
-	apiws := &apiWiring{pm}
+	apiws := &apiWiring{pm, []*route{}, mws}
 	for _, b := range(tab) {
-		apiws.AddApi(basePath + b.path, b.verb, b.handler)
+		apiws.AddApi(basePath + b.path, b.verb, b.handler,
+			b.middleware...)
 	}
 	return apiws
 }
 
 // AddApi() configures the wiring for one path and verb to their handler.
+// the path may contain parameter segments of the form {name}.
+// the handler is wrapped in the wiring's global middleware,
+// then in the given per-API middleware.
 func (apiws *apiWiring) AddApi(path string,
 		verb string,
-		handler apiHandler) { // nolint
+		handler apiHandler,
+		mws ...apiMiddleware) { // nolint
+	all := append(append([]apiMiddleware{}, apiws.middleware...), mws...)
+	handler = chainMiddleware(handler, all...)
 	vmap, ok := apiws.pathsMap[path]
 	if !ok {
 		vmap = verbMap{path: path, methods: map[string]apiHandler{}}
 		apiws.pathsMap[path] = vmap
+		apiws.routes = append(apiws.routes,
+			&route{parsePattern(path), vmap})
+		sortRoutes(apiws.routes)
 	}
 	vmap.methods[verb] = handler
 }
 
+// Match() finds the verbMap whose path pattern matches the given
+// request path, and returns it with the values of the path parameters.
+// literal segments take precedence over parameter segments,
+// and a trailing slash is ignored.
+func (apiws *apiWiring) Match(path string) (verbMap, map[string]string, bool) {
+	parts := splitPath(path)
+	for _, rt := range apiws.routes {
+		params, ok := matchRoute(rt, parts)
+		if ok {
+			return rt.vmap, params, true
+		}
+	}
+	return verbMap{}, nil, false
+}
+
+// ServeHTTP() makes apiWiring an http.Handler, so that the APIs
+// can be mounted on any net/http mux.  the request is routed
+// by its URL path, then handled by pathDispatch().
+// the request is given a request id, and is logged in the access log
+// and counted in the metrics.
+func (apiws *apiWiring) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	r = withRequestId(r)
+	w.Header().Set(requestIdHeader, requestId(r.Context()))
+	aw := &accessWriter{w, http.StatusOK, 0}
+
+	vmap, params, ok := apiws.Match(r.URL.Path)
+	if ok {
+		pathDispatch(vmap, aw, mkApiHandlerArg(r, params))
+	} else {
+		_ = r.Body.Close()
+		writeErrorResponse(aw, notFoundError(
+			fmt.Errorf("no API for path %s", r.URL.Path)))
+	}
+	duration := time.Since(start)
+	logAccess(r, params["table_name"], aw, duration)
+	metrics.observe(vmap.path, params["db_name"], params["table_name"],
+		r.Method, aw.code, duration, aw.rows)
+}
+
 // GetMaps returns the configured path-to-verbMap mapping,
 // for possible range iteration.
 func (apiws *apiWiring) GetMaps() map[string]verbMap {
@@ -84,52 +154,143 @@ func (apiws *apiWiring) GetMaps() map[string]verbMap {
 func callApiMethod(vmap verbMap, verb string, harg *apiHandlerArg) apiHandlerRet {
 	verbFunc, ok := vmap.methods[verb]
 	if !ok {
-		return apiHandlerRet{http.StatusMethodNotAllowed,
-			fmt.Errorf(`No handler for %s on %s`, verb, vmap.path)}
+		return errorRet(http.StatusMethodNotAllowed,
+			fmt.Errorf(`No handler for %s on %s`, verb, vmap.path), "")
 	}
 
 	return verbFunc(harg)
 }
 
 // allowedMethods() returns a sorted list of the names of the
-// methods allowed by a verbMap.
+// methods allowed by a verbMap.  besides the wired verbs,
+// OPTIONS is always allowed, and HEAD is allowed wherever GET is.
 func allowedMethods(vmap verbMap) []string {
-	ret := make([]string, len(vmap.methods))
-	i := 0
+	verbs := map[string]bool{http.MethodOptions: true}
 	for verb := range vmap.methods {
-		ret[i] = verb
-		i++
+		verbs[verb] = true
+	}
+	if verbs[http.MethodGet] {
+		verbs[http.MethodHead] = true
+	}
+	ret := make([]string, 0, len(verbs))
+	for verb := range verbs {
+		ret = append(ret, verb)
 	}
 	sort.Strings(ret)
 	return ret
 }
 
+// acceptedTypes maps a verb to the media types accepted
+// in request bodies for that verb.
+var acceptedTypes = map[string][]string{
+	http.MethodPost: {"application/json"},
+	http.MethodPatch: {"application/json", mergePatchType, jsonPatchType},
+}
+
+// acceptHeaders maps a verb to the response header that advertises
+// the media types accepted for that verb.
+var acceptHeaders = map[string]string{
+	http.MethodPost: "Accept-Post",
+	http.MethodPatch: "Accept-Patch",
+}
+
+// writeOptions() answers an OPTIONS request from the given verbMap,
+// listing the allowed methods and the accepted media types.
+func writeOptions(w http.ResponseWriter, vmap verbMap) {
+	hdr := w.Header()
+	hdr.Set("Allow", strings.Join(allowedMethods(vmap), ","))
+	for verb, name := range acceptHeaders {
+		if _, ok := vmap.methods[verb]; ok {
+			hdr.Set(name, strings.Join(acceptedTypes[verb], ","))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dispatchVerb() returns the verb whose handler serves the given
+// request method on vmap.  HEAD is served by the GET handler,
+// unless a HEAD handler was wired explicitly.
+func dispatchVerb(vmap verbMap, method string) string {
+	if method != http.MethodHead {
+		return method
+	}
+	if _, ok := vmap.methods[method]; ok {
+		return method
+	}
+	return http.MethodGet
+}
+
 // pathDispatch() is the general handler for all our APIs.
 // it is called indirectly thru a closure function that
 // supplies the vmap argument.
+// a panic anywhere in the call is recovered and reported
+// as a 500 ErrorResponse.
+// CORS preflight requests are answered here, without calling a handler.
 func pathDispatch(vmap verbMap, w http.ResponseWriter, harg *apiHandlerArg) {
-	log.Debugf("in pathDispatch: method=%s path=%s",
-		harg.req.Method, harg.req.URL.Path)
 	defer func() {
 		_ = harg.bodyClose()
 	}()
+	defer func() {
+		if r := recover(); r != nil {
+			writeErrorResponse(w, recoverPanic(harg.log(), r))
+		}
+	}()
+
+	if applyCors(w, harg.req, vmap) {
+		return
+	}
 
-	res := callApiMethod(vmap, harg.req.Method, harg)
+	method := harg.req.Method
+	if _, ok := vmap.methods[method]; !ok && method == http.MethodOptions {
+		writeOptions(w, vmap)
+		return
+	}
+
+	harg.w = w
+	res := callApiMethod(vmap, dispatchVerb(vmap, method), harg)
 	if res.code == http.StatusMethodNotAllowed {
-		w.Header().Set("Allowed",
+		w.Header().Set("Allow",
 			strings.Join(allowedMethods(vmap), ","))
 	}
 
+	if aw, ok := w.(*accessWriter); ok {
+		aw.rows = resultRows(res.data)
+	}
+	if _, ok := res.data.(streamedBody); ok {
+		return	// the handler has written the response.
+	}
+	if erec, ok := res.data.(ErrorResponse); ok {
+		erec.RequestId = requestId(harg.req.Context())
+		res.data = erec
+	}
 	rawdata, err := convData(res.data)
 	if err != nil {
 		writeErrorResponse(w, err)
 		return
 	}
 
+	hdr := w.Header()
+	for name, vals := range harg.header {
+		hdr[name] = vals
+	}
+	if res.code == http.StatusNotModified {
+		w.WriteHeader(res.code)
+		return
+	}
+	if hdr.Get("Content-Type") == "" {
+		hdr.Set("Content-Type", responseContentType(res.data))
+	}
+	rawdata = compressResponse(hdr, harg.req, res.code, rawdata)
+
+	if method == http.MethodHead {
+		// same headers as GET, but no body.
+		w.Header().Set("Content-Length", strconv.Itoa(len(rawdata)))
+		w.WriteHeader(res.code)
+		return
+	}
+
 	w.WriteHeader(res.code)
 	w.Write(rawdata)	// nolint
-
-	log.Debugf("in pathDispatch: code=%d", res.code)
 }
 
 // convData() converts the interface{} data part returned by
@@ -148,15 +309,28 @@ func convData(data interface{}) ([]byte, error) {
 
 // writeErrorResponse() writes to the ResponseWriter,
 // the given error's message, and logs it.
+// the request id, if any, is taken from the response headers.
 func writeErrorResponse(w http.ResponseWriter, err error) {
-	code := http.StatusInternalServerError
+	code, errCode := classifyError(http.StatusInternalServerError, err)
 	msg := err.Error()
-	data, _ := convData(ErrorResponse{code,msg,"ErrorResponse"})
+	reqId := w.Header().Get(requestIdHeader)
+	data, _ := convData(ErrorResponse{Code: code,
+		ErrorCode: errCode,
+		Message: msg,
+		Kind: "ErrorResponse",
+		Fields: errorFields(err),
+		CorrelationId: errorCorrelation(err),
+		RequestId: reqId})
 
+        w.Header().Set("Content-Type", jsonType)
         w.WriteHeader(code)
         _, _ = w.Write(data)
 
-        log.Errorf("error handling API request: %s", msg)
+        lg := log
+        if reqId != "" {
+                lg = log.WithField("request_id", reqId)
+        }
+        lg.Errorf("error handling API request: %s", msg)
 }
 
 // ----- methods for apiHandlerArg
@@ -168,6 +342,137 @@ func (harg *apiHandlerArg) formValue(name string) string {
 	return harg.req.FormValue(name)
 }
 
+// contentType() returns the media type of the request body,
+// without any parameters.  the empty string means none was given.
+func (harg *apiHandlerArg) contentType() string {
+	ctype := harg.req.Header.Get("Content-Type")
+	if ctype == "" {
+		return ""
+	}
+	mtype, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return ""
+	}
+	return mtype
+}
+
+// decodeBody() decodes the json request body into v.
+// the body may be at most maxBodySize bytes, and must hold exactly
+// one json value.  unless strictJSON is turned off, object fields
+// that don't match a field of v are an error.
+func (harg *apiHandlerArg) decodeBody(v interface{}) error {
+	lr := &io.LimitedReader{R: harg.getBody(), N: int64(maxBodySize) + 1}
+	dec := json.NewDecoder(lr)
+	if strictJSON {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if lr.N <= 0 {
+		return tooLargeError(fmt.Errorf(
+			"request body exceeds %d bytes", maxBodySize))
+	}
+	if err != nil {
+		return err
+	}
+	var extra json.RawMessage
+	err = dec.Decode(&extra)
+	if lr.N <= 0 {
+		return tooLargeError(fmt.Errorf(
+			"request body exceeds %d bytes", maxBodySize))
+	}
+	if err != io.EOF {
+		return fmt.Errorf("request body must hold a single json value")
+	}
+	return nil
+}
+
+// streamedBody is the data of an apiHandlerRet whose body
+// the handler has already written, with stream().
+type streamedBody struct{}
+
+// stream() writes the response body as write() produces it, rather
+// than returning it as data, so that a large body is never held in
+// memory.  the headers are harg.header and the given content type;
+// the body is not compressed.  the headers are written with the first
+// byte of the body, so an error before that is returned as usual.
+// after it, the error can only be logged, and the body is cut short.
+// when the handler was called directly, without a ResponseWriter,
+// the body is returned as data.
+func (harg *apiHandlerArg) stream(code int, contentType string,
+		write func(w io.Writer) error) apiHandlerRet {
+	harg.header.Set("Content-Type", contentType)
+	if harg.w == nil {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			harg.header.Del("Content-Type")
+			return errorRet(badStat, err, "in stream")
+		}
+		return apiHandlerRet{code, buf.Bytes()}
+	}
+	sw := &streamWriter{harg: harg, code: code}
+	if harg.req.Method == http.MethodHead {
+		sw.start()
+		return apiHandlerRet{code, streamedBody{}}
+	}
+	err := write(sw)
+	if err != nil && !sw.started {
+		harg.header.Del("Content-Type")
+		return errorRet(badStat, err, "in stream")
+	}
+	if err != nil {
+		harg.log().Errorf("response body cut short: %s", err)
+	}
+	sw.start()
+	return apiHandlerRet{code, streamedBody{}}
+}
+
+// streamWriter is the io.Writer of a body written by stream().
+// it writes the response headers before the first byte of the body.
+type streamWriter struct {
+	harg *apiHandlerArg
+	code int
+	started bool
+}
+
+// start() writes the response headers, if they are not written yet.
+func (sw *streamWriter) start() {
+	if sw.started {
+		return
+	}
+	sw.started = true
+	hdr := sw.harg.w.Header()
+	for name, vals := range sw.harg.header {
+		hdr[name] = vals
+	}
+	sw.harg.w.WriteHeader(sw.code)
+}
+
+// Write() writes p to the response body.
+// writing nothing does not write the headers.
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	sw.start()
+	return sw.harg.w.Write(p)
+}
+
+// log() returns the logger for the request.
+// its lines carry the request id.
+func (harg *apiHandlerArg) log() apid.LogService {
+	return ctxLog(harg.req.Context())
+}
+
+// db() returns the database handle wrapper for the request,
+// which is the default database unless the request was bound
+// to a named one (see dbMiddleware()).
+// statements run thru it are abandoned when the request's context
+// is canceled or times out.
+func (harg *apiHandlerArg) db() dbType {
+	ctx := harg.req.Context()
+	return ctxDb(ctx).withContext(ctx)
+}
+
 // getBody() is an accessor for http.Request.Body .
 func (harg *apiHandlerArg) getBody() io.ReadCloser {
 	return harg.req.Body
@@ -183,5 +488,5 @@ func (harg *apiHandlerArg) bodyClose() error {
 func mkApiHandlerArg(req *http.Request,
 		pathParams map[string]string) *apiHandlerArg {
 	err := req.ParseForm()
-	return &apiHandlerArg{req, pathParams, err}
+	return &apiHandlerArg{req, pathParams, err, http.Header{}, nil}
 }
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"fmt"
 	"encoding/json"
+	"io"
 )
 
 const (
@@ -45,15 +46,15 @@ func badHandler(harg *apiHandlerArg) apiHandlerRet {
 
 var fakeApiTable = []apiDesc {	// nolint
 	// /abc supports GET and POST
-	{ "/abc", http.MethodGet, abcGetHandler },
-	{ "/abc", http.MethodPost, abcPostHandler },
+	{ "/abc", http.MethodGet, abcGetHandler, nil },
+	{ "/abc", http.MethodPost, abcPostHandler, nil },
 
 	// /xyz supports PUT and DELETE
-	{ "/xyz", http.MethodPut, xyzPutHandler },
-	{ "/xyz", http.MethodDelete, badHandler },
+	{ "/xyz", http.MethodPut, xyzPutHandler, nil },
+	{ "/xyz", http.MethodDelete, badHandler, nil },
 
 	// /pqr supports only PATCH
-	{ "/pqr", http.MethodPatch, pqrPatchHandler },
+	{ "/pqr", http.MethodPatch, pqrPatchHandler, nil },
 }
 
 // countPaths returns the number of unique paths in the given tab.
@@ -156,9 +157,10 @@ type convData_TC struct {
 	xsucc bool
 }
 
-var erdata = ErrorResponse{567, "junk", "ErrorResponse"}
+var erdata = ErrorResponse{Code: 567, ErrorCode: "internal",
+	Message: "junk", Kind: "ErrorResponse"}
 
-var erjson = `{"code":567,"message":"junk","kind":"ErrorResponse"}`
+var erjson = `{"code":567,"errorCode":"internal","message":"junk","kind":"ErrorResponse"}`
 
 var badconv = func() { }	// cause convData to choke.
 
@@ -234,9 +236,9 @@ type allowedMethods_TC struct {
 
 // table of allowedMethods testcases.
 var allowedMethods_Tab = []allowedMethods_TC {
-	{ "/abc", "GET,POST" },
-	{ "/xyz", "DELETE,PUT" },
-	{ "/pqr", "PATCH" },
+	{ "/abc", "GET,HEAD,OPTIONS,POST" },
+	{ "/xyz", "DELETE,OPTIONS,PUT" },
+	{ "/pqr", "OPTIONS,PATCH" },
 }
 
 // run one testcase for function allowedMethods.
@@ -255,3 +257,319 @@ func Test_allowedMethods(t *testing.T) {
 		cx.bump()	// increment testno.
 	}
 }
+
+// ----- unit tests for Match() and ServeHTTP().
+
+// a dummy handler, returns the path params it was given.
+func paramsGetHandler(harg *apiHandlerArg) apiHandlerRet {
+	return apiHandlerRet{http.StatusOK, harg.pathParams}
+}
+
+// a table with both literal and parameter segments.
+var routedApiTable = []apiDesc {	// nolint
+	{ "/db/_table/{table_name}", http.MethodGet, paramsGetHandler, nil },
+	{ "/db/_table/{table_name}/{id}", http.MethodGet, paramsGetHandler, nil },
+	{ "/db/_table/_schema/{id}", http.MethodGet, abcGetHandler, nil },
+	{ "/db/_schema/{table_name}", http.MethodGet, xyzPutHandler, nil },
+}
+
+// inputs and outputs for one Match testcase.
+type Match_TC struct {
+	path string
+	xpath string
+	xparams map[string]string
+	xsucc bool
+}
+
+// table of Match testcases.
+var Match_Tab = []Match_TC {
+	{ "/db/_table/foo", "/db/_table/{table_name}",
+		map[string]string{"table_name": "foo"}, true },
+	{ "/db/_table/foo/", "/db/_table/{table_name}",
+		map[string]string{"table_name": "foo"}, true },
+	{ "/db/_table/foo/3", "/db/_table/{table_name}/{id}",
+		map[string]string{"table_name": "foo", "id": "3"}, true },
+	{ "/db/_table/_schema/3", "/db/_table/_schema/{id}",
+		map[string]string{"id": "3"}, true },
+	{ "/db/_schema/bar", "/db/_schema/{table_name}",
+		map[string]string{"table_name": "bar"}, true },
+	{ "/db/_table//3", "", nil, false },
+	{ "/db/_table", "", nil, false },
+	{ "/db/_table/foo/3/4", "", nil, false },
+	{ "/xyz", "", nil, false },
+}
+
+// run one testcase for function Match.
+func Match_Checker(cx *testContext, ws *apiWiring, tc *Match_TC) {
+	vmap, params, ok := ws.Match(tc.path)
+	if !cx.assertEqual(tc.xsucc, ok, "match") || !ok {
+		return
+	}
+	cx.assertEqual(tc.xpath, vmap.path, "matched path")
+	cx.assertEqualObj(tc.xparams, params, "path params")
+}
+
+// the Match test suite.  run all Match testcases.
+func Test_Match(t *testing.T) {
+	cx := newTestContext(t, "Match_Tab")
+	ws := newApiWiring("", routedApiTable)
+	for _, tc := range Match_Tab {
+		Match_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// overlappingApiTable has routes that can match the same path,
+// listed so that the less specific one would be tried first.
+var overlappingApiTable = []apiDesc {	// nolint
+	{ "/x/{p}/c", http.MethodGet, paramsGetHandler, nil },
+	{ "/y", http.MethodGet, abcGetHandler, nil },
+	{ "/x/b/{q}", http.MethodGet, paramsGetHandler, nil },
+}
+
+// table of Match testcases on overlappingApiTable.
+var overlappingMatch_Tab = []Match_TC {
+	{ "/x/b/c", "/x/b/{q}", map[string]string{"q": "c"}, true },
+	{ "/x/a/c", "/x/{p}/c", map[string]string{"p": "a"}, true },
+	{ "/y", "/y", map[string]string{}, true },
+}
+
+// a literal segment takes precedence over a parameter,
+// whatever the order of the routes.
+func Test_Match_overlapping(t *testing.T) {
+	cx := newTestContext(t, "overlappingMatch_Tab")
+	ws := newApiWiring("", overlappingApiTable)
+	for _, tc := range overlappingMatch_Tab {
+		Match_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// inputs and outputs for one ServeHTTP testcase.
+type ServeHTTP_TC struct {
+	verb string
+	path string
+	xcode int
+	xbody string
+}
+
+// table of ServeHTTP testcases.
+var ServeHTTP_Tab = []ServeHTTP_TC {
+	{ http.MethodGet, "/db/_table/foo/3",
+		http.StatusOK, `{"id":"3","table_name":"foo"}` },
+	{ http.MethodGet, "/db/_table/_schema/3", abcGetRet, "" },
+	{ http.MethodGet, "/db/_schema/bar", xyzPutRet, "" },
+	{ http.MethodPost, "/db/_schema/bar",
+		http.StatusMethodNotAllowed, "" },
+	{ http.MethodGet, "/nosuch", http.StatusNotFound, "" },
+}
+
+// run one testcase for method ServeHTTP.
+func ServeHTTP_Checker(cx *testContext, ws *apiWiring, tc *ServeHTTP_TC) {
+	r, _ := http.NewRequest(tc.verb, tc.path, strings.NewReader(""))
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	if !cx.assertEqual(tc.xcode, w.Code, "returned code") {
+		return
+	}
+	if tc.xbody != "" {
+		cx.assertEqual(tc.xbody, w.Body.String(), "body")
+	}
+}
+
+// the ServeHTTP test suite.  run all ServeHTTP testcases.
+func Test_ServeHTTP(t *testing.T) {
+	cx := newTestContext(t, "ServeHTTP_Tab")
+	ws := newApiWiring("", routedApiTable)
+	for _, tc := range ServeHTTP_Tab {
+		ServeHTTP_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for OPTIONS and HEAD handling in pathDispatch().
+
+// inputs and outputs for one implicit-method testcase.
+type implicitMethod_TC struct {
+	verb string
+	path string
+	xcode int
+	xheaders map[string]string
+	xbody string
+}
+
+// table of implicit-method testcases.
+var implicitMethod_Tab = []implicitMethod_TC {
+	{ http.MethodOptions, "/abc", http.StatusNoContent,
+		map[string]string{"Allow": "GET,HEAD,OPTIONS,POST",
+			"Accept-Post": "application/json",
+			"Accept-Patch": ""},
+		"" },
+	{ http.MethodOptions, "/pqr", http.StatusNoContent,
+		map[string]string{"Allow": "OPTIONS,PATCH",
+			"Accept-Patch": "application/json," +
+				mergePatchType + "," + jsonPatchType},
+		"" },
+	{ http.MethodHead, "/db/_table/foo/3", http.StatusOK,
+		map[string]string{"Content-Length": "29"},
+		"" },
+	{ http.MethodHead, "/xyz", http.StatusMethodNotAllowed,
+		map[string]string{"Allow": "DELETE,OPTIONS,PUT"},
+		"" },
+	{ http.MethodPatch, "/xyz", http.StatusMethodNotAllowed,
+		map[string]string{"Allow": "DELETE,OPTIONS,PUT",
+			"Allowed": ""},
+		"" },
+}
+
+// run one testcase for an implicit method.
+func implicitMethod_Checker(cx *testContext, ws *apiWiring, tc *implicitMethod_TC) {
+	r, _ := http.NewRequest(tc.verb, tc.path, strings.NewReader(""))
+	w := httptest.NewRecorder()
+	ws.ServeHTTP(w, r)
+	if !cx.assertEqual(tc.xcode, w.Code, "returned code") {
+		return
+	}
+	for name, xval := range tc.xheaders {
+		cx.assertEqual(xval, w.Header().Get(name), name)
+	}
+	if tc.verb != http.MethodPatch {
+		cx.assertEqual(tc.xbody, w.Body.String(), "body")
+	}
+}
+
+// the implicit-method test suite.  run all implicitMethod testcases.
+func Test_implicitMethods(t *testing.T) {
+	cx := newTestContext(t, "implicitMethod_Tab")
+	tab := append(append([]apiDesc{}, fakeApiTable...), routedApiTable...)
+	ws := newApiWiring("", tab)
+	for _, tc := range implicitMethod_Tab {
+		implicitMethod_Checker(cx, ws, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// ----- unit tests for stream()
+
+// inputs and outputs for one stream testcase.
+// the body is written, then the error, if any, returned.
+// xctype is the Content-Type of the response written, if any.
+type stream_TC struct {
+	verb string
+	body string
+	err string
+	xcode int
+	xbody string
+	xctype string
+}
+
+// table of stream testcases.
+var stream_Tab = []stream_TC {
+	{ http.MethodGet, "abc", "", http.StatusOK, "abc", "text/plain" },
+	{ http.MethodGet, "", "", http.StatusOK, "", "text/plain" },
+	{ http.MethodGet, "", "failed", badStat, "", "" },
+	{ http.MethodGet, "abc", "failed", http.StatusOK, "abc", "text/plain" },
+	{ http.MethodHead, "abc", "", http.StatusOK, "", "text/plain" },
+}
+
+// run one testcase for method stream.
+func stream_Checker(cx *testContext, tc *stream_TC) {
+	req, _ := http.NewRequest(tc.verb, "/abc", strings.NewReader(""))
+	harg := mkApiHandlerArg(req, nil)
+	w := httptest.NewRecorder()
+	harg.w = w
+	res := harg.stream(http.StatusOK, "text/plain",
+		func(w io.Writer) error {
+			_, _ = w.Write([]byte(tc.body))
+			if tc.err != "" {
+				return fmt.Errorf("%s", tc.err)
+			}
+			return nil
+		})
+	cx.assertEqual(tc.xcode, res.code, "returned code")
+	cx.assertEqual(tc.xbody, w.Body.String(), "body")
+	cx.assertEqual(tc.xctype, w.Header().Get("Content-Type"),
+		"content type")
+	if res.code == http.StatusOK {
+		cx.assertEqualObj(streamedBody{}, res.data, "returned data")
+	}
+}
+
+// the stream test suite.  run all stream testcases.
+func Test_stream(t *testing.T) {
+	cx := newTestContext(t, "stream_Tab")
+	for _, tc := range stream_Tab {
+		stream_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}
+
+// without a ResponseWriter, the body is returned as data.
+func Test_stream_direct(t *testing.T) {
+	cx := newTestContext(t)
+	harg := parseHandlerArg(http.MethodGet, "/abc")
+	res := harg.stream(http.StatusOK, "text/plain",
+		func(w io.Writer) error {
+			_, err := w.Write([]byte("abc"))
+			return err
+		})
+	cx.assertEqual(http.StatusOK, res.code, "returned code")
+	cx.assertEqualObj([]byte("abc"), res.data, "returned data")
+	cx.assertEqual("text/plain", harg.header.Get("Content-Type"),
+		"content type")
+}
+
+// ----- unit tests for decodeBody()
+
+// inputs and outputs for one decodeBody testcase.
+type decodeBody_TC struct {
+	body string
+	strict bool
+	xsucc bool
+	xcode int
+}
+
+// table of decodeBody testcases.  maxBodySize is 64 for these.
+var decodeBody_Tab = []decodeBody_TC {
+	{ `{"records":[]}`, true, true, 0 },
+	{ `{"records":[]}` + "\n  ", true, true, 0 },
+	{ `{"record":[]}`, true, false, badStat },
+	{ `{"record":[]}`, false, true, 0 },
+	{ `{"records":[]} {"records":[]}`, true, false, badStat },
+	{ `{"records":[]} junk`, true, false, badStat },
+	{ `{"records":[`, true, false, badStat },
+	{ `{"records":[{"keys":["name"],"values":["` +
+		strings.Repeat("x", 64) + `"]}]}`,
+		true, false, http.StatusRequestEntityTooLarge },
+	{ `{"records":[]}` + strings.Repeat(" ", 64), true, false,
+		http.StatusRequestEntityTooLarge },
+}
+
+// run one testcase for method decodeBody.
+func decodeBody_Checker(cx *testContext, tc *decodeBody_TC) {
+	req, _ := http.NewRequest(http.MethodPost, "/abc",
+		strings.NewReader(tc.body))
+	harg := mkApiHandlerArg(req, nil)
+	strictJSON = tc.strict
+	body := BodyRecord{}
+	err := harg.decodeBody(&body)
+	if !cx.assertEqual(tc.xsucc, err == nil, "success") || err == nil {
+		return
+	}
+	code, _ := classifyError(badStat, err)
+	cx.assertEqual(tc.xcode, code, "status")
+}
+
+// the decodeBody test suite.  run all decodeBody testcases.
+func Test_decodeBody(t *testing.T) {
+	cx := newTestContext(t, "decodeBody_Tab")
+	saveSize, saveStrict := maxBodySize, strictJSON
+	defer func() {
+		maxBodySize, strictJSON = saveSize, saveStrict
+	}()
+	maxBodySize = 64
+	for _, tc := range decodeBody_Tab {
+		decodeBody_Checker(cx, &tc)
+		cx.bump()	// increment testno.
+	}
+}